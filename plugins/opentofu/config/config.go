@@ -14,20 +14,403 @@
 
 package config
 
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// Engine represents the binary used to execute the commands.
+type Engine string
+
+const (
+	// EngineOpenTofu executes the commands with OpenTofu.
+	EngineOpenTofu Engine = "opentofu"
+	// EngineTerraform executes the commands with HashiCorp Terraform.
+	EngineTerraform Engine = "terraform"
+)
+
 // Config represents the plugin-scoped configuration.
-type Config struct{}
+type Config struct {
+	// Configuration for installing providers from mirrors instead of their origin registries.
+	// This is used for all deploy targets which don't configure their own providerMirror.
+	ProviderMirror *ProviderMirrorConfig `json:"providerMirror,omitempty"`
+	// Configuration for decrypting the secrets encrypted by piped's secret management.
+	SecretManagement *SecretManagementConfig `json:"secretManagement,omitempty"`
+	// The directory where the plan of each deployment is stored for auditing.
+	// Empty means "pipecd-opentofu/plans" under the user cache directory of the host running piped.
+	PlanHistoryDir string `json:"planHistoryDir,omitempty"`
+	// The number of the latest plans kept in the plan history for each application.
+	// Older plans are deleted when a new one is stored. Defaults to 20.
+	PlanHistoryRetention int `json:"planHistoryRetention,omitempty"`
+	// List of the credentials for the private registries of modules and providers,
+	// such as a private registry or HCP Terraform.
+	// They are written to the OpenTofu CLI configuration file generated for every command, and masked in the logs.
+	// The CLI configuration only authenticates the registries and the remote backends,
+	// so set gitUsername to also use the token for the git module sources over HTTPS.
+	RegistryCredentials []RegistryCredential `json:"registryCredentials,omitempty"`
+	// The path to the price catalog file on the host running piped used by the OPENTOFU_COST_ESTIMATE stages
+	// which don't set their own priceCatalogFile.
+	PriceCatalogFile string `json:"priceCatalogFile,omitempty"`
+}
+
+// RegistryCredential represents the API token for a registry host.
+// Either encryptedToken or tokenFile must be set.
+type RegistryCredential struct {
+	// The hostname of the registry, such as "registry.example.com".
+	Host string `json:"host"`
+	// The token encrypted by piped's secret management.
+	// This requires secretManagement in the plugin config.
+	EncryptedToken string `json:"encryptedToken,omitempty"`
+	// The path to the file containing the token on the host running piped, such as a mounted secret.
+	// The file is read for every command, so the token can be rotated without restarting piped.
+	TokenFile string `json:"tokenFile,omitempty"`
+	// The username to clone the git repositories on the host over HTTPS with the token,
+	// such as "x-access-token" for GitHub or "oauth2" for GitLab.
+	// Empty means the token isn't used for git.
+	GitUsername string `json:"gitUsername,omitempty"`
+}
+
+// ValidateRegistryCredentials checks that each registry credential has a unique host and exactly one token source.
+func (c *Config) ValidateRegistryCredentials() error {
+	hosts := make(map[string]struct{}, len(c.RegistryCredentials))
+	for _, rc := range c.RegistryCredentials {
+		if rc.Host == "" || strings.ContainsAny(rc.Host, "/ ") {
+			return fmt.Errorf("host of registry credential must be a hostname but got %q", rc.Host)
+		}
+		host := strings.ToLower(rc.Host)
+		if _, ok := hosts[host]; ok {
+			return fmt.Errorf("registry credential for host %q is duplicated", rc.Host)
+		}
+		hosts[host] = struct{}{}
+		if (rc.EncryptedToken == "") == (rc.TokenFile == "") {
+			return fmt.Errorf("either encryptedToken or tokenFile of registry credential for host %q must be set", rc.Host)
+		}
+	}
+	return nil
+}
+
+// SecretManagementConfig represents the key used to decrypt the secrets encrypted by piped's secret management.
+// This must be the same key pair as the one configured in the piped config.
+type SecretManagementConfig struct {
+	// The path to the private key file of the key pair.
+	PrivateKeyFile string `json:"privateKeyFile"`
+}
+
+// ProviderMirrorConfig represents the provider installation methods written to the OpenTofu CLI configuration file.
+// At least one of filesystemMirror and networkMirror must be set.
+type ProviderMirrorConfig struct {
+	// The local directory which contains the providers laid out as a filesystem mirror.
+	// e.g. "/usr/share/opentofu/providers"
+	FilesystemMirror string `json:"filesystemMirror,omitempty"`
+	// The base URL of a network mirror. It must be an https URL.
+	// e.g. "https://tofu-mirror.example.com/providers/"
+	NetworkMirror string `json:"networkMirror,omitempty"`
+	// List of provider source address patterns which are installed from the mirrors.
+	// Empty means all providers.
+	// e.g. "registry.opentofu.org/hashicorp/*"
+	Include []string `json:"include,omitempty"`
+	// List of provider source address patterns which are never installed from the mirrors.
+	Exclude []string `json:"exclude,omitempty"`
+	// Whether to install the providers from their origin registries when they are not found in the mirrors.
+	// Keep this false to run OpenTofu commands without internet access.
+	AllowDirect bool `json:"allowDirect,omitempty"`
+}
+
+func (c *ProviderMirrorConfig) Validate() error {
+	if c.FilesystemMirror == "" && c.NetworkMirror == "" {
+		return errors.New("either filesystemMirror or networkMirror must be set")
+	}
+	if c.NetworkMirror != "" {
+		u, err := url.Parse(c.NetworkMirror)
+		if err != nil {
+			return err
+		}
+		if u.Scheme != "https" {
+			return errors.New("networkMirror must be an https URL")
+		}
+	}
+	return nil
+}
 
 // DeployTargetConfig represents the deploy-target-scoped configuration.
 type DeployTargetConfig struct {
-	// List of variables that will be set directly on opentofu commands with "-var" flag.
+	// List of variables that will be written to a generated variable file passed to opentofu commands after the varFiles,
+	// so that they take precedence over the variables set by any variable files.
 	// The variable must be formatted by "key=value" as below:
 	// "image_id=ami-abc123"
 	// 'image_id_list=["ami-abc123","ami-def456"]'
 	// 'image_id_map={"us-east-1":"ami-abc123","us-east-2":"ami-def456"}'
 	Vars []string `json:"vars,omitempty"`
+	// Map of variable name to the value encrypted by piped's secret management.
+	// The values are decrypted at run time, passed the same way as vars and masked in the logs.
+	// This requires secretManagement in the plugin config.
+	EncryptedVars map[string]string `json:"encryptedVars,omitempty"`
+	// Map of variable name to the value of any type such as a list or a map.
+	// The values are written to the generated variable file together with the vars, so they don't need to be quoted as JSON strings.
+	// A variable set in both this and vars takes the value from vars.
+	Variables map[string]any `json:"variables,omitempty"`
 	// Enable drift detection.
 	// TODO: This is a temporary option because  drift detection is buggy and has performance issues. This will be possibly removed in the future release.
 	DriftDetectionEnabled *bool `json:"driftDetectionEnabled" default:"true"`
+	// Configuration for installing providers from mirrors.
+	// This overrides the plugin-scoped providerMirror.
+	ProviderMirror *ProviderMirrorConfig `json:"providerMirror,omitempty"`
+	// Configuration for the state and plan encryption of OpenTofu.
+	// This is passed to every command by the TF_ENCRYPTION environment variable, so it can't be used with terraform.
+	Encryption *EncryptionConfig `json:"encryption,omitempty"`
+	// The cloud credentials used by the providers and backends.
+	// They are passed to every command by environment variables and files generated for the stage,
+	// which are removed after the stage.
+	Credentials *CredentialsConfig `json:"credentials,omitempty"`
+}
+
+// EncryptionConfig represents the configuration for the state and plan encryption.
+// See https://opentofu.org/docs/language/state/encryption/
+type EncryptionConfig struct {
+	// The key providers which provide the keys to the methods.
+	KeyProviders []EncryptionKeyProvider `json:"keyProviders"`
+	// The encryption methods.
+	Methods []EncryptionMethod `json:"methods"`
+	// How to encrypt the state.
+	State *EncryptionTarget `json:"state,omitempty"`
+	// How to encrypt the saved plan files.
+	Plan *EncryptionTarget `json:"plan,omitempty"`
+}
+
+// EncryptionKeyProvider represents a key provider.
+type EncryptionKeyProvider struct {
+	// The type of the key provider. One of "pbkdf2" or "external".
+	Type string `json:"type"`
+	// The name referred by the methods.
+	Name string `json:"name"`
+	// The passphrase of the "pbkdf2" key provider encrypted by piped's secret management.
+	// This requires secretManagement in the plugin config.
+	EncryptedPassphrase string `json:"encryptedPassphrase,omitempty"`
+	// The optional parameters of the "pbkdf2" key provider.
+	// Zero means the default of OpenTofu.
+	KeyLength    int    `json:"keyLength,omitempty"`
+	Iterations   int    `json:"iterations,omitempty"`
+	SaltLength   int    `json:"saltLength,omitempty"`
+	HashFunction string `json:"hashFunction,omitempty"`
+	// The command of the "external" key provider which outputs the keys.
+	// The command must be available on the host running piped.
+	Command []string `json:"command,omitempty"`
+}
+
+// EncryptionMethod represents an encryption method.
+type EncryptionMethod struct {
+	// The type of the method. One of "aes_gcm" or "unencrypted".
+	Type string `json:"type"`
+	// The name referred by the state and plan.
+	Name string `json:"name"`
+	// The name of the key provider. Required for "aes_gcm".
+	KeyProvider string `json:"keyProvider,omitempty"`
+}
+
+// EncryptionTarget represents how to encrypt the state or plan.
+type EncryptionTarget struct {
+	// The name of the method used to encrypt and decrypt.
+	Method string `json:"method"`
+	// The name of the method used to decrypt the data which can't be decrypted by method.
+	// Set the previous method while rotating keys or migrating from the unencrypted state.
+	Fallback string `json:"fallback,omitempty"`
+	// Whether to refuse writing the data unencrypted.
+	Enforced bool `json:"enforced,omitempty"`
+}
+
+func (c *EncryptionConfig) Validate() error {
+	providers := make(map[string]struct{}, len(c.KeyProviders))
+	for _, kp := range c.KeyProviders {
+		if kp.Name == "" {
+			return errors.New("name of key provider must be set")
+		}
+		if _, ok := providers[kp.Name]; ok {
+			return fmt.Errorf("key provider %q is duplicated", kp.Name)
+		}
+		providers[kp.Name] = struct{}{}
+		switch kp.Type {
+		case "pbkdf2":
+			if kp.EncryptedPassphrase == "" {
+				return fmt.Errorf("encryptedPassphrase of key provider %q must be set", kp.Name)
+			}
+		case "external":
+			if len(kp.Command) == 0 {
+				return fmt.Errorf("command of key provider %q must be set", kp.Name)
+			}
+		default:
+			return fmt.Errorf("type of key provider %q must be one of \"pbkdf2\" or \"external\"", kp.Name)
+		}
+	}
+
+	methods := make(map[string]struct{}, len(c.Methods))
+	for _, m := range c.Methods {
+		if m.Name == "" {
+			return errors.New("name of method must be set")
+		}
+		if _, ok := methods[m.Name]; ok {
+			return fmt.Errorf("method %q is duplicated", m.Name)
+		}
+		methods[m.Name] = struct{}{}
+		switch m.Type {
+		case "aes_gcm":
+			if m.KeyProvider == "" {
+				return fmt.Errorf("keyProvider of method %q must be set", m.Name)
+			}
+		case "unencrypted":
+			if m.KeyProvider != "" {
+				return fmt.Errorf("method %q doesn't use keyProvider", m.Name)
+			}
+		default:
+			return fmt.Errorf("type of method %q must be one of \"aes_gcm\" or \"unencrypted\"", m.Name)
+		}
+		if _, ok := providers[m.KeyProvider]; m.KeyProvider != "" && !ok {
+			return fmt.Errorf("method %q refers to unknown key provider %q", m.Name, m.KeyProvider)
+		}
+	}
+
+	if c.State == nil && c.Plan == nil {
+		return errors.New("either state or plan must be set")
+	}
+	for name, t := range map[string]*EncryptionTarget{"state": c.State, "plan": c.Plan} {
+		if t == nil {
+			continue
+		}
+		if _, ok := methods[t.Method]; !ok {
+			return fmt.Errorf("%s refers to unknown method %q", name, t.Method)
+		}
+		if _, ok := methods[t.Fallback]; t.Fallback != "" && !ok {
+			return fmt.Errorf("%s refers to unknown fallback method %q", name, t.Fallback)
+		}
+	}
+	return nil
+}
+
+// CredentialsConfig represents the credentials of each cloud.
+type CredentialsConfig struct {
+	AWS   *AWSCredentials   `json:"aws,omitempty"`
+	GCP   *GCPCredentials   `json:"gcp,omitempty"`
+	Azure *AzureCredentials `json:"azure,omitempty"`
+}
+
+// AWSCredentials represents the credentials of AWS.
+type AWSCredentials struct {
+	// The name of the profile in the shared config or credentials file of the host running piped.
+	Profile string `json:"profile,omitempty"`
+	// The ARN of the IAM role to assume.
+	// The role is assumed with the credentials of profile, or the ones from credentialSource when profile is empty.
+	RoleARN string `json:"roleARN,omitempty"`
+	// The session name used to assume the role, which is recorded in CloudTrail.
+	// Empty means a name generated by the AWS SDK.
+	RoleSessionName string `json:"roleSessionName,omitempty"`
+	// The external ID required by the trust policy of the role.
+	ExternalID string `json:"externalID,omitempty"`
+	// Where to get the credentials to assume the role when profile is empty.
+	// One of "Environment", "Ec2InstanceMetadata" or "EcsContainer".
+	// Empty means "Environment".
+	CredentialSource string `json:"credentialSource,omitempty"`
+}
+
+// GCPCredentials represents the credentials of Google Cloud.
+type GCPCredentials struct {
+	// The path to the credentials file on the host running piped,
+	// such as a service account key or a workload identity federation configuration.
+	CredentialsFile string `json:"credentialsFile,omitempty"`
+	// The content of the credentials file encrypted by piped's secret management.
+	// It's written to a file removed after the stage.
+	// This requires secretManagement in the plugin config.
+	EncryptedCredentials string `json:"encryptedCredentials,omitempty"`
+	// The email of the service account to impersonate.
+	ImpersonateServiceAccount string `json:"impersonateServiceAccount,omitempty"`
+}
+
+// AzureCredentials represents the credentials of Azure.
+// Without encryptedClientSecret, oidcTokenFile and useManagedIdentity, only the IDs are passed
+// and the providers authenticate by their default methods such as the Azure CLI.
+type AzureCredentials struct {
+	// The client ID of the service principal or the managed identity.
+	ClientID string `json:"clientID,omitempty"`
+	// The ID of the tenant.
+	TenantID string `json:"tenantID,omitempty"`
+	// The ID of the subscription.
+	SubscriptionID string `json:"subscriptionID,omitempty"`
+	// The client secret of the service principal encrypted by piped's secret management.
+	// This requires secretManagement in the plugin config.
+	EncryptedClientSecret string `json:"encryptedClientSecret,omitempty"`
+	// The path to the file containing the OIDC token to authenticate by the workload identity federation,
+	// such as the one projected by AKS workload identity.
+	OIDCTokenFile string `json:"oidcTokenFile,omitempty"`
+	// Whether to authenticate by the managed identity of the host running piped.
+	// Set clientID to use a user-assigned managed identity.
+	UseManagedIdentity bool `json:"useManagedIdentity,omitempty"`
+}
+
+func (c *CredentialsConfig) Validate() error {
+	if c.AWS != nil {
+		if err := c.AWS.validate(); err != nil {
+			return fmt.Errorf("invalid aws credentials: %w", err)
+		}
+	}
+	if c.GCP != nil {
+		if err := c.GCP.validate(); err != nil {
+			return fmt.Errorf("invalid gcp credentials: %w", err)
+		}
+	}
+	if c.Azure != nil {
+		if err := c.Azure.validate(); err != nil {
+			return fmt.Errorf("invalid azure credentials: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *AWSCredentials) validate() error {
+	if c.Profile == "" && c.RoleARN == "" {
+		return errors.New("either profile or roleARN must be set")
+	}
+	if c.RoleARN == "" && (c.RoleSessionName != "" || c.ExternalID != "" || c.CredentialSource != "") {
+		return errors.New("roleSessionName, externalID and credentialSource require roleARN")
+	}
+	switch c.CredentialSource {
+	case "", "Environment", "Ec2InstanceMetadata", "EcsContainer":
+	default:
+		return errors.New("credentialSource must be one of \"Environment\", \"Ec2InstanceMetadata\" or \"EcsContainer\"")
+	}
+	if c.Profile != "" && c.CredentialSource != "" {
+		return errors.New("credentialSource can't be used with profile")
+	}
+	return nil
+}
+
+func (c *GCPCredentials) validate() error {
+	if c.CredentialsFile != "" && c.EncryptedCredentials != "" {
+		return errors.New("credentialsFile and encryptedCredentials can't be set at the same time")
+	}
+	if c.CredentialsFile == "" && c.EncryptedCredentials == "" && c.ImpersonateServiceAccount == "" {
+		return errors.New("one of credentialsFile, encryptedCredentials or impersonateServiceAccount must be set")
+	}
+	return nil
+}
+
+func (c *AzureCredentials) validate() error {
+	methods := 0
+	for _, set := range []bool{c.EncryptedClientSecret != "", c.OIDCTokenFile != "", c.UseManagedIdentity} {
+		if set {
+			methods++
+		}
+	}
+	if methods > 1 {
+		return errors.New("only one of encryptedClientSecret, oidcTokenFile and useManagedIdentity can be set")
+	}
+	if (c.EncryptedClientSecret != "" || c.OIDCTokenFile != "") && (c.ClientID == "" || c.TenantID == "") {
+		return errors.New("clientID and tenantID must be set to authenticate by encryptedClientSecret or oidcTokenFile")
+	}
+	if methods == 0 && c.ClientID == "" && c.TenantID == "" && c.SubscriptionID == "" {
+		return errors.New("either the IDs or an authentication method must be set")
+	}
+	return nil
 }
 
 // ApplicationConfigSpec represents the application-scoped plugin config.
@@ -35,31 +418,308 @@ type ApplicationConfigSpec struct {
 	// The opentofu workspace name.
 	// Empty means "default" workspace.
 	Workspace string `json:"workspace,omitempty"`
+	// The engine used to execute the commands. One of "opentofu" or "terraform".
+	// Empty means "opentofu".
+	Engine Engine `json:"engine,omitempty"`
 	// The version of opentofu that should be used.
 	// Empty means the pre-installed version will be used.
 	OpenTofuVersion string `json:"openTofuVersion,omitempty"`
-	// List of variables that will be set directly on opentofu commands with "-var" flag.
+	// The version of terraform that should be used when the engine is "terraform".
+	// Empty means the pre-installed version will be used.
+	// The OPENTOFU_TEST stage requires v1.6.0 or later.
+	TerraformVersion string `json:"terraformVersion,omitempty"`
+	// List of variables that will be written to a generated variable file passed to opentofu commands after the varFiles,
+	// so that they take precedence over the variables set by any variable files.
+	// They take precedence over the vars of the deploy target.
 	// The variable must be formatted by "key=value" as below:
 	// "image_id=ami-abc123"
 	// 'image_id_list=["ami-abc123","ami-def456"]'
 	// 'image_id_map={"us-east-1":"ami-abc123","us-east-2":"ami-def456"}'
 	Vars []string `json:"vars,omitempty"`
+	// Map of variable name to the value of any type such as a list or a map.
+	// The values are written to the generated variable file together with the vars, so they don't need to be quoted as JSON strings.
+	// They take precedence over the vars and variables of the deploy target.
+	// A variable set in both this and vars takes the value from vars.
+	Variables map[string]any `json:"variables,omitempty"`
 	// List of variable files that will be set on opentofu commands with "-var-file" flag.
 	VarFiles []string `json:"varFiles,omitempty"`
 	// List of additional flags will be used while executing opentofu commands.
 	CommandFlags OpenTofuCommandFlags `json:"commandFlags"`
 	// List of additional environment variables will be used while executing opentofu commands.
 	CommandEnvs OpenTofuCommandEnvs `json:"commandEnvs"`
+	// How long to wait for the commands to stop gracefully after they are interrupted
+	// by cancelling the deployment or by the stage timeout. They are killed after this period.
+	// Empty means 30s.
+	CancelGracePeriod Duration `json:"cancelGracePeriod,omitempty"`
+	// List of the stacks in the application.
+	// Each stack is a root module which is planned and applied separately in the order of their dependencies.
+	// Empty means the application directory is the only root module.
+	Stacks []OpenTofuStack `json:"stacks,omitempty"`
+	// Configuration to deploy a short-lived environment for each pull request.
+	PullRequestEnvironment *OpenTofuPullRequestEnvironment `json:"pullRequestEnvironment,omitempty"`
+	// The options of the OPENTOFU_ROLLBACK stage, which is added to the pipeline automatically.
+	// The ones at the last deployed commit are used.
+	Rollback OpenTofuRollbackStageOptions `json:"rollback,omitempty"`
+}
+
+// validateStacks checks that the stacks have unique names and their dependencies don't form a cycle.
+func validateStacks(stacks []OpenTofuStack) error {
+	deps := make(map[string][]string, len(stacks))
+	for _, st := range stacks {
+		if st.Name == "" {
+			return errors.New("stack name must be set")
+		}
+		if _, ok := deps[st.Name]; ok {
+			return fmt.Errorf("duplicate stack name %q", st.Name)
+		}
+		if st.Dir == "" || !filepath.IsLocal(st.Dir) {
+			return fmt.Errorf("dir of stack %q must be a path inside the application directory", st.Name)
+		}
+		deps[st.Name] = st.DependsOn
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(stacks))
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("stack %q depends on itself through its dependencies", name)
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, d := range deps[name] {
+			if _, ok := deps[d]; !ok {
+				return fmt.Errorf("stack %q depends on unknown stack %q", name, d)
+			}
+			if err := visit(d); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	for _, st := range stacks {
+		if err := visit(st.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OpenTofuStack represents a root module in the application.
+type OpenTofuStack struct {
+	// The unique name of the stack.
+	Name string `json:"name"`
+	// The path to the root module relative to the application directory.
+	Dir string `json:"dir"`
+	// The opentofu workspace name.
+	// Empty means the workspace of the application.
+	Workspace string `json:"workspace,omitempty"`
+	// List of variables only for the stack, formatted by "key=value".
+	// They take precedence over the vars of the application.
+	Vars []string `json:"vars,omitempty"`
+	// List of variable files only for the stack, relative to the stack directory.
+	VarFiles []string `json:"varFiles,omitempty"`
+	// The names of the stacks which must be applied before this stack.
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+// OpenTofuPullRequestEnvironment represents how the deployments for pull requests are deployed to their own workspaces.
+// A deployment is for a pull request when it has the label of the pull request number,
+// e.g. the application is registered for each pull request with the labels by the CI.
+// Such a deployment selects or creates the workspace of the pull request in every stack,
+// and passes the number and the branch by the "pull_request_number" and "pull_request_branch" variables.
+type OpenTofuPullRequestEnvironment struct {
+	// The label of the deployment whose value is the pull request number.
+	// Empty means "pull-request".
+	PullRequestLabel string `json:"pullRequestLabel,omitempty"`
+	// The label of the deployment whose value is the branch of the pull request.
+	// Empty means "branch".
+	BranchLabel string `json:"branchLabel,omitempty"`
+	// The prefix of the workspace name followed by the pull request number.
+	// Empty means "pr-".
+	WorkspacePrefix string `json:"workspacePrefix,omitempty"`
+	// List of the output names written to the log after apply, such as the URLs of the environment.
+	// Empty means all outputs. The sensitive outputs are always masked.
+	Outputs []string `json:"outputs,omitempty"`
 }
 
 // OpenTofuPlanStageOptions contains all configurable values for an OPENTOFU_PLAN stage.
 type OpenTofuPlanStageOptions struct {
 	// Exit the pipeline if the result is "No Changes" with success status.
 	ExitOnNoChanges bool `json:"exitOnNoChanges"`
+	// Show the attributes which are not changed in the rendered plan.
+	// They are hidden by default to keep the diff short.
+	ShowUnchangedAttributes bool `json:"showUnchangedAttributes,omitempty"`
+	// The maximum time the stage can take, including "tofu init".
+	// Empty means no timeout.
+	Timeout Duration `json:"timeout,omitempty"`
+	// The policy to retry "tofu plan" when it fails with a transient error.
+	Retry OpenTofuRetryOptions `json:"retry,omitempty"`
+	// The policy for the sources of the "module" blocks checked before planning.
+	ModuleSourcePolicy *OpenTofuModuleSourcePolicy `json:"moduleSourcePolicy,omitempty"`
+	// Show how the plan differs from the last one applied successfully,
+	// and how many times each resource has been changed the same way in the past deployments.
+	CompareWithLastApplied bool `json:"compareWithLastApplied,omitempty"`
+}
+
+// OpenTofuModuleSourcePolicy represents the policy for the sources of the "module" blocks.
+// The local modules are always allowed.
+type OpenTofuModuleSourcePolicy struct {
+	// Require the remote modules to be pinned to a fixed version:
+	// git sources by "ref" of a commit SHA or a version tag, and registry modules by an exact "version".
+	RequirePinned bool `json:"requirePinned,omitempty"`
+	// List of the hosts and namespaces the modules can be sourced from, such as "github.com/my-org" or "registry.opentofu.org/my-namespace".
+	// Empty means any location.
+	AllowedSources []string `json:"allowedSources,omitempty"`
+	// List of the hosts and namespaces the modules can't be sourced from.
+	// This takes precedence over allowedSources.
+	DeniedSources []string `json:"deniedSources,omitempty"`
 }
 
 // OpenTofuApplyStageOptions contains all configurable values for an OPENTOFU_APPLY stage.
 type OpenTofuApplyStageOptions struct {
+	// The maximum time the stage can take, including "tofu init".
+	// Empty means no timeout.
+	Timeout Duration `json:"timeout,omitempty"`
+	// The policy to retry "tofu apply" when it fails with a transient error.
+	// "tofu plan" is executed again before each retry.
+	Retry OpenTofuRetryOptions `json:"retry,omitempty"`
+	// List of waves to apply the changes progressively in the order.
+	// Each wave is applied with the "-target" flag, and a final apply without targets follows the last wave
+	// to apply the remaining changes and confirm the convergence.
+	// Empty means all changes are applied at once.
+	Waves []OpenTofuApplyWave `json:"waves,omitempty"`
+}
+
+func (o *OpenTofuApplyStageOptions) Validate() error {
+	for i, w := range o.Waves {
+		if len(w.Targets) == 0 {
+			return fmt.Errorf("targets of wave %d must be set", i+1)
+		}
+	}
+	return nil
+}
+
+// OpenTofuApplyWave represents a set of changes applied together.
+type OpenTofuApplyWave struct {
+	// The name of the wave shown in the logs.
+	// Empty means "wave-<index>".
+	Name string `json:"name,omitempty"`
+	// List of the resource or module addresses to be applied in the wave, passed with the "-target" flag.
+	// A module address also targets all resources in the module.
+	// e.g. "module.network", "aws_instance.web"
+	Targets []string `json:"targets"`
+	// The shell command executed in the stack directory after the wave is applied.
+	// The following waves are not applied when it exits with non-zero code.
+	// e.g. "./scripts/healthcheck.sh"
+	Verify string `json:"verify,omitempty"`
+}
+
+// OpenTofuRefreshStageOptions contains all configurable values for an OPENTOFU_REFRESH stage.
+// The stage updates the state to match the real infrastructure, so it takes the same settings as an OPENTOFU_APPLY stage
+// and applies them to "tofu apply -refresh-only", e.g. the waves accept the drift of their targets progressively.
+type OpenTofuRefreshStageOptions struct {
+	OpenTofuApplyStageOptions
+	// Exit the pipeline if the state already matches the real infrastructure.
+	ExitOnNoChanges bool `json:"exitOnNoChanges,omitempty"`
+	// Run the stage even when the pipeline has no WAIT_APPROVAL stage.
+	// By default, the stage requires a WAIT_APPROVAL stage placed before it in the pipeline
+	// to approve the changes to the state, which are shown by a preceding OPENTOFU_PLAN stage.
+	SkipApprovalCheck bool `json:"skipApprovalCheck,omitempty"`
+}
+
+// OpenTofuRollbackStageOptions contains all configurable values for an OPENTOFU_ROLLBACK stage.
+type OpenTofuRollbackStageOptions struct {
+	// The maximum time the stage can take, including "tofu init".
+	// Empty means no timeout.
+	Timeout Duration `json:"timeout,omitempty"`
+	// The policy to retry "tofu apply" when it fails with a transient error.
+	// "tofu plan" is executed again before each retry.
+	Retry OpenTofuRetryOptions `json:"retry,omitempty"`
+}
+
+// OpenTofuVerifyStageOptions contains all configurable values for an OPENTOFU_VERIFY stage.
+type OpenTofuVerifyStageOptions struct {
+	// The maximum time the stage can take, including "tofu init".
+	// Empty means no timeout.
+	Timeout Duration `json:"timeout,omitempty"`
+	// The policy to verify again when the plan still has changes or a check fails,
+	// which is useful for the providers whose APIs are eventually consistent.
+	// They are always retried, and retryableErrors is needed only to also retry the errors of the commands.
+	Retry OpenTofuRetryOptions `json:"retry,omitempty"`
+}
+
+// OpenTofuPullRequestCleanupStageOptions contains all configurable values for an OPENTOFU_PULL_REQUEST_CLEANUP stage.
+// The stage destroys the environment of the pull request and deletes its workspaces.
+type OpenTofuPullRequestCleanupStageOptions struct {
+	// The maximum time the stage can take, including "tofu init".
+	// Empty means no timeout.
+	Timeout Duration `json:"timeout,omitempty"`
+	// The policy to retry "tofu apply -destroy" when it fails with a transient error.
+	// "tofu plan -destroy" is executed again before each retry.
+	Retry OpenTofuRetryOptions `json:"retry,omitempty"`
+}
+
+// OpenTofuCostEstimateStageOptions contains all configurable values for an OPENTOFU_COST_ESTIMATE stage.
+// The stage estimates the change of the monthly cost by the planned changes from the prices in a price catalog file.
+type OpenTofuCostEstimateStageOptions struct {
+	// The path to the price catalog file relative to the application directory.
+	// Empty means priceCatalogFile in the plugin config.
+	PriceCatalogFile string `json:"priceCatalogFile,omitempty"`
+	// The maximum increase of the monthly cost of all stacks.
+	// The stage fails when the estimated increase exceeds this. Empty means no limit.
+	Budget *float64 `json:"budget,omitempty"`
+	// The maximum time the stage can take, including "tofu init".
+	// Empty means no timeout.
+	Timeout Duration `json:"timeout,omitempty"`
+	// The policy to retry "tofu plan" when it fails with a transient error.
+	Retry OpenTofuRetryOptions `json:"retry,omitempty"`
+}
+
+// OpenTofuTestStageOptions contains all configurable values for an OPENTOFU_TEST stage.
+type OpenTofuTestStageOptions struct {
+	// List of the test files to be executed, passed with the "-filter" flag.
+	// Empty means all test files are executed.
+	Filter []string `json:"filter,omitempty"`
+	// List of variables only for the tests, formatted by "key=value".
+	// They take precedence over the vars of the application.
+	Vars []string `json:"vars,omitempty"`
+	// The maximum time the stage can take, including "tofu init".
+	// Empty means no timeout.
+	Timeout Duration `json:"timeout,omitempty"`
+}
+
+// OpenTofuValidateStageOptions contains all configurable values for an OPENTOFU_VALIDATE stage.
+type OpenTofuValidateStageOptions struct {
+	// Fail the stage when there are files not formatted by "tofu fmt".
+	// They are reported as warnings by default.
+	FailOnFormatIssues bool `json:"failOnFormatIssues,omitempty"`
+	// Fail the stage when "tofu validate" reports warnings.
+	FailOnWarnings bool `json:"failOnWarnings,omitempty"`
+	// The maximum time the stage can take, including "tofu init".
+	// Empty means no timeout.
+	Timeout Duration `json:"timeout,omitempty"`
+}
+
+// OpenTofuRetryOptions contains the policy to retry a command failed with a transient error
+// such as API throttling or eventual consistency of the cloud provider.
+type OpenTofuRetryOptions struct {
+	// The maximum number of attempts including the first one.
+	// Empty or 1 means no retry. retryableErrors is required when this is greater than 1.
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+	// How long to wait before the first retry. It doubles for each following retry.
+	// Empty means 10s.
+	Backoff Duration `json:"backoff,omitempty"`
+	// List of regular expressions matched against the error messages of the failed command.
+	// The command is retried only when one of them matches, other errors fail immediately as hard failures.
+	// e.g. "ThrottlingException", "(?i)rate exceeded"
+	RetryableErrors []string `json:"retryableErrors,omitempty"`
 }
 
 // OpenTofuCommandFlags contains all additional flags that will be used while executing opentofu commands.
@@ -79,6 +739,14 @@ type OpenTofuCommandEnvs struct {
 }
 
 func (s *ApplicationConfigSpec) Validate() error {
-	// TODO: Validate ApplicationConfigSpec fields.
+	switch s.Engine {
+	case "", EngineOpenTofu, EngineTerraform:
+	default:
+		return fmt.Errorf("unsupported engine %q, must be one of %q or %q", s.Engine, EngineOpenTofu, EngineTerraform)
+	}
+	if err := validateStacks(s.Stacks); err != nil {
+		return err
+	}
+	// TODO: Validate other ApplicationConfigSpec fields.
 	return nil
 }
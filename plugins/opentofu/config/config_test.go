@@ -0,0 +1,280 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateStacks(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		name        string
+		stacks      []OpenTofuStack
+		expectedErr bool
+	}{
+		{
+			name: "valid",
+			stacks: []OpenTofuStack{
+				{Name: "network", Dir: "network"},
+				{Name: "data", Dir: "data", DependsOn: []string{"network"}},
+				{Name: "app", Dir: "app", DependsOn: []string{"network", "data"}},
+			},
+		},
+		{
+			name:        "missing name",
+			stacks:      []OpenTofuStack{{Dir: "network"}},
+			expectedErr: true,
+		},
+		{
+			name:        "duplicate name",
+			stacks:      []OpenTofuStack{{Name: "a", Dir: "a"}, {Name: "a", Dir: "b"}},
+			expectedErr: true,
+		},
+		{
+			name:        "dir outside the application",
+			stacks:      []OpenTofuStack{{Name: "a", Dir: "../a"}},
+			expectedErr: true,
+		},
+		{
+			name:        "unknown dependency",
+			stacks:      []OpenTofuStack{{Name: "a", Dir: "a", DependsOn: []string{"b"}}},
+			expectedErr: true,
+		},
+		{
+			name: "cycle",
+			stacks: []OpenTofuStack{
+				{Name: "a", Dir: "a", DependsOn: []string{"c"}},
+				{Name: "b", Dir: "b", DependsOn: []string{"a"}},
+				{Name: "c", Dir: "c", DependsOn: []string{"b"}},
+			},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			err := validateStacks(tc.stacks)
+			assert.Equal(t, tc.expectedErr, err != nil, err)
+		})
+	}
+}
+
+func TestEncryptionConfig_Validate(t *testing.T) {
+	t.Parallel()
+
+	pbkdf2 := EncryptionKeyProvider{Type: "pbkdf2", Name: "default", EncryptedPassphrase: "encrypted"}
+	aesGCM := EncryptionMethod{Type: "aes_gcm", Name: "default", KeyProvider: "default"}
+
+	testcases := []struct {
+		name        string
+		config      EncryptionConfig
+		expectedErr bool
+	}{
+		{
+			name: "valid with fallback",
+			config: EncryptionConfig{
+				KeyProviders: []EncryptionKeyProvider{pbkdf2},
+				Methods:      []EncryptionMethod{aesGCM, {Type: "unencrypted", Name: "migrate"}},
+				State:        &EncryptionTarget{Method: "default", Fallback: "migrate"},
+			},
+		},
+		{
+			name: "pbkdf2 without passphrase",
+			config: EncryptionConfig{
+				KeyProviders: []EncryptionKeyProvider{{Type: "pbkdf2", Name: "default"}},
+				Methods:      []EncryptionMethod{aesGCM},
+				State:        &EncryptionTarget{Method: "default"},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "external without command",
+			config: EncryptionConfig{
+				KeyProviders: []EncryptionKeyProvider{{Type: "external", Name: "default"}},
+				Methods:      []EncryptionMethod{aesGCM},
+				State:        &EncryptionTarget{Method: "default"},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "duplicated key provider",
+			config: EncryptionConfig{
+				KeyProviders: []EncryptionKeyProvider{pbkdf2, pbkdf2},
+				Methods:      []EncryptionMethod{aesGCM},
+				State:        &EncryptionTarget{Method: "default"},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "unknown key provider",
+			config: EncryptionConfig{
+				Methods: []EncryptionMethod{aesGCM},
+				State:   &EncryptionTarget{Method: "default"},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "unknown fallback",
+			config: EncryptionConfig{
+				KeyProviders: []EncryptionKeyProvider{pbkdf2},
+				Methods:      []EncryptionMethod{aesGCM},
+				Plan:         &EncryptionTarget{Method: "default", Fallback: "old"},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "neither state nor plan",
+			config: EncryptionConfig{
+				KeyProviders: []EncryptionKeyProvider{pbkdf2},
+				Methods:      []EncryptionMethod{aesGCM},
+			},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			err := tc.config.Validate()
+			assert.Equal(t, tc.expectedErr, err != nil, err)
+		})
+	}
+}
+
+func TestCredentialsConfig_Validate(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		name        string
+		config      CredentialsConfig
+		expectedErr bool
+	}{
+		{
+			name: "valid",
+			config: CredentialsConfig{
+				AWS:   &AWSCredentials{Profile: "deploy", RoleARN: "arn:aws:iam::123456789012:role/deploy", ExternalID: "pipecd"},
+				GCP:   &GCPCredentials{CredentialsFile: "/etc/gcp/credentials.json", ImpersonateServiceAccount: "deploy@project.iam.gserviceaccount.com"},
+				Azure: &AzureCredentials{ClientID: "client", TenantID: "tenant", OIDCTokenFile: "/var/run/secrets/azure/token"},
+			},
+		},
+		{
+			name:        "aws without profile and role",
+			config:      CredentialsConfig{AWS: &AWSCredentials{}},
+			expectedErr: true,
+		},
+		{
+			name:        "aws external id without role",
+			config:      CredentialsConfig{AWS: &AWSCredentials{Profile: "deploy", ExternalID: "pipecd"}},
+			expectedErr: true,
+		},
+		{
+			name:        "aws unknown credential source",
+			config:      CredentialsConfig{AWS: &AWSCredentials{RoleARN: "arn:aws:iam::123456789012:role/deploy", CredentialSource: "Unknown"}},
+			expectedErr: true,
+		},
+		{
+			name:        "aws credential source with profile",
+			config:      CredentialsConfig{AWS: &AWSCredentials{Profile: "deploy", RoleARN: "arn:aws:iam::123456789012:role/deploy", CredentialSource: "Environment"}},
+			expectedErr: true,
+		},
+		{
+			name:        "gcp file and encrypted credentials",
+			config:      CredentialsConfig{GCP: &GCPCredentials{CredentialsFile: "/etc/gcp/credentials.json", EncryptedCredentials: "encrypted"}},
+			expectedErr: true,
+		},
+		{
+			name:        "gcp empty",
+			config:      CredentialsConfig{GCP: &GCPCredentials{}},
+			expectedErr: true,
+		},
+		{
+			name:        "azure client secret without tenant",
+			config:      CredentialsConfig{Azure: &AzureCredentials{ClientID: "client", EncryptedClientSecret: "encrypted"}},
+			expectedErr: true,
+		},
+		{
+			name:        "azure multiple methods",
+			config:      CredentialsConfig{Azure: &AzureCredentials{ClientID: "client", TenantID: "tenant", OIDCTokenFile: "/token", UseManagedIdentity: true}},
+			expectedErr: true,
+		},
+		{
+			name:   "azure managed identity",
+			config: CredentialsConfig{Azure: &AzureCredentials{UseManagedIdentity: true}},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			err := tc.config.Validate()
+			assert.Equal(t, tc.expectedErr, err != nil, err)
+		})
+	}
+}
+
+func TestConfig_ValidateRegistryCredentials(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		name        string
+		credentials []RegistryCredential
+		expectedErr bool
+	}{
+		{
+			name: "valid",
+			credentials: []RegistryCredential{
+				{Host: "registry.example.com", EncryptedToken: "encrypted"},
+				{Host: "app.terraform.io", TokenFile: "/etc/tofu/token"},
+			},
+		},
+		{
+			name:        "url instead of host",
+			credentials: []RegistryCredential{{Host: "https://registry.example.com/", EncryptedToken: "encrypted"}},
+			expectedErr: true,
+		},
+		{
+			name: "duplicated host",
+			credentials: []RegistryCredential{
+				{Host: "registry.example.com", EncryptedToken: "encrypted"},
+				{Host: "Registry.example.com", TokenFile: "/etc/tofu/token"},
+			},
+			expectedErr: true,
+		},
+		{
+			name:        "no token",
+			credentials: []RegistryCredential{{Host: "registry.example.com"}},
+			expectedErr: true,
+		},
+		{
+			name:        "both tokens",
+			credentials: []RegistryCredential{{Host: "registry.example.com", EncryptedToken: "encrypted", TokenFile: "/etc/tofu/token"}},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := Config{RegistryCredentials: tc.credentials}
+			err := c.ValidateRegistryCredentials()
+			assert.Equal(t, tc.expectedErr, err != nil, err)
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDuration_UnmarshalJSON(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		name        string
+		input       string
+		expected    Duration
+		expectedErr bool
+	}{
+		{
+			name:     "string",
+			input:    `"1m30s"`,
+			expected: Duration(90 * time.Second),
+		},
+		{
+			name:     "number of nanoseconds",
+			input:    `1000000000`,
+			expected: Duration(time.Second),
+		},
+		{
+			name:        "invalid string",
+			input:       `"ten minutes"`,
+			expectedErr: true,
+		},
+		{
+			name:        "invalid type",
+			input:       `true`,
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var d Duration
+			err := json.Unmarshal([]byte(tc.input), &d)
+			assert.Equal(t, tc.expectedErr, err != nil)
+			assert.Equal(t, tc.expected, d)
+		})
+	}
+}
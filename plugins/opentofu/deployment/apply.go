@@ -17,35 +17,160 @@ package deployment
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	sdk "github.com/pipe-cd/piped-plugin-sdk-go"
 
 	"github.com/pipe-cd/community-plugins/plugins/opentofu/config"
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/provider"
 )
 
-func (p *Plugin) executeApplyStage(ctx context.Context, input *sdk.ExecuteStageInput[config.ApplicationConfigSpec], dts []*sdk.DeployTarget[config.DeployTargetConfig]) sdk.StageStatus {
+func (p *Plugin) executeApplyStage(ctx context.Context, cfg *config.Config, input *sdk.ExecuteStageInput[config.ApplicationConfigSpec], dts []*sdk.DeployTarget[config.DeployTargetConfig]) sdk.StageStatus {
 	lp := input.Client.LogPersister()
 	lp.Info("Starting OpenTofu apply stage")
 
-	cmd, err := initOpenTofuCommand(ctx, input.Client, input.Request.TargetDeploymentSource, dts[0])
-	if err != nil {
-		lp.Errorf("Failed to initialize OpenTofu command: %v", err)
-		return sdk.StageStatusFailure
-	}
-
 	var stageConfig config.OpenTofuApplyStageOptions
 	if err := json.Unmarshal(input.Request.StageConfig, &stageConfig); err != nil {
 		lp.Errorf("Failed to unmarshal stage config (%v)", err)
 		return sdk.StageStatusFailure
 	}
 
-	lp.Infof("Start executing apply.")
+	if err := stageConfig.Validate(); err != nil {
+		lp.Errorf("Invalid stage config (%v)", err)
+		return sdk.StageStatusFailure
+	}
 
-	if err := cmd.Apply(ctx, lp); err != nil {
-		lp.Errorf("Failed to Apply (%v)", err)
+	retry, err := newRetryPolicy(stageConfig.Retry)
+	if err != nil {
+		lp.Errorf("Invalid retry options (%v)", err)
 		return sdk.StageStatusFailure
 	}
 
-	lp.Success("Successfully applied changes")
+	stacks, pr, err := makeDeploymentStacks(lp, input.Request.TargetDeploymentSource, input.Request.Deployment)
+	if err != nil {
+		lp.Errorf("Invalid application config (%v)", err)
+		return sdk.StageStatusFailure
+	}
+
+	// Failing to record the applied plan doesn't fail the stage because the plan history is only for auditing.
+	history, err := newPlanHistory(cfg)
+	if err != nil {
+		lp.Infof("Skip recording the applied plan because the plan history is not available (%v)", err)
+		history = nil
+	}
+
+	ctx, cancel := withStageTimeout(ctx, stageConfig.Timeout)
+	defer cancel()
+
+	results := runStacks(ctx, lp, stacks, func(ctx context.Context, st stack, lp sdk.StageLogPersister) (string, error) {
+		cmd, cleanup, err := p.initOpenTofuCommand(ctx, input.Client, lp, cfg, input.Request.TargetDeploymentSource, dts[0], st)
+		if err != nil {
+			lp.Errorf("Failed to initialize OpenTofu command: %v", err)
+			return "", err
+		}
+		defer cleanup()
+
+		detail, err := applyStack(ctx, lp, cmd, retry, st.dir, stageConfig)
+		if err != nil {
+			return "", err
+		}
+		lp.Success("Successfully applied changes")
+		if pr != nil {
+			reportOutputs(ctx, lp, cmd, input.Request.TargetDeploymentSource.ApplicationConfig.Spec.PullRequestEnvironment.Outputs)
+		}
+
+		if history == nil {
+			return detail, nil
+		}
+		ok, err := history.markApplied(input.Request.Deployment.ApplicationID, input.Request.TargetDeploymentSource.CommitHash, st.name, time.Now())
+		switch {
+		case err != nil:
+			lp.Errorf("Failed to record the applied plan (%v)", err)
+		case !ok:
+			lp.Info("No stored plan was found to record as applied")
+		}
+		return detail, nil
+	})
+	if !stacksSucceeded(results) {
+		return sdk.StageStatusFailure
+	}
 	return sdk.StageStatusSuccess
 }
+
+// applyStack applies the changes of the stack following the options of the OPENTOFU_APPLY stage,
+// and returns a short description of how they were applied.
+// The given flags are passed to every apply, e.g. "-refresh-only" to apply only the changes to the state.
+func applyStack(ctx context.Context, lp sdk.StageLogPersister, cmd *provider.OpenTofu, retry *retryPolicy, dir string, opts config.OpenTofuApplyStageOptions, flags ...string) (string, error) {
+	if len(opts.Waves) > 0 {
+		if err := applyWaves(ctx, lp, cmd, retry, dir, opts.Waves, flags...); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("applied in %d waves", len(opts.Waves)), nil
+	}
+	lp.Infof("Start executing apply.")
+	if err := applyWithRetry(ctx, lp, cmd, retry, flags...); err != nil {
+		return "", err
+	}
+	return "applied", nil
+}
+
+// applyWithRetry executes "tofu apply" with the given flags following the retry policy.
+// It executes "tofu plan" again before each retry.
+func applyWithRetry(ctx context.Context, lp sdk.StageLogPersister, cmd *provider.OpenTofu, retry *retryPolicy, flags ...string) error {
+	err := retry.do(ctx, lp, "apply", func(attempt int) ([]provider.Diagnostic, error) {
+		if attempt > 1 {
+			// The previous attempt may have partially applied the changes, so show what is left.
+			lp.Info("Planning again before retrying apply")
+			planResult, err := cmd.Plan(ctx, lp, flags...)
+			if err != nil {
+				return planResult.Diagnostics, fmt.Errorf("failed to plan before retrying apply: %w", err)
+			}
+			if planResult.NoChanges() {
+				lp.Info("No changes left to apply")
+				return nil, nil
+			}
+		}
+		result, err := cmd.Apply(ctx, lp, flags...)
+		reportApplyResult(ctx, lp, result)
+		return result.Diagnostics, err
+	})
+	if err != nil {
+		if errors.Is(err, errGaveUp) {
+			lp.Errorf("Gave up applying (%v)", err)
+		} else {
+			lp.Errorf("Failed to Apply (%v)", err)
+		}
+	}
+	return err
+}
+
+// reportApplyResult writes the elapsed time of each applied resource to the log.
+// When the apply was interrupted, it also reports the resources which may be in an unknown state.
+func reportApplyResult(ctx context.Context, lp sdk.StageLogPersister, result provider.ApplyResult) {
+	if summary := result.Summary(); summary != "" {
+		lp.Infof("Elapsed time of the applied resources:\n%s", summary)
+	}
+
+	if ctx.Err() == nil {
+		return
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		lp.Error("The apply was interrupted because the stage timed out")
+	} else {
+		lp.Error("The apply was interrupted because the stage was cancelled")
+	}
+
+	unfinished := result.Unfinished()
+	if len(unfinished) == 0 {
+		lp.Info("No resource was being applied when the apply was interrupted")
+		return
+	}
+	var b strings.Builder
+	for _, res := range unfinished {
+		fmt.Fprintf(&b, "  - %s (%s, %s elapsed)\n", res.Address, res.Action, res.Elapsed)
+	}
+	lp.Errorf("The following resources may be in an unknown state. Please check them and the state lock before retrying:\n%s", b.String())
+}
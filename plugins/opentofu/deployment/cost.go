@@ -0,0 +1,168 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	sdk "github.com/pipe-cd/piped-plugin-sdk-go"
+
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/config"
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/provider"
+)
+
+func (p *Plugin) executeCostEstimateStage(ctx context.Context, cfg *config.Config, input *sdk.ExecuteStageInput[config.ApplicationConfigSpec], dts []*sdk.DeployTarget[config.DeployTargetConfig]) sdk.StageStatus {
+	lp := input.Client.LogPersister()
+
+	var stageConfig config.OpenTofuCostEstimateStageOptions
+	if err := json.Unmarshal(input.Request.StageConfig, &stageConfig); err != nil {
+		lp.Errorf("Failed to unmarshal stage config (%v)", err)
+		return sdk.StageStatusFailure
+	}
+
+	retry, err := newRetryPolicy(stageConfig.Retry)
+	if err != nil {
+		lp.Errorf("Invalid retry options (%v)", err)
+		return sdk.StageStatusFailure
+	}
+
+	catalog, err := loadPriceCatalog(cfg, input.Request.TargetDeploymentSource.ApplicationDirectory, stageConfig.PriceCatalogFile)
+	if err != nil {
+		lp.Errorf("Failed to load the price catalog (%v)", err)
+		return sdk.StageStatusFailure
+	}
+	lp.Infof("Using the price catalog of version %s", catalog.Version)
+
+	stacks, _, err := makeDeploymentStacks(lp, input.Request.TargetDeploymentSource, input.Request.Deployment)
+	if err != nil {
+		lp.Errorf("Invalid application config (%v)", err)
+		return sdk.StageStatusFailure
+	}
+
+	ctx, cancel := withStageTimeout(ctx, stageConfig.Timeout)
+	defer cancel()
+
+	var (
+		mu    sync.Mutex
+		total float64
+	)
+	results := runStacks(ctx, lp, stacks, func(ctx context.Context, st stack, lp sdk.StageLogPersister) (string, error) {
+		cmd, cleanup, err := p.initOpenTofuCommand(ctx, input.Client, lp, cfg, input.Request.TargetDeploymentSource, dts[0], st)
+		if err != nil {
+			return "", err
+		}
+		defer cleanup()
+
+		var planResult provider.PlanResult
+		err = retry.do(ctx, lp, "plan", func(int) ([]provider.Diagnostic, error) {
+			var err error
+			planResult, err = cmd.Plan(ctx, lp)
+			return planResult.Diagnostics, err
+		})
+		if err != nil {
+			if errors.Is(err, errGaveUp) {
+				lp.Errorf("Gave up planning (%v)", err)
+			} else {
+				lp.Errorf("Failed to plan (%v)", err)
+			}
+			return "", err
+		}
+
+		if planResult.NoChanges() {
+			lp.Info("No changes to estimate")
+			return "no changes", nil
+		}
+		if planResult.Plan == nil {
+			err := errors.New("the structured plan is not available")
+			lp.Errorf("Failed to estimate the cost (%v)", err)
+			return "", err
+		}
+
+		estimate := catalog.EstimateCost(planResult.Plan)
+		lp.Infof("Estimated monthly cost changes:\n%s", renderCostEstimate(estimate))
+
+		mu.Lock()
+		total += estimate.TotalDelta()
+		mu.Unlock()
+		return formatCost(estimate.TotalDelta(), catalog.Currency) + " per month", nil
+	})
+	if !stacksSucceeded(results) {
+		return sdk.StageStatusFailure
+	}
+
+	if budget := stageConfig.Budget; budget != nil && total > *budget {
+		lp.Errorf("The estimated monthly cost change %s exceeds the budget %s", formatCost(total, catalog.Currency), formatCost(*budget, catalog.Currency))
+		return sdk.StageStatusFailure
+	}
+	lp.Successf("The estimated monthly cost change is %s", formatCost(total, catalog.Currency))
+	return sdk.StageStatusSuccess
+}
+
+// loadPriceCatalog loads the price catalog from the file in the application directory,
+// or the one in the plugin config when the stage doesn't set it.
+func loadPriceCatalog(cfg *config.Config, appDir, path string) (*provider.PriceCatalog, error) {
+	if path != "" {
+		if !filepath.IsLocal(path) {
+			return nil, fmt.Errorf("priceCatalogFile %q must be a path inside the application directory", path)
+		}
+		return provider.LoadPriceCatalog(filepath.Join(appDir, path))
+	}
+	if cfg == nil || cfg.PriceCatalogFile == "" {
+		return nil, errors.New("priceCatalogFile must be set in either the stage config or the plugin config")
+	}
+	return provider.LoadPriceCatalog(cfg.PriceCatalogFile)
+}
+
+// renderCostEstimate renders the estimated costs of the resources as a table followed by the resources which aren't estimated.
+func renderCostEstimate(e provider.CostEstimate) string {
+	var buf bytes.Buffer
+	if len(e.Resources) > 0 {
+		tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "RESOURCE\tACTION\tBEFORE\tAFTER\tDELTA")
+		for _, r := range e.Resources {
+			fmt.Fprintf(tw, "%s\t%s\t%.2f\t%.2f\t%+.2f\n", r.Address, r.Action, r.Before, r.After, r.Delta())
+		}
+		fmt.Fprintf(tw, "TOTAL\t\t\t\t%+.2f\n", e.TotalDelta())
+		tw.Flush()
+	} else {
+		buf.WriteString("No changed resources are estimated\n")
+	}
+	if e.Currency != "" {
+		fmt.Fprintf(&buf, "The costs are in %s.\n", e.Currency)
+	}
+	if len(e.Unestimated) > 0 {
+		fmt.Fprintf(&buf, "Unable to estimate the following resources because their values are unknown until applied or not in the catalog:\n  %s\n", strings.Join(e.Unestimated, "\n  "))
+	}
+	if e.Unpriced > 0 {
+		fmt.Fprintf(&buf, "%d changed resource(s) are not estimated because their types are not in the catalog.\n", e.Unpriced)
+	}
+	return buf.String()
+}
+
+func formatCost(v float64, currency string) string {
+	s := fmt.Sprintf("%+.2f", v)
+	if currency != "" {
+		s += " " + currency
+	}
+	return s
+}
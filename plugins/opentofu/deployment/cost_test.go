@@ -0,0 +1,163 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	sdk "github.com/pipe-cd/piped-plugin-sdk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/config"
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/provider"
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/provider/providertest"
+)
+
+func TestRenderCostEstimate(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		name     string
+		estimate provider.CostEstimate
+		expected string
+	}{
+		{
+			name: "estimated resources",
+			estimate: provider.CostEstimate{
+				Currency: "USD",
+				Resources: []provider.ResourceCost{
+					{Address: "aws_instance.web", Action: provider.ChangeActionUpdate, Before: 7.5, After: 15},
+					{Address: "aws_nat_gateway.main", Action: provider.ChangeActionDelete, Before: 32.5},
+				},
+				Unestimated: []string{"aws_instance.batch", "aws_instance.worker"},
+				Unpriced:    2,
+			},
+			expected: `RESOURCE              ACTION  BEFORE  AFTER  DELTA
+aws_instance.web      update  7.50    15.00  +7.50
+aws_nat_gateway.main  delete  32.50   0.00   -32.50
+TOTAL                                        -25.00
+The costs are in USD.
+Unable to estimate the following resources because their values are unknown until applied or not in the catalog:
+  aws_instance.batch
+  aws_instance.worker
+2 changed resource(s) are not estimated because their types are not in the catalog.
+`,
+		},
+		{
+			name:     "nothing estimated",
+			estimate: provider.CostEstimate{Unpriced: 1},
+			expected: `No changed resources are estimated
+1 changed resource(s) are not estimated because their types are not in the catalog.
+`,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.expected, renderCostEstimate(tc.estimate))
+		})
+	}
+}
+
+func TestLoadPriceCatalog(t *testing.T) {
+	t.Parallel()
+
+	appDir := t.TempDir()
+	catalog := "version: v1\nresources:\n  - type: aws_eip\n    monthlyPrice: 3.6\n"
+	require.NoError(t, os.WriteFile(filepath.Join(appDir, "prices.yaml"), []byte(catalog), 0600))
+	pluginCatalog := filepath.Join(t.TempDir(), "prices.yaml")
+	require.NoError(t, os.WriteFile(pluginCatalog, []byte("version: v2\nresources: []\n"), 0600))
+
+	c, err := loadPriceCatalog(&config.Config{PriceCatalogFile: pluginCatalog}, appDir, "prices.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "v1", c.Version)
+
+	c, err = loadPriceCatalog(&config.Config{PriceCatalogFile: pluginCatalog}, appDir, "")
+	require.NoError(t, err)
+	assert.Equal(t, "v2", c.Version)
+
+	_, err = loadPriceCatalog(&config.Config{}, appDir, "")
+	assert.Error(t, err)
+
+	_, err = loadPriceCatalog(nil, appDir, "../prices.yaml")
+	assert.Error(t, err)
+}
+
+func TestExecuteStage_CostEstimate(t *testing.T) {
+	t.Parallel()
+
+	catalog := "version: v1\ncurrency: USD\nresources:\n  - type: aws_instance\n    attribute: instance_type\n    prices:\n      t3.micro: 7.5\n"
+
+	testcases := []struct {
+		name        string
+		stageConfig string
+		expected    sdk.StageStatus
+	}{
+		{
+			name:        "without budget",
+			stageConfig: `{"priceCatalogFile": "prices.yaml"}`,
+			expected:    sdk.StageStatusSuccess,
+		},
+		{
+			name:        "within budget",
+			stageConfig: `{"priceCatalogFile": "prices.yaml", "budget": 0}`,
+			expected:    sdk.StageStatusSuccess,
+		},
+		{
+			name:        "catalog not found",
+			stageConfig: `{"priceCatalogFile": "missing.yaml"}`,
+			expected:    sdk.StageStatusFailure,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := newStageHarness(t)
+			s.runner.
+				On("plan", recorded(t, "plan_changes.jsonl", 2)).
+				On("show", recorded(t, "plan_changes.json", 0))
+
+			input := s.input(t, stageCostEstimate, tc.stageConfig, "")
+			require.NoError(t, os.WriteFile(filepath.Join(input.Request.TargetDeploymentSource.ApplicationDirectory, "prices.yaml"), []byte(catalog), 0600))
+
+			resp, err := s.plugin.ExecuteStage(context.Background(), s.cfg, s.dts, input)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, resp.Status)
+		})
+	}
+
+	t.Run("over budget", func(t *testing.T) {
+		t.Parallel()
+
+		s := newStageHarness(t)
+		s.runner.
+			On("plan", providertest.Response{Stdout: `{"type": "change_summary", "changes": {"add": 1, "change": 0, "remove": 0, "operation": "plan"}}` + "\n", ExitCode: 2}).
+			On("show", providertest.Response{Stdout: `{"format_version": "1.2", "resource_changes": [{"address": "aws_instance.new", "mode": "managed", "type": "aws_instance", "change": {"actions": ["create"], "before": null, "after": {"instance_type": "t3.micro"}}}]}`})
+
+		input := s.input(t, stageCostEstimate, `{"priceCatalogFile": "prices.yaml", "budget": 5}`, "")
+		require.NoError(t, os.WriteFile(filepath.Join(input.Request.TargetDeploymentSource.ApplicationDirectory, "prices.yaml"), []byte(catalog), 0600))
+
+		resp, err := s.plugin.ExecuteStage(context.Background(), s.cfg, s.dts, input)
+		require.NoError(t, err)
+		assert.Equal(t, sdk.StageStatusFailure, resp.Status)
+	})
+}
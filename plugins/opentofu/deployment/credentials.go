@@ -0,0 +1,205 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/config"
+)
+
+const (
+	// awsAssumeRoleProfile is the name of the profile generated to assume the role.
+	awsAssumeRoleProfile = "pipecd-assume-role"
+
+	awsConfigFileName      = "aws-config"
+	gcpCredentialsFileName = "gcp-credentials.json"
+)
+
+// awsAssumeRoleProfileRegex matches the section header of the generated profile in a shared config file.
+var awsAssumeRoleProfileRegex = regexp.MustCompile(`(?m)^\s*\[\s*profile\s+` + regexp.QuoteMeta(awsAssumeRoleProfile) + `\s*\]`)
+
+// makeCredentialEnvs returns the environment variables which pass the credentials to the providers and backends.
+// The files referred by them are written to the given directory, which must be removed after the stage.
+// The decrypted secrets are also returned to mask them in the logs.
+func makeCredentialEnvs(cfg *config.Config, c *config.CredentialsConfig, dir string) (envs []string, secrets []string, err error) {
+	if err := c.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	var d decrypter
+	decrypt := func(encryptedText string) (string, error) {
+		if d == nil {
+			var err error
+			if d, err = newSecretDecrypter(cfg); err != nil {
+				return "", err
+			}
+		}
+		return d.Decrypt(encryptedText)
+	}
+
+	if aws := c.AWS; aws != nil {
+		profile := aws.Profile
+		if aws.RoleARN != "" {
+			path, err := writeAWSConfig(dir, awsConfigFile(), aws)
+			if err != nil {
+				return nil, nil, err
+			}
+			envs = append(envs, "AWS_CONFIG_FILE="+path, "AWS_SDK_LOAD_CONFIG=1")
+			profile = awsAssumeRoleProfile
+		}
+		envs = append(envs, "AWS_PROFILE="+profile)
+	}
+
+	if gcp := c.GCP; gcp != nil {
+		path := gcp.CredentialsFile
+		if gcp.EncryptedCredentials != "" {
+			credentials, err := decrypt(gcp.EncryptedCredentials)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to decrypt the gcp credentials: %w", err)
+			}
+			path = filepath.Join(dir, gcpCredentialsFileName)
+			if err := os.WriteFile(path, []byte(credentials), 0600); err != nil {
+				return nil, nil, fmt.Errorf("failed to write the gcp credentials file: %w", err)
+			}
+			secrets = append(secrets, credentials)
+			secrets = append(secrets, gcpCredentialSecrets(credentials)...)
+		}
+		if path != "" {
+			envs = append(envs, "GOOGLE_APPLICATION_CREDENTIALS="+path)
+		}
+		if gcp.ImpersonateServiceAccount != "" {
+			envs = append(envs, "GOOGLE_IMPERSONATE_SERVICE_ACCOUNT="+gcp.ImpersonateServiceAccount)
+		}
+	}
+
+	if az := c.Azure; az != nil {
+		for _, e := range []struct{ key, value string }{
+			{"ARM_CLIENT_ID", az.ClientID},
+			{"ARM_TENANT_ID", az.TenantID},
+			{"ARM_SUBSCRIPTION_ID", az.SubscriptionID},
+		} {
+			if e.value != "" {
+				envs = append(envs, e.key+"="+e.value)
+			}
+		}
+		switch {
+		case az.EncryptedClientSecret != "":
+			secret, err := decrypt(az.EncryptedClientSecret)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to decrypt the azure client secret: %w", err)
+			}
+			envs = append(envs, "ARM_CLIENT_SECRET="+secret)
+			secrets = append(secrets, secret)
+		case az.OIDCTokenFile != "":
+			envs = append(envs, "ARM_USE_OIDC=true", "ARM_OIDC_TOKEN_FILE_PATH="+az.OIDCTokenFile)
+		case az.UseManagedIdentity:
+			envs = append(envs, "ARM_USE_MSI=true")
+		}
+	}
+
+	return envs, secrets, nil
+}
+
+// awsConfigFile returns the path to the shared config file used by the AWS SDK on the host running piped.
+func awsConfigFile() string {
+	if path := os.Getenv("AWS_CONFIG_FILE"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".aws", "config")
+}
+
+// writeAWSConfig writes a shared config file with the profile assuming the role to the given directory.
+// The profiles in the base config file are copied so that the role can be assumed with one of them.
+// It fails when the base config file already has the profile with the same name, so that the profile is never defined twice.
+func writeAWSConfig(dir, base string, c *config.AWSCredentials) (string, error) {
+	if c.Profile == awsAssumeRoleProfile {
+		return "", fmt.Errorf("profile %q is reserved for assuming the role, use another name", awsAssumeRoleProfile)
+	}
+
+	var b strings.Builder
+	if base != "" {
+		data, err := os.ReadFile(base)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("failed to read the aws config file: %w", err)
+		}
+		if awsAssumeRoleProfileRegex.Match(data) {
+			return "", fmt.Errorf("the aws config file %s already has profile %q which is reserved for assuming the role, rename it", base, awsAssumeRoleProfile)
+		}
+		if len(data) > 0 {
+			b.Write(data)
+			b.WriteString("\n")
+		}
+	}
+
+	fmt.Fprintf(&b, "[profile %s]\n", awsAssumeRoleProfile)
+	fmt.Fprintf(&b, "role_arn = %s\n", c.RoleARN)
+	if c.Profile != "" {
+		fmt.Fprintf(&b, "source_profile = %s\n", c.Profile)
+	} else {
+		fmt.Fprintf(&b, "credential_source = %s\n", cmp.Or(c.CredentialSource, "Environment"))
+	}
+	if c.RoleSessionName != "" {
+		fmt.Fprintf(&b, "role_session_name = %s\n", c.RoleSessionName)
+	}
+	if c.ExternalID != "" {
+		fmt.Fprintf(&b, "external_id = %s\n", c.ExternalID)
+	}
+
+	path := filepath.Join(dir, awsConfigFileName)
+	if err := os.WriteFile(path, []byte(b.String()), 0600); err != nil {
+		return "", fmt.Errorf("failed to write the aws config file: %w", err)
+	}
+	return path, nil
+}
+
+// gcpCredentialSecrets returns the secret values in the service account key,
+// because the errors of OpenTofu and the providers may show them without the rest of the key.
+// The private key is also returned as escaped in JSON, as it appears in the key file.
+func gcpCredentialSecrets(credentials string) []string {
+	var key struct {
+		PrivateKey   string `json:"private_key"`
+		PrivateKeyID string `json:"private_key_id"`
+	}
+	if err := json.Unmarshal([]byte(credentials), &key); err != nil {
+		return nil
+	}
+
+	var secrets []string
+	if key.PrivateKey != "" {
+		secrets = append(secrets, key.PrivateKey)
+		if escaped, err := json.Marshal(key.PrivateKey); err == nil {
+			if escaped := strings.Trim(string(escaped), `"`); escaped != key.PrivateKey {
+				secrets = append(secrets, escaped)
+			}
+		}
+	}
+	if key.PrivateKeyID != "" {
+		secrets = append(secrets, key.PrivateKeyID)
+	}
+	return secrets
+}
@@ -0,0 +1,346 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	sdk "github.com/pipe-cd/piped-plugin-sdk-go"
+
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/config"
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/provider"
+)
+
+const (
+	planHistoryRenderedFile = "plan.txt"
+	planHistoryJSONFile     = "plan.json"
+	planHistorySummaryFile  = "summary.json"
+
+	// actionImport is recorded for the resources which are only imported.
+	actionImport = "import"
+
+	defaultPlanHistoryRetention = 20
+)
+
+// planHistory stores the plan of each deployment in the directory laid out as "<application ID>/<commit hash>[/stacks/<stack name>]".
+type planHistory struct {
+	dir string
+	// The number of the latest commits whose plans are kept for each application.
+	retention int
+}
+
+func newPlanHistory(cfg *config.Config) (*planHistory, error) {
+	retention := defaultPlanHistoryRetention
+	if cfg != nil && cfg.PlanHistoryRetention > 0 {
+		retention = cfg.PlanHistoryRetention
+	}
+	if cfg != nil && cfg.PlanHistoryDir != "" {
+		return &planHistory{dir: cfg.PlanHistoryDir, retention: retention}, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine the plan history directory, set planHistoryDir in the plugin config: %w", err)
+	}
+	return &planHistory{dir: filepath.Join(dir, "pipecd-opentofu", "plans"), retention: retention}, nil
+}
+
+// planRecord is the summary of a plan stored as "summary.json".
+type planRecord struct {
+	ApplicationID string     `json:"applicationId"`
+	DeploymentID  string     `json:"deploymentId"`
+	CommitHash    string     `json:"commitHash"`
+	Stack         string     `json:"stack,omitempty"`
+	PlannedAt     time.Time  `json:"plannedAt"`
+	AppliedAt     *time.Time `json:"appliedAt,omitempty"`
+	Imports       int        `json:"imports"`
+	Adds          int        `json:"adds"`
+	Changes       int        `json:"changes"`
+	Destroys      int        `json:"destroys"`
+	// The planned action for each resource address, such as "create" and "replace".
+	// This is empty when the structured plan is not available.
+	Resources map[string]string `json:"resources,omitempty"`
+}
+
+func newPlanRecord(d sdk.Deployment, commitHash, stackName string, r provider.PlanResult, now time.Time) planRecord {
+	rec := planRecord{
+		ApplicationID: d.ApplicationID,
+		DeploymentID:  d.ID,
+		CommitHash:    commitHash,
+		Stack:         stackName,
+		PlannedAt:     now,
+		Imports:       r.Imports,
+		Adds:          r.Adds,
+		Changes:       r.Changes,
+		Destroys:      r.Destroys,
+	}
+	if r.Plan == nil {
+		return rec
+	}
+	for _, rc := range r.Plan.ResourceChanges {
+		action := string(rc.Change.Action())
+		if rc.Change.Action() == provider.ChangeActionNoop {
+			if rc.Change.Importing == nil {
+				continue
+			}
+			action = actionImport
+		}
+		if rec.Resources == nil {
+			rec.Resources = make(map[string]string)
+		}
+		rec.Resources[rc.Address] = action
+	}
+	return rec
+}
+
+func (h *planHistory) recordDir(appID, commitHash, stackName string) string {
+	dir := filepath.Join(h.dir, appID, commitHash)
+	if stackName != "" {
+		dir = filepath.Join(dir, "stacks", url.PathEscape(stackName))
+	}
+	return dir
+}
+
+// save stores the rendered plan, the structured plan whose sensitive values are masked, and the summary.
+// It overwrites the plan stored for the same commit before.
+func (h *planHistory) save(rec planRecord, rendered string, plan *provider.Plan) (string, error) {
+	dir := h.recordDir(rec.ApplicationID, rec.CommitHash, rec.Stack)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, planHistoryRenderedFile), []byte(rendered), 0600); err != nil {
+		return "", err
+	}
+	if plan != nil {
+		data, err := json.MarshalIndent(plan.MaskSensitive(), "", "  ")
+		if err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(filepath.Join(dir, planHistoryJSONFile), data, 0600); err != nil {
+			return "", err
+		}
+	}
+	return dir, writeRecord(filepath.Join(dir, planHistorySummaryFile), rec)
+}
+
+// prune deletes the plans of the application except the ones of the latest commits within the retention.
+// The commits are ordered by the latest time one of their stacks was planned, and the given commit is always kept.
+func (h *planHistory) prune(appID, keep string) error {
+	entries, err := os.ReadDir(filepath.Join(h.dir, appID))
+	if err != nil {
+		return err
+	}
+
+	type commit struct {
+		hash      string
+		plannedAt time.Time
+	}
+	var commits []commit
+	for _, e := range entries {
+		if !e.IsDir() || e.Name() == keep {
+			continue
+		}
+		plannedAt, err := h.lastPlannedAt(appID, e.Name())
+		if errors.Is(err, fs.ErrNotExist) {
+			// Deleted by another stack pruning at the same time.
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		commits = append(commits, commit{hash: e.Name(), plannedAt: plannedAt})
+	}
+	// The kept commit takes one of the slots.
+	if len(commits) < h.retention {
+		return nil
+	}
+	slices.SortFunc(commits, func(a, b commit) int { return b.plannedAt.Compare(a.plannedAt) })
+	for _, c := range commits[h.retention-1:] {
+		if err := os.RemoveAll(filepath.Join(h.dir, appID, c.hash)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lastPlannedAt returns the latest time the application or one of its stacks was planned at the given commit.
+// It returns the zero time when no readable summary is found, so that incomplete or broken records are deleted first.
+func (h *planHistory) lastPlannedAt(appID, commitHash string) (time.Time, error) {
+	var last time.Time
+	err := filepath.WalkDir(filepath.Join(h.dir, appID, commitHash), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() != planHistorySummaryFile {
+			return nil
+		}
+		if rec, err := readRecord(path); err == nil && rec.PlannedAt.After(last) {
+			last = rec.PlannedAt
+		}
+		return nil
+	})
+	return last, err
+}
+
+// markApplied records that the plan of the given commit was applied successfully.
+// It returns false when the plan was not stored, e.g. the pipeline has no OPENTOFU_PLAN stage.
+func (h *planHistory) markApplied(appID, commitHash, stackName string, now time.Time) (bool, error) {
+	path := filepath.Join(h.recordDir(appID, commitHash, stackName), planHistorySummaryFile)
+	rec, err := readRecord(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	rec.AppliedAt = &now
+	return true, writeRecord(path, rec)
+}
+
+// applied returns the plans of the application and stack which were applied successfully, from the oldest to the latest.
+func (h *planHistory) applied(appID, stackName string) ([]planRecord, error) {
+	entries, err := os.ReadDir(filepath.Join(h.dir, appID))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var records []planRecord
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		rec, err := readRecord(filepath.Join(h.recordDir(appID, e.Name(), stackName), planHistorySummaryFile))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if rec.AppliedAt != nil {
+			records = append(records, rec)
+		}
+	}
+	slices.SortFunc(records, func(a, b planRecord) int { return a.AppliedAt.Compare(*b.AppliedAt) })
+	return records, nil
+}
+
+func readRecord(path string) (planRecord, error) {
+	var rec planRecord
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rec, err
+	}
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return rec, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return rec, nil
+}
+
+func writeRecord(path string, rec planRecord) error {
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// comparePlans describes how the current plan differs from the last applied one,
+// and how many times each resource has been changed the same way including the current plan.
+// The applied records must be sorted from the oldest to the latest.
+func comparePlans(current planRecord, applied []planRecord) string {
+	applied = slices.DeleteFunc(slices.Clone(applied), func(r planRecord) bool { return r.CommitHash == current.CommitHash })
+	if len(applied) == 0 {
+		return "No plan applied successfully before was found to compare with"
+	}
+	last := applied[len(applied)-1]
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Compared with the plan of commit %s applied by deployment %s at %s:\n", last.CommitHash, last.DeploymentID, last.AppliedAt.Format(time.RFC3339))
+	if len(current.Resources) == 0 {
+		b.WriteString("  This plan changes no resources\n")
+	}
+	for _, addr := range slices.Sorted(maps.Keys(current.Resources)) {
+		action := current.Resources[addr]
+		fmt.Fprintf(&b, "  %s: %s", addr, action)
+		switch lastAction, ok := last.Resources[addr]; {
+		case !ok:
+			b.WriteString(", not changed by the last deployment")
+		case lastAction == action:
+			b.WriteString(", the same as the last deployment")
+		default:
+			fmt.Fprintf(&b, ", %s by the last deployment", pastTense(lastAction))
+		}
+		times := 1
+		for _, r := range applied {
+			if r.Resources[addr] == action {
+				times++
+			}
+		}
+		if times > 1 {
+			fmt.Fprintf(&b, ". This is the %s time it has been %s", ordinal(times), pastTense(action))
+		}
+		b.WriteString("\n")
+	}
+
+	var dropped []string
+	for _, addr := range slices.Sorted(maps.Keys(last.Resources)) {
+		if _, ok := current.Resources[addr]; !ok {
+			dropped = append(dropped, fmt.Sprintf("  %s: %s\n", addr, last.Resources[addr]))
+		}
+	}
+	if len(dropped) > 0 {
+		b.WriteString("Changed by the last deployment but not by this plan:\n")
+		b.WriteString(strings.Join(dropped, ""))
+	}
+	return b.String()
+}
+
+func ordinal(n int) string {
+	suffix := "th"
+	switch n % 10 {
+	case 1:
+		suffix = "st"
+	case 2:
+		suffix = "nd"
+	case 3:
+		suffix = "rd"
+	}
+	if n%100 >= 11 && n%100 <= 13 {
+		suffix = "th"
+	}
+	return fmt.Sprintf("%d%s", n, suffix)
+}
+
+func pastTense(action string) string {
+	switch action {
+	case string(provider.ChangeActionRead):
+		return "read"
+	case string(provider.ChangeActionForget):
+		return "forgotten"
+	}
+	return strings.TrimSuffix(action, "e") + "ed"
+}
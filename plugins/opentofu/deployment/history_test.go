@@ -0,0 +1,233 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	sdk "github.com/pipe-cd/piped-plugin-sdk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/config"
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/provider"
+)
+
+func TestNewPlanRecord(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	result := provider.PlanResult{
+		Adds:     1,
+		Destroys: 1,
+		Imports:  1,
+		Plan: &provider.Plan{
+			ResourceChanges: []provider.ResourceChange{
+				{Address: "aws_instance.web", Change: provider.Change{Actions: []string{"delete", "create"}}},
+				{Address: "aws_s3_bucket.logs", Change: provider.Change{Actions: []string{"no-op"}}},
+				{Address: "aws_iam_role.this", Change: provider.Change{Actions: []string{"no-op"}, Importing: &provider.Importing{ID: "role"}}},
+			},
+		},
+	}
+
+	rec := newPlanRecord(sdk.Deployment{ID: "deployment-1", ApplicationID: "app-1"}, "abc123", "network", result, now)
+	assert.Equal(t, planRecord{
+		ApplicationID: "app-1",
+		DeploymentID:  "deployment-1",
+		CommitHash:    "abc123",
+		Stack:         "network",
+		PlannedAt:     now,
+		Adds:          1,
+		Destroys:      1,
+		Imports:       1,
+		Resources: map[string]string{
+			"aws_instance.web":  "replace",
+			"aws_iam_role.this": "import",
+		},
+	}, rec)
+}
+
+func TestPlanHistory(t *testing.T) {
+	t.Parallel()
+
+	h, err := newPlanHistory(&config.Config{PlanHistoryDir: t.TempDir()})
+	require.NoError(t, err)
+
+	base := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	plan := &provider.Plan{
+		ResourceChanges: []provider.ResourceChange{
+			{
+				Address: "aws_db_instance.main",
+				Change: provider.Change{
+					Actions:        []string{"update"},
+					Before:         map[string]any{"password": "old"},
+					After:          map[string]any{"password": "new"},
+					AfterSensitive: map[string]any{"password": true},
+				},
+			},
+		},
+	}
+	for i, commit := range []string{"commit-1", "commit-2", "commit-3"} {
+		rec := planRecord{ApplicationID: "app-1", DeploymentID: "deployment-" + commit, CommitHash: commit, PlannedAt: base.Add(time.Duration(i) * time.Hour)}
+		dir, err := h.save(rec, "rendered "+commit, plan)
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(h.dir, "app-1", commit), dir)
+	}
+
+	data, err := os.ReadFile(filepath.Join(h.dir, "app-1", "commit-1", planHistoryJSONFile))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), `"new"`)
+	data, err = os.ReadFile(filepath.Join(h.dir, "app-1", "commit-1", planHistoryRenderedFile))
+	require.NoError(t, err)
+	assert.Equal(t, "rendered commit-1", string(data))
+
+	// commit-2 is applied after commit-3, e.g. by a rollback.
+	for _, applied := range []struct {
+		commit string
+		at     time.Time
+	}{
+		{"commit-1", base.Add(10 * time.Hour)},
+		{"commit-3", base.Add(11 * time.Hour)},
+		{"commit-2", base.Add(12 * time.Hour)},
+	} {
+		ok, err := h.markApplied("app-1", applied.commit, "", applied.at)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+	ok, err := h.markApplied("app-1", "unknown", "", base)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	records, err := h.applied("app-1", "")
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, "commit-1", records[0].CommitHash)
+	assert.Equal(t, "commit-3", records[1].CommitHash)
+	assert.Equal(t, "commit-2", records[2].CommitHash)
+
+	// The records of a named stack are stored separately.
+	records, err = h.applied("app-1", "network")
+	require.NoError(t, err)
+	assert.Empty(t, records)
+
+	records, err = h.applied("unknown-app", "")
+	require.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+func TestPlanHistory_Prune(t *testing.T) {
+	t.Parallel()
+
+	h, err := newPlanHistory(&config.Config{PlanHistoryDir: t.TempDir(), PlanHistoryRetention: 3})
+	require.NoError(t, err)
+
+	base := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	save := func(commit, stack string, plannedAt time.Time) {
+		t.Helper()
+		_, err := h.save(planRecord{ApplicationID: "app-1", CommitHash: commit, Stack: stack, PlannedAt: plannedAt}, "", nil)
+		require.NoError(t, err)
+	}
+	save("commit-1", "network", base)
+	save("commit-2", "", base.Add(1*time.Hour))
+	save("commit-3", "", base.Add(2*time.Hour))
+	// commit-1 is planned again for another stack, so it's newer than commit-2.
+	save("commit-1", "app", base.Add(3*time.Hour))
+	_, err = h.save(planRecord{ApplicationID: "app-2", CommitHash: "commit-1", PlannedAt: base}, "", nil)
+	require.NoError(t, err)
+	// A broken record is deleted first.
+	require.NoError(t, os.MkdirAll(filepath.Join(h.dir, "app-1", "broken"), 0700))
+
+	// commit-4 is planned earlier than the others because of a clock skew, but it's kept as the current one.
+	save("commit-4", "", base.Add(-time.Hour))
+	require.NoError(t, h.prune("app-1", "commit-4"))
+
+	entries, err := os.ReadDir(filepath.Join(h.dir, "app-1"))
+	require.NoError(t, err)
+	var commits []string
+	for _, e := range entries {
+		commits = append(commits, e.Name())
+	}
+	assert.ElementsMatch(t, []string{"commit-1", "commit-3", "commit-4"}, commits)
+
+	// The other applications are not affected.
+	_, err = os.Stat(filepath.Join(h.dir, "app-2", "commit-1"))
+	assert.NoError(t, err)
+}
+
+func TestComparePlans(t *testing.T) {
+	t.Parallel()
+
+	at := func(h int) *time.Time {
+		t := time.Date(2025, 6, 1, h, 0, 0, 0, time.UTC)
+		return &t
+	}
+	applied := []planRecord{
+		{CommitHash: "commit-1", DeploymentID: "d1", AppliedAt: at(1), Resources: map[string]string{"aws_instance.web": "replace"}},
+		{CommitHash: "commit-2", DeploymentID: "d2", AppliedAt: at(2), Resources: map[string]string{"aws_instance.web": "replace", "aws_s3_bucket.logs": "update", "aws_iam_role.this": "create"}},
+	}
+
+	testcases := []struct {
+		name     string
+		current  planRecord
+		applied  []planRecord
+		expected string
+	}{
+		{
+			name:     "no history",
+			current:  planRecord{CommitHash: "commit-3"},
+			expected: "No plan applied successfully before was found to compare with",
+		},
+		{
+			name:     "only the same commit was applied",
+			current:  planRecord{CommitHash: "commit-1"},
+			applied:  applied[:1],
+			expected: "No plan applied successfully before was found to compare with",
+		},
+		{
+			name: "changes compared with the history",
+			current: planRecord{CommitHash: "commit-3", Resources: map[string]string{
+				"aws_instance.web":  "replace",
+				"aws_iam_role.this": "update",
+				"aws_sqs_queue.new": "create",
+			}},
+			applied: applied,
+			expected: `Compared with the plan of commit commit-2 applied by deployment d2 at 2025-06-01T02:00:00Z:
+  aws_iam_role.this: update, created by the last deployment
+  aws_instance.web: replace, the same as the last deployment. This is the 3rd time it has been replaced
+  aws_sqs_queue.new: create, not changed by the last deployment
+Changed by the last deployment but not by this plan:
+  aws_s3_bucket.logs: update
+`,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.expected, comparePlans(tc.current, tc.applied))
+		})
+	}
+}
+
+func TestOrdinal(t *testing.T) {
+	t.Parallel()
+
+	for n, expected := range map[int]string{1: "1st", 2: "2nd", 3: "3rd", 4: "4th", 11: "11th", 12: "12th", 13: "13th", 21: "21st", 112: "112th"} {
+		assert.Equal(t, expected, ordinal(n))
+	}
+}
@@ -17,6 +17,14 @@ package deployment
 import (
 	"context"
 	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/pipe-cd/community-plugins/plugins/opentofu/config"
 	"github.com/pipe-cd/community-plugins/plugins/opentofu/provider"
@@ -25,43 +33,410 @@ import (
 	sdk "github.com/pipe-cd/piped-plugin-sdk-go"
 )
 
-func initOpenTofuCommand(ctx context.Context, client *sdk.Client, ds sdk.DeploymentSource[config.ApplicationConfigSpec], dt *sdk.DeployTarget[config.DeployTargetConfig]) (*provider.OpenTofu, error) {
+const (
+	gitCredentialsFileName = "git-credentials"
+	gitConfigCountEnv      = "GIT_CONFIG_COUNT"
+)
+
+// initOpenTofuCommand prepares an OpenTofu command for the given stack of the deployment source and deploy target, and runs "tofu init" with it.
+// The returned cleanup function must be called after the stage to remove the files generated for the command.
+func (p *Plugin) initOpenTofuCommand(ctx context.Context, client *sdk.Client, lp sdk.StageLogPersister, cfg *config.Config, ds sdk.DeploymentSource[config.ApplicationConfigSpec], dt *sdk.DeployTarget[config.DeployTargetConfig], st stack) (cmd *provider.OpenTofu, cleanup func(), err error) {
+	cmd, cleanup, err = p.newOpenTofuCommand(ctx, client, lp, cfg, ds, dt, st)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err != nil {
+			cleanup()
+		}
+	}()
+
+	if err := cmd.Init(ctx, lp); err != nil {
+		lp.Errorf("Failed to execute 'tofu init' (%v)", err)
+		return nil, nil, err
+	}
+
+	if ok := selectWorkspace(ctx, cmd, st.workspace, st.createWorkspace, lp); !ok {
+		return nil, nil, errors.New("failed to select workspace")
+	}
+
+	return cmd, cleanup, nil
+}
+
+// newOpenTofuCommand prepares an OpenTofu command for the given stack of the deployment source and deploy target without initializing the working directory.
+// The returned cleanup function must be called after the stage to remove the files generated for the command.
+func (p *Plugin) newOpenTofuCommand(ctx context.Context, client *sdk.Client, lp sdk.StageLogPersister, cfg *config.Config, ds sdk.DeploymentSource[config.ApplicationConfigSpec], dt *sdk.DeployTarget[config.DeployTargetConfig], st stack) (cmd *provider.OpenTofu, cleanup func(), err error) {
 	var (
 		appSpec = ds.ApplicationConfig.Spec
 		flags   = appSpec.CommandFlags
 		envs    = appSpec.CommandEnvs
-		lp      = client.LogPersister()
 	)
-	tr := toolregistry.NewRegistry(client.ToolRegistry())
-	opentofuPath, err := tr.OpenTofu(ctx, appSpec.OpenTofuVersion)
+	if err := appSpec.Validate(); err != nil {
+		lp.Errorf("Invalid application config (%v)", err)
+		return nil, nil, err
+	}
+
+	engine := provider.EngineOpenTofu
+	if appSpec.Engine == config.EngineTerraform {
+		engine = provider.EngineTerraform
+	}
+
+	execPath := engine.Command()
+	if p.runner == nil {
+		execPath, err = installEngine(ctx, toolregistry.NewRegistry(client.ToolRegistry()), engine, appSpec)
+		if err != nil {
+			lp.Errorf("Failed to find %s (%v)", engine, err)
+			return nil, nil, err
+		}
+	}
+
+	tmpDir, err := os.MkdirTemp("", "opentofu-")
 	if err != nil {
-		lp.Errorf("Failed to find opentofu (%v)", err)
-		return nil, err
+		lp.Errorf("Failed to create a temporary directory (%v)", err)
+		return nil, nil, err
+	}
+	cleanup = func() { os.RemoveAll(tmpDir) }
+	defer func() {
+		if err != nil {
+			cleanup()
+		}
+	}()
+
+	dtVars := dt.Config.Vars
+	var secrets []string
+	if len(dt.Config.EncryptedVars) > 0 {
+		d, err := newSecretDecrypter(cfg)
+		if err != nil {
+			lp.Errorf("Failed to prepare decrypting the encrypted vars (%v)", err)
+			return nil, nil, err
+		}
+		encryptedVars, decrypted, err := decryptVars(d, dt.Config.EncryptedVars)
+		if err != nil {
+			lp.Errorf("Failed to decrypt the encrypted vars (%v)", err)
+			return nil, nil, err
+		}
+		dtVars = append(slices.Clone(dtVars), encryptedVars...)
+		secrets = append(secrets, decrypted...)
 	}
 
-	cmd := provider.NewOpenTofu(
-		opentofuPath,
-		ds.ApplicationDirectory,
-		provider.WithVars(mergeVars(dt.Config.Vars, appSpec.Vars)),
-		provider.WithVarFiles(appSpec.VarFiles),
+	vars, variables := resolveVariables(dtVars, dt.Config.Variables, append(slices.Clone(appSpec.Vars), st.vars...), appSpec.Variables)
+	if err := validateVars(vars); err != nil {
+		lp.Errorf("Invalid vars (%v)", err)
+		return nil, nil, err
+	}
+
+	opts := []provider.Option{
+		provider.WithEngine(engine),
+		provider.WithJSONOutput(),
+		provider.WithSecrets(secrets),
+		provider.WithVarFiles(append(slices.Clone(appSpec.VarFiles), st.varFiles...)),
 		provider.WithAdditionalFlags(flags.Shared, flags.Init, flags.Plan, flags.Apply),
 		provider.WithAdditionalEnvs(envs.Shared, envs.Init, envs.Plan, envs.Apply),
-	)
+	}
+	if len(vars) > 0 || len(variables) > 0 {
+		// The vars are written to a file instead of being passed as "-var" flags not to expose their values in the logged command line.
+		path, err := provider.WriteVarFile(tmpDir, st.dir, vars, variables)
+		if err != nil {
+			lp.Errorf("Failed to write the vars file (%v)", err)
+			return nil, nil, err
+		}
+		opts = append(opts, provider.WithVarFile(path))
+	}
+	if p.runner != nil {
+		opts = append(opts, provider.WithRunner(p.runner))
+	}
+	if appSpec.CancelGracePeriod > 0 {
+		opts = append(opts, provider.WithGracePeriod(appSpec.CancelGracePeriod.Duration()))
+	}
+
+	cliConfig, tokens, err := makeCLIConfig(cfg, &dt.Config)
+	if err != nil {
+		lp.Errorf("Invalid OpenTofu CLI configuration (%v)", err)
+		return nil, nil, err
+	}
+	opts = append(opts, provider.WithSecrets(tokens))
+	if !cliConfig.IsEmpty() {
+		baseFile, err := hostCLIConfigFile(engine, envs)
+		if err != nil {
+			lp.Errorf("Invalid command envs (%v)", err)
+			return nil, nil, err
+		}
+		path, err := cliConfig.WriteFile(tmpDir, baseFile)
+		if err != nil {
+			lp.Errorf("Failed to write the OpenTofu CLI configuration file (%v)", err)
+			return nil, nil, err
+		}
+		opts = append(opts, provider.WithCLIConfigFile(path))
+	}
+
+	gitEnvs, gitSecrets, err := makeGitCredentialEnvs(cfg, tmpDir, envs)
+	if err != nil {
+		lp.Errorf("Failed to prepare the git credentials (%v)", err)
+		return nil, nil, err
+	}
+	opts = append(opts, provider.WithAdditionalEnvs(gitEnvs, nil, nil, nil), provider.WithSecrets(gitSecrets))
+
+	if dt.Config.Encryption != nil {
+		if engine == provider.EngineTerraform {
+			err := errors.New("encryption is not supported by terraform")
+			lp.Errorf("Invalid deploy target config (%v)", err)
+			return nil, nil, err
+		}
+		encryption, err := makeEncryption(cfg, dt.Config.Encryption)
+		if err != nil {
+			lp.Errorf("Invalid encryption config (%v)", err)
+			return nil, nil, err
+		}
+		opt, err := provider.WithEncryption(encryption)
+		if err != nil {
+			lp.Errorf("Invalid encryption config (%v)", err)
+			return nil, nil, err
+		}
+		opts = append(opts, opt)
+	}
+
+	if dt.Config.Credentials != nil {
+		credentialEnvs, credentialSecrets, err := makeCredentialEnvs(cfg, dt.Config.Credentials, tmpDir)
+		if err != nil {
+			lp.Errorf("Failed to prepare the credentials (%v)", err)
+			return nil, nil, err
+		}
+		opts = append(opts, provider.WithAdditionalEnvs(credentialEnvs, nil, nil, nil), provider.WithSecrets(credentialSecrets))
+	}
+
+	cmd = provider.NewOpenTofu(execPath, st.dir, opts...)
 
 	if ok := showUsingVersion(ctx, cmd, lp); !ok {
-		return nil, errors.New("failed to show using version")
+		return nil, nil, errors.New("failed to show using version")
 	}
 
-	if err := cmd.Init(ctx, lp); err != nil {
-		lp.Errorf("Failed to execute 'tofu init' (%v)", err)
-		return nil, err
+	return cmd, cleanup, nil
+}
+
+// installEngine installs the binary of the given engine and returns the path to it.
+func installEngine(ctx context.Context, tr *toolregistry.Registry, engine provider.Engine, appSpec *config.ApplicationConfigSpec) (string, error) {
+	if engine == provider.EngineTerraform {
+		return tr.Terraform(ctx, appSpec.TerraformVersion)
+	}
+	return tr.OpenTofu(ctx, appSpec.OpenTofuVersion)
+}
+
+// makeCLIConfig builds the OpenTofu CLI configuration from the plugin and deploy target configs.
+// The deploy target config takes precedence over the plugin config.
+// The tokens of the registry credentials are also returned to mask them in the logs.
+func makeCLIConfig(cfg *config.Config, dtCfg *config.DeployTargetConfig) (provider.CLIConfig, []string, error) {
+	var out provider.CLIConfig
+
+	mirror := dtCfg.ProviderMirror
+	if mirror == nil && cfg != nil {
+		mirror = cfg.ProviderMirror
 	}
+	if mirror != nil {
+		if err := mirror.Validate(); err != nil {
+			return out, nil, err
+		}
+		out.ProviderInstallation = &provider.ProviderInstallation{
+			FilesystemMirror: mirror.FilesystemMirror,
+			NetworkMirror:    mirror.NetworkMirror,
+			Include:          mirror.Include,
+			Exclude:          mirror.Exclude,
+			AllowDirect:      mirror.AllowDirect,
+		}
+	}
+
+	if cfg == nil || len(cfg.RegistryCredentials) == 0 {
+		return out, nil, nil
+	}
+	if err := cfg.ValidateRegistryCredentials(); err != nil {
+		return out, nil, err
+	}
+	var d decrypter
+	if slices.ContainsFunc(cfg.RegistryCredentials, func(rc config.RegistryCredential) bool { return rc.EncryptedToken != "" }) {
+		var err error
+		if d, err = newSecretDecrypter(cfg); err != nil {
+			return out, nil, err
+		}
+	}
+	tokens := make([]string, 0, len(cfg.RegistryCredentials))
+	for _, rc := range cfg.RegistryCredentials {
+		token, err := registryToken(d, rc)
+		if err != nil {
+			return out, nil, err
+		}
+		out.Credentials = append(out.Credentials, provider.Credential{Host: rc.Host, Token: token})
+		tokens = append(tokens, token)
+	}
+	return out, tokens, nil
+}
+
+// hostCLIConfigFile returns the CLI configuration file which is merged into the generated one.
+// The file can't be set only for some of the commands because the generated one is used for all of them.
+func hostCLIConfigFile(engine provider.Engine, envs config.OpenTofuCommandEnvs) (string, error) {
+	for _, e := range slices.Concat(envs.Init, envs.Plan, envs.Apply) {
+		if strings.HasPrefix(e, provider.CLIConfigFileEnv+"=") {
+			return "", fmt.Errorf("%s must be set in the shared envs to be merged with the generated CLI configuration", provider.CLIConfigFileEnv)
+		}
+	}
+	return provider.HostCLIConfigFile(engine, append(os.Environ(), envs.Shared...)), nil
+}
+
+// makeGitCredentialEnvs returns the environment variables which make git use the registry credentials with gitUsername
+// to clone the module sources over HTTPS. They are written to a credential store file in the given directory,
+// which is added to the credential helpers after the ones already configured.
+// The secrets in the store file are also returned to mask them in the logs.
+func makeGitCredentialEnvs(cfg *config.Config, dir string, envs config.OpenTofuCommandEnvs) ([]string, []string, error) {
+	if cfg == nil || !slices.ContainsFunc(cfg.RegistryCredentials, func(rc config.RegistryCredential) bool { return rc.GitUsername != "" }) {
+		return nil, nil, nil
+	}
+	if err := cfg.ValidateRegistryCredentials(); err != nil {
+		return nil, nil, err
+	}
+	for _, e := range slices.Concat(envs.Init, envs.Plan, envs.Apply) {
+		if strings.HasPrefix(e, gitConfigCountEnv+"=") {
+			return nil, nil, fmt.Errorf("%s must be set in the shared envs to be used with the git credentials", gitConfigCountEnv)
+		}
+	}
+
+	var d decrypter
+	if slices.ContainsFunc(cfg.RegistryCredentials, func(rc config.RegistryCredential) bool { return rc.EncryptedToken != "" }) {
+		var err error
+		if d, err = newSecretDecrypter(cfg); err != nil {
+			return nil, nil, err
+		}
+	}
+	var (
+		b       strings.Builder
+		secrets []string
+	)
+	for _, rc := range cfg.RegistryCredentials {
+		if rc.GitUsername == "" {
+			continue
+		}
+		token, err := registryToken(d, rc)
+		if err != nil {
+			return nil, nil, err
+		}
+		u := url.URL{Scheme: "https", User: url.UserPassword(rc.GitUsername, token), Host: rc.Host}
+		fmt.Fprintln(&b, u.String())
+		// The token is also masked in the escaped form written in the store file.
+		_, escaped, _ := strings.Cut(u.User.String(), ":")
+		secrets = append(secrets, token, escaped)
+	}
+	path := filepath.Join(dir, gitCredentialsFileName)
+	if err := os.WriteFile(path, []byte(b.String()), 0600); err != nil {
+		return nil, nil, err
+	}
+
+	// The git config is passed by the environment variables not to overwrite the one of the host.
+	// The ones already set by them are kept by adding the helper after them.
+	count := os.Getenv(gitConfigCountEnv)
+	for _, e := range envs.Shared {
+		if v, ok := strings.CutPrefix(e, gitConfigCountEnv+"="); ok {
+			count = v
+		}
+	}
+	n := 0
+	if count != "" {
+		var err error
+		if n, err = strconv.Atoi(count); err != nil || n < 0 {
+			return nil, nil, fmt.Errorf("invalid %s %q", gitConfigCountEnv, count)
+		}
+	}
+	return []string{
+		fmt.Sprintf("GIT_CONFIG_KEY_%d=credential.helper", n),
+		fmt.Sprintf("GIT_CONFIG_VALUE_%d=store --file='%s'", n, path),
+		fmt.Sprintf("%s=%d", gitConfigCountEnv, n+1),
+	}, secrets, nil
+}
 
-	if ok := selectWorkspace(ctx, cmd, appSpec.Workspace, lp); !ok {
-		return nil, errors.New("failed to select workspace")
+// registryToken returns the token of the registry credential from the encrypted token or the token file.
+func registryToken(d decrypter, rc config.RegistryCredential) (string, error) {
+	if rc.EncryptedToken != "" {
+		token, err := d.Decrypt(rc.EncryptedToken)
+		if err != nil {
+			return "", fmt.Errorf("failed to decrypt the token for host %q: %w", rc.Host, err)
+		}
+		return token, nil
 	}
+	data, err := os.ReadFile(rc.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the token file for host %q: %w", rc.Host, err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("the token file for host %q is empty", rc.Host)
+	}
+	return token, nil
+}
+
+// makeEncryption builds the encryption configuration after decrypting the passphrases of the key providers.
+func makeEncryption(cfg *config.Config, c *config.EncryptionConfig) (provider.Encryption, error) {
+	var out provider.Encryption
+	if err := c.Validate(); err != nil {
+		return out, err
+	}
+
+	var d decrypter
+	for _, kp := range c.KeyProviders {
+		p := provider.KeyProvider{
+			Type:         kp.Type,
+			Name:         kp.Name,
+			KeyLength:    kp.KeyLength,
+			Iterations:   kp.Iterations,
+			SaltLength:   kp.SaltLength,
+			HashFunction: kp.HashFunction,
+			Command:      kp.Command,
+		}
+		if kp.EncryptedPassphrase != "" {
+			if d == nil {
+				var err error
+				if d, err = newSecretDecrypter(cfg); err != nil {
+					return out, err
+				}
+			}
+			passphrase, err := d.Decrypt(kp.EncryptedPassphrase)
+			if err != nil {
+				return out, fmt.Errorf("failed to decrypt the passphrase of key provider %q: %w", kp.Name, err)
+			}
+			p.Passphrase = passphrase
+		}
+		out.KeyProviders = append(out.KeyProviders, p)
+	}
+	for _, m := range c.Methods {
+		out.Methods = append(out.Methods, provider.EncryptionMethod{Type: m.Type, Name: m.Name, KeyProvider: m.KeyProvider})
+	}
+	if c.State != nil {
+		out.State = &provider.EncryptionTarget{Method: c.State.Method, Fallback: c.State.Fallback, Enforced: c.State.Enforced}
+	}
+	if c.Plan != nil {
+		out.Plan = &provider.EncryptionTarget{Method: c.Plan.Method, Fallback: c.Plan.Fallback, Enforced: c.Plan.Enforced}
+	}
+	return out, nil
+}
 
-	return cmd, nil
+// resolveVariables decides whether each variable is passed as a string var or a typed variable,
+// so that a variable is set by only one of them in the following precedence, the last one wins:
+// deploy target variables, deploy target vars, application variables, application vars.
+func resolveVariables(dtVars []string, dtVariables map[string]any, appVars []string, appVariables map[string]any) ([]string, map[string]any) {
+	variables := make(map[string]any, len(dtVariables)+len(appVariables))
+	maps.Copy(variables, dtVariables)
+	for _, v := range dtVars {
+		delete(variables, varKey(v))
+	}
+	dtVars = slices.DeleteFunc(slices.Clone(dtVars), func(v string) bool {
+		_, ok := appVariables[varKey(v)]
+		return ok
+	})
+	maps.Copy(variables, appVariables)
+	for _, v := range appVars {
+		delete(variables, varKey(v))
+	}
+	return mergeVars(dtVars, appVars), variables
+}
+
+func varKey(v string) string {
+	key, _, _ := strings.Cut(v, "=")
+	return key
 }
 
 func mergeVars(deployTargetVars []string, appVars []string) []string {
@@ -72,22 +447,49 @@ func mergeVars(deployTargetVars []string, appVars []string) []string {
 	return mergedVars
 }
 
+// withStageTimeout returns a context which is cancelled after the given timeout.
+// Zero means no timeout.
+func withStageTimeout(ctx context.Context, timeout config.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout.Duration())
+}
+
+func validateVars(vars []string) error {
+	for _, v := range vars {
+		if key, _, ok := strings.Cut(v, "="); !ok || key == "" {
+			return fmt.Errorf("%q must be formatted by \"key=value\"", key)
+		}
+	}
+	return nil
+}
+
 func showUsingVersion(ctx context.Context, cmd *provider.OpenTofu, lp sdk.StageLogPersister) bool {
 	version, err := cmd.Version(ctx)
 	if err != nil {
 		lp.Errorf("Failed to check opentofu version (%v)", err)
 		return false
 	}
-	lp.Infof("Using opentofu version %q to execute the opentofu commands", version)
+	lp.Infof("Using %q to execute the commands", version)
 	return true
 }
 
-func selectWorkspace(ctx context.Context, cmd *provider.OpenTofu, workspace string, lp sdk.StageLogPersister) bool {
+// selectWorkspace selects the given workspace, which is created when it doesn't exist if create is true.
+func selectWorkspace(ctx context.Context, cmd *provider.OpenTofu, workspace string, create bool, lp sdk.StageLogPersister) bool {
 	if workspace == "" {
 		return true
 	}
+	if create {
+		if err := cmd.SelectOrCreateWorkspace(ctx, workspace); err != nil {
+			lp.Errorf("Failed to select or create workspace %q (%v)", workspace, err)
+			return false
+		}
+		lp.Infof("Selected workspace %q", workspace)
+		return true
+	}
 	if err := cmd.SelectWorkspace(ctx, workspace); err != nil {
-		lp.Errorf("Failed to select workspace %q (%v). You might need to create the workspace before using by command %q", workspace, err, "opentofu workspace new "+workspace)
+		lp.Errorf("Failed to select workspace %q (%v). You might need to create the workspace before using by command %q", workspace, err, cmd.Engine().Command()+" workspace new "+workspace)
 		return false
 	}
 	lp.Infof("Selected workspace %q", workspace)
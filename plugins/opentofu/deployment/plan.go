@@ -17,18 +17,20 @@ package deployment
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	sdk "github.com/pipe-cd/piped-plugin-sdk-go"
 
 	"github.com/pipe-cd/community-plugins/plugins/opentofu/config"
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/provider"
 )
 
-func (p *Plugin) executePlanStage(ctx context.Context, input *sdk.ExecuteStageInput[config.ApplicationConfigSpec], dts []*sdk.DeployTarget[config.DeployTargetConfig]) sdk.StageStatus {
-	cmd, err := initOpenTofuCommand(ctx, input.Client, input.Request.TargetDeploymentSource, dts[0])
-	if err != nil {
-		return sdk.StageStatusFailure
-	}
-
+func (p *Plugin) executePlanStage(ctx context.Context, cfg *config.Config, input *sdk.ExecuteStageInput[config.ApplicationConfigSpec], dts []*sdk.DeployTarget[config.DeployTargetConfig]) sdk.StageStatus {
 	lp := input.Client.LogPersister()
 
 	stageConfig := config.OpenTofuPlanStageOptions{}
@@ -37,20 +39,156 @@ func (p *Plugin) executePlanStage(ctx context.Context, input *sdk.ExecuteStageIn
 		return sdk.StageStatusFailure
 	}
 
-	planResult, err := cmd.Plan(ctx, lp)
+	retry, err := newRetryPolicy(stageConfig.Retry)
 	if err != nil {
-		lp.Errorf("Failed to plan (%v)", err)
+		lp.Errorf("Invalid retry options (%v)", err)
 		return sdk.StageStatusFailure
 	}
 
+	stacks, _, err := makeDeploymentStacks(lp, input.Request.TargetDeploymentSource, input.Request.Deployment)
+	if err != nil {
+		lp.Errorf("Invalid application config (%v)", err)
+		return sdk.StageStatusFailure
+	}
+
+	// The plan history is only required to compare with the last applied plan.
+	// Otherwise failing to store the plan doesn't fail the stage.
+	history, err := newPlanHistory(cfg)
+	if err != nil {
+		if stageConfig.CompareWithLastApplied {
+			lp.Errorf("Failed to prepare the plan history required by compareWithLastApplied (%v)", err)
+			return sdk.StageStatusFailure
+		}
+		lp.Infof("Skip storing the plan because the plan history is not available (%v)", err)
+		history = nil
+	}
+
+	ctx, cancel := withStageTimeout(ctx, stageConfig.Timeout)
+	defer cancel()
+
+	var changed atomic.Int32
+	results := runStacks(ctx, lp, stacks, func(ctx context.Context, st stack, lp sdk.StageLogPersister) (string, error) {
+		planResult, err := p.planStack(ctx, lp, cfg, input, dts[0], st, retry, history, stageConfig)
+		if err != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				lp.Errorf("The stage timed out after %s", stageConfig.Timeout.Duration())
+			}
+			return "", err
+		}
+		if planResult.NoChanges() {
+			return "no changes", nil
+		}
+		changed.Add(1)
+		return fmt.Sprintf("%d import, %d add, %d change, %d destroy", planResult.Imports, planResult.Adds, planResult.Changes, planResult.Destroys), nil
+	})
+	if !stacksSucceeded(results) {
+		return sdk.StageStatusFailure
+	}
+
+	if changed.Load() == 0 && stageConfig.ExitOnNoChanges {
+		return sdk.StageStatusExited
+	}
+	return sdk.StageStatusSuccess
+}
+
+func (p *Plugin) planStack(ctx context.Context, lp sdk.StageLogPersister, cfg *config.Config, input *sdk.ExecuteStageInput[config.ApplicationConfigSpec], dt *sdk.DeployTarget[config.DeployTargetConfig], st stack, retry *retryPolicy, history *planHistory, stageConfig config.OpenTofuPlanStageOptions) (provider.PlanResult, error) {
+	if policy := stageConfig.ModuleSourcePolicy; policy != nil {
+		if err := checkModuleSources(lp, input.Request.TargetDeploymentSource.ApplicationDirectory, st.dir, policy); err != nil {
+			return provider.PlanResult{}, err
+		}
+	}
+
+	cmd, cleanup, err := p.initOpenTofuCommand(ctx, input.Client, lp, cfg, input.Request.TargetDeploymentSource, dt, st)
+	if err != nil {
+		return provider.PlanResult{}, err
+	}
+	defer cleanup()
+
+	var planResult provider.PlanResult
+	err = retry.do(ctx, lp, "plan", func(int) ([]provider.Diagnostic, error) {
+		var err error
+		planResult, err = cmd.Plan(ctx, lp)
+		return planResult.Diagnostics, err
+	})
+	if err != nil {
+		if errors.Is(err, errGaveUp) {
+			lp.Errorf("Gave up planning (%v)", err)
+		} else {
+			lp.Errorf("Failed to plan (%v)", err)
+		}
+		return planResult, err
+	}
+
+	rendered := "No changes"
 	if planResult.NoChanges() {
 		lp.Success("No changes to apply")
-		if stageConfig.ExitOnNoChanges {
-			return sdk.StageStatusExited
+	} else {
+		var renderOpts []provider.RenderOption
+		if stageConfig.ShowUnchangedAttributes {
+			renderOpts = append(renderOpts, provider.WithUnchangedAttributes())
 		}
-		return sdk.StageStatusSuccess
+		if diff, err := planResult.Render(renderOpts...); err != nil {
+			lp.Errorf("Failed to render the planned changes (%v)", err)
+		} else if diff != "" {
+			lp.Infof("Planned changes:\n%s", diff)
+			rendered = diff
+		}
+		lp.Successf("Detected %d import, %d add, %d change, %d destroy.", planResult.Imports, planResult.Adds, planResult.Changes, planResult.Destroys)
 	}
 
-	lp.Successf("Detected %d import, %d add, %d change, %d destroy.", planResult.Imports, planResult.Adds, planResult.Changes, planResult.Destroys)
-	return sdk.StageStatusSuccess
+	if history == nil {
+		return planResult, nil
+	}
+	rec := newPlanRecord(input.Request.Deployment, input.Request.TargetDeploymentSource.CommitHash, st.name, planResult, time.Now())
+	dir, err := history.save(rec, rendered, planResult.Plan)
+	if err != nil {
+		if stageConfig.CompareWithLastApplied {
+			lp.Errorf("Failed to store the plan required by compareWithLastApplied (%v)", err)
+			return planResult, err
+		}
+		lp.Errorf("Failed to store the plan, continuing without it (%v)", err)
+		return planResult, nil
+	}
+	lp.Infof("Stored the plan in %s", dir)
+	if err := history.prune(rec.ApplicationID, rec.CommitHash); err != nil {
+		lp.Errorf("Failed to delete the old plans from the plan history (%v)", err)
+	}
+
+	if stageConfig.CompareWithLastApplied {
+		if applied, err := history.applied(rec.ApplicationID, st.name); err != nil {
+			lp.Errorf("Failed to load the plans applied before (%v)", err)
+		} else {
+			lp.Info(comparePlans(rec, applied))
+		}
+	}
+	return planResult, nil
+}
+
+// checkModuleSources checks the sources of the "module" blocks in the given directory
+// and in the local modules under the application directory called from it, and reports the violations.
+func checkModuleSources(lp sdk.StageLogPersister, appDir, dir string, policy *config.OpenTofuModuleSourcePolicy) error {
+	violations, err := provider.CheckModuleTree(appDir, dir, provider.ModuleSourcePolicy{
+		RequirePinned: policy.RequirePinned,
+		Allowed:       policy.AllowedSources,
+		Denied:        policy.DeniedSources,
+	})
+	if err != nil {
+		lp.Errorf("Failed to load the files to check the module sources (%v)", err)
+		return err
+	}
+	if len(violations) == 0 {
+		lp.Info("All module sources satisfy the policy")
+		return nil
+	}
+
+	var b strings.Builder
+	for _, v := range violations {
+		rel, err := filepath.Rel(appDir, v.File)
+		if err == nil {
+			v.File = rel
+		}
+		fmt.Fprintf(&b, "  %s\n", v)
+	}
+	lp.Errorf("Found %d module(s) violating the module source policy:\n%s", len(violations), b.String())
+	return fmt.Errorf("%d module(s) violate the module source policy", len(violations))
 }
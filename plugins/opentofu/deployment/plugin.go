@@ -33,10 +33,26 @@ const (
 	stageApply = "OPENTOFU_APPLY"
 	// OPENTOFU_ROLLBACK stage rollbacks by executing 'tofu apply' for the previous state.
 	stageRollback = "OPENTOFU_ROLLBACK"
+	// OPENTOFU_TEST stage executes `tofu test`.
+	stageTest = "OPENTOFU_TEST"
+	// OPENTOFU_VALIDATE stage executes `tofu validate` and `tofu fmt -check` without accessing the backend.
+	stageValidate = "OPENTOFU_VALIDATE"
+	// OPENTOFU_REFRESH stage updates the state to match the real infrastructure by executing `tofu apply -refresh-only`.
+	stageRefresh = "OPENTOFU_REFRESH"
+	// OPENTOFU_VERIFY stage verifies that the infrastructure has converged and the checks pass.
+	stageVerify = "OPENTOFU_VERIFY"
+	// OPENTOFU_PULL_REQUEST_CLEANUP stage destroys the environment of a pull request and deletes its workspace.
+	stagePullRequestCleanup = "OPENTOFU_PULL_REQUEST_CLEANUP"
+	// OPENTOFU_COST_ESTIMATE stage estimates the change of the monthly cost by the planned changes from a price catalog.
+	stageCostEstimate = "OPENTOFU_COST_ESTIMATE"
 )
 
 // Plugin implements sdk.DeploymentPlugin for OpenTofu.
-type Plugin struct{}
+type Plugin struct {
+	// runner executes the commands instead of the binary installed by the tool registry.
+	// This is set only in tests.
+	runner provider.Runner
+}
 
 var _ sdk.DeploymentPlugin[config.Config, config.DeployTargetConfig, config.ApplicationConfigSpec] = (*Plugin)(nil)
 
@@ -45,6 +61,12 @@ func (*Plugin) FetchDefinedStages() []string {
 		stagePlan,
 		stageApply,
 		stageRollback,
+		stageTest,
+		stageValidate,
+		stageRefresh,
+		stageVerify,
+		stagePullRequestCleanup,
+		stageCostEstimate,
 	}
 }
 
@@ -84,15 +106,39 @@ func (p *Plugin) ExecuteStage(ctx context.Context, cfg *config.Config, dts []*sd
 	switch input.Request.StageName {
 	case stagePlan:
 		return &sdk.ExecuteStageResponse{
-			Status: p.executePlanStage(ctx, input, dts),
+			Status: p.executePlanStage(ctx, cfg, input, dts),
 		}, nil
 	case stageApply:
 		return &sdk.ExecuteStageResponse{
-			Status: p.executeApplyStage(ctx, input, dts),
+			Status: p.executeApplyStage(ctx, cfg, input, dts),
 		}, nil
 	case stageRollback:
 		return &sdk.ExecuteStageResponse{
-			Status: p.executeRollbackStage(ctx, input, dts),
+			Status: p.executeRollbackStage(ctx, cfg, input, dts),
+		}, nil
+	case stageTest:
+		return &sdk.ExecuteStageResponse{
+			Status: p.executeTestStage(ctx, cfg, input, dts),
+		}, nil
+	case stageValidate:
+		return &sdk.ExecuteStageResponse{
+			Status: p.executeValidateStage(ctx, cfg, input, dts),
+		}, nil
+	case stageRefresh:
+		return &sdk.ExecuteStageResponse{
+			Status: p.executeRefreshStage(ctx, cfg, input, dts),
+		}, nil
+	case stageVerify:
+		return &sdk.ExecuteStageResponse{
+			Status: p.executeVerifyStage(ctx, cfg, input, dts),
+		}, nil
+	case stagePullRequestCleanup:
+		return &sdk.ExecuteStageResponse{
+			Status: p.executePullRequestCleanupStage(ctx, cfg, input, dts),
+		}, nil
+	case stageCostEstimate:
+		return &sdk.ExecuteStageResponse{
+			Status: p.executeCostEstimateStage(ctx, cfg, input, dts),
 		}, nil
 	default:
 		return nil, errors.New("unsupported stage")
@@ -101,12 +147,22 @@ func (p *Plugin) ExecuteStage(ctx context.Context, cfg *config.Config, dts []*sd
 
 // DetermineVersions determines the versions of artifacts for the deployment.
 func (p *Plugin) DetermineVersions(ctx context.Context, cfg *config.Config, input *sdk.DetermineVersionsInput[config.ApplicationConfigSpec]) (*sdk.DetermineVersionsResponse, error) {
-	files, err := provider.LoadOpenTofuFiles(input.Request.DeploymentSource.ApplicationDirectory)
+	stacks, err := makeStacks(input.Request.DeploymentSource)
 	if err != nil {
-		input.Logger.Error("failed to load OpenTofu files", zap.Error(err))
+		input.Logger.Error("invalid application config", zap.Error(err))
 		return nil, err
 	}
 
+	var files []provider.File
+	for _, st := range stacks {
+		fs, err := provider.LoadOpenTofuFiles(st.dir)
+		if err != nil {
+			input.Logger.Error("failed to load OpenTofu files", zap.String("stack", st.name), zap.Error(err))
+			return nil, err
+		}
+		files = append(files, fs...)
+	}
+
 	versions, err := provider.FindArtifactVersions(files)
 	if err != nil || len(versions) == 0 {
 		input.Logger.Warn("unable to determine target versions", zap.Error(err))
@@ -23,7 +23,7 @@ import (
 
 func Test_FetchDefinedStages(t *testing.T) {
 	plugin := &Plugin{}
-	desiredStages := []string{"OPENTOFU_PLAN", "OPENTOFU_APPLY", "OPENTOFU_ROLLBACK"}
+	desiredStages := []string{"OPENTOFU_PLAN", "OPENTOFU_APPLY", "OPENTOFU_ROLLBACK", "OPENTOFU_TEST", "OPENTOFU_VALIDATE", "OPENTOFU_REFRESH", "OPENTOFU_VERIFY", "OPENTOFU_PULL_REQUEST_CLEANUP", "OPENTOFU_COST_ESTIMATE"}
 	expectedstages := plugin.FetchDefinedStages()
 
 	assert.Equal(t, desiredStages, expectedstages, "Defined stages should match the expected stages")
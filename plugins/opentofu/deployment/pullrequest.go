@@ -0,0 +1,226 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	sdk "github.com/pipe-cd/piped-plugin-sdk-go"
+
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/config"
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/provider"
+)
+
+const (
+	defaultPullRequestLabel           = "pull-request"
+	defaultPullRequestBranchLabel     = "branch"
+	defaultPullRequestWorkspacePrefix = "pr-"
+
+	pullRequestNumberVar = "pull_request_number"
+	pullRequestBranchVar = "pull_request_branch"
+
+	destroyFlag = "-destroy"
+)
+
+// pullRequest is the pull request which a deployment is for.
+type pullRequest struct {
+	number    string
+	branch    string
+	workspace string
+}
+
+// findPullRequest returns the pull request from the labels of the deployment.
+// It returns nil when the deployment isn't for a pull request.
+func findPullRequest(c *config.OpenTofuPullRequestEnvironment, d sdk.Deployment) (*pullRequest, error) {
+	if c == nil {
+		return nil, nil
+	}
+	label := cmp.Or(c.PullRequestLabel, defaultPullRequestLabel)
+	number, ok := d.Labels[label]
+	if !ok {
+		return nil, nil
+	}
+	if n, err := strconv.Atoi(number); err != nil || n <= 0 {
+		return nil, fmt.Errorf("label %q must be a pull request number but got %q", label, number)
+	}
+	return &pullRequest{
+		number:    number,
+		branch:    d.Labels[cmp.Or(c.BranchLabel, defaultPullRequestBranchLabel)],
+		workspace: cmp.Or(c.WorkspacePrefix, defaultPullRequestWorkspacePrefix) + number,
+	}, nil
+}
+
+// makeDeploymentStacks returns the stacks of the application deployed by the deployment.
+// When the deployment is for a pull request, the stacks are deployed to the workspace of the pull request
+// with the variables of its number and branch.
+func makeDeploymentStacks(lp sdk.StageLogPersister, ds sdk.DeploymentSource[config.ApplicationConfigSpec], d sdk.Deployment) ([]stack, *pullRequest, error) {
+	stacks, err := makeStacks(ds)
+	if err != nil {
+		return nil, nil, err
+	}
+	pr, err := findPullRequest(ds.ApplicationConfig.Spec.PullRequestEnvironment, d)
+	if err != nil || pr == nil {
+		return stacks, nil, err
+	}
+
+	lp.Infof("Deploying the environment of pull request #%s in workspace %q", pr.number, pr.workspace)
+	vars := []string{pullRequestNumberVar + "=" + pr.number}
+	if pr.branch != "" {
+		vars = append(vars, pullRequestBranchVar+"="+pr.branch)
+	}
+	for i := range stacks {
+		stacks[i].workspace = pr.workspace
+		stacks[i].createWorkspace = true
+		stacks[i].vars = append(slices.Clone(stacks[i].vars), vars...)
+	}
+	return stacks, pr, nil
+}
+
+// reportOutputs writes the root module outputs with the given names to the log.
+// Empty names means all outputs.
+func reportOutputs(ctx context.Context, lp sdk.StageLogPersister, cmd *provider.OpenTofu, names []string) {
+	outputs, err := cmd.Output(ctx)
+	if err != nil {
+		lp.Errorf("Failed to read the outputs (%v)", err)
+		return
+	}
+	if len(names) == 0 {
+		names = slices.Sorted(maps.Keys(outputs))
+	}
+
+	var b strings.Builder
+	for _, name := range names {
+		o, ok := outputs[name]
+		switch {
+		case !ok:
+			fmt.Fprintf(&b, "  %s: (not found)\n", name)
+		case o.Sensitive:
+			fmt.Fprintf(&b, "  %s: (sensitive value)\n", name)
+		default:
+			fmt.Fprintf(&b, "  %s: %s\n", name, formatOutput(o.Value))
+		}
+	}
+	if b.Len() == 0 {
+		lp.Info("No outputs")
+		return
+	}
+	lp.Infof("Outputs:\n%s", b.String())
+}
+
+// formatOutput returns the string as is and the other values as JSON.
+func formatOutput(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// reverseDependencies returns the stacks whose dependencies are reversed,
+// so that each stack is destroyed after the stacks depending on it.
+func reverseDependencies(stacks []stack) []stack {
+	dependents := make(map[string][]string, len(stacks))
+	for _, st := range stacks {
+		for _, d := range st.dependsOn {
+			dependents[d] = append(dependents[d], st.name)
+		}
+	}
+	out := slices.Clone(stacks)
+	for i := range out {
+		out[i].dependsOn = dependents[out[i].name]
+	}
+	return out
+}
+
+func (p *Plugin) executePullRequestCleanupStage(ctx context.Context, cfg *config.Config, input *sdk.ExecuteStageInput[config.ApplicationConfigSpec], dts []*sdk.DeployTarget[config.DeployTargetConfig]) sdk.StageStatus {
+	lp := input.Client.LogPersister()
+
+	var stageConfig config.OpenTofuPullRequestCleanupStageOptions
+	if err := json.Unmarshal(input.Request.StageConfig, &stageConfig); err != nil {
+		lp.Errorf("Failed to unmarshal stage config (%v)", err)
+		return sdk.StageStatusFailure
+	}
+
+	retry, err := newRetryPolicy(stageConfig.Retry)
+	if err != nil {
+		lp.Errorf("Invalid retry options (%v)", err)
+		return sdk.StageStatusFailure
+	}
+
+	stacks, pr, err := makeDeploymentStacks(lp, input.Request.TargetDeploymentSource, input.Request.Deployment)
+	if err != nil {
+		lp.Errorf("Invalid application config (%v)", err)
+		return sdk.StageStatusFailure
+	}
+	if pr == nil {
+		// Never destroy the environment which isn't for a pull request.
+		lp.Errorf("This deployment isn't for a pull request. %s can be used only with pullRequestEnvironment and the label of the pull request number", stagePullRequestCleanup)
+		return sdk.StageStatusFailure
+	}
+
+	ctx, cancel := withStageTimeout(ctx, stageConfig.Timeout)
+	defer cancel()
+
+	results := runStacks(ctx, lp, reverseDependencies(stacks), func(ctx context.Context, st stack, lp sdk.StageLogPersister) (string, error) {
+		// Initialize without selecting the workspace, so that a missing workspace isn't created only to be deleted.
+		initStack := st
+		initStack.workspace = ""
+		initStack.createWorkspace = false
+		cmd, cleanup, err := p.initOpenTofuCommand(ctx, input.Client, lp, cfg, input.Request.TargetDeploymentSource, dts[0], initStack)
+		if err != nil {
+			return "", err
+		}
+		defer cleanup()
+
+		workspaces, err := cmd.ListWorkspaces(ctx)
+		if err != nil {
+			lp.Errorf("Failed to list workspaces (%v)", err)
+			return "", err
+		}
+		if !slices.Contains(workspaces, st.workspace) {
+			lp.Infof("Workspace %q doesn't exist, so there is nothing to clean up. Check the label of the pull request number and workspacePrefix if the environment should exist", st.workspace)
+			return "nothing to clean up", nil
+		}
+		if !selectWorkspace(ctx, cmd, st.workspace, false, lp) {
+			return "", errors.New("failed to select workspace")
+		}
+
+		lp.Infof("Start destroying the environment of pull request #%s", pr.number)
+		if err := applyWithRetry(ctx, lp, cmd, retry, destroyFlag); err != nil {
+			return "", err
+		}
+		if err := cmd.DeleteWorkspace(ctx, st.workspace); err != nil {
+			lp.Errorf("Failed to delete workspace %q (%v)", st.workspace, err)
+			return "", err
+		}
+		lp.Successf("Successfully destroyed the environment and deleted workspace %q", st.workspace)
+		return "destroyed", nil
+	})
+	if !stacksSucceeded(results) {
+		return sdk.StageStatusFailure
+	}
+	return sdk.StageStatusSuccess
+}
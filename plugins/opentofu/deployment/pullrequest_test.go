@@ -0,0 +1,174 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"context"
+	"testing"
+
+	sdk "github.com/pipe-cd/piped-plugin-sdk-go"
+	"github.com/pipe-cd/piped-plugin-sdk-go/logpersister/logpersistertest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/config"
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/provider"
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/provider/providertest"
+)
+
+func TestFindPullRequest(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		name        string
+		config      *config.OpenTofuPullRequestEnvironment
+		labels      map[string]string
+		expected    *pullRequest
+		expectedErr bool
+	}{
+		{
+			name:   "not configured",
+			labels: map[string]string{"pull-request": "12"},
+		},
+		{
+			name:   "not for a pull request",
+			config: &config.OpenTofuPullRequestEnvironment{},
+			labels: map[string]string{"env": "dev"},
+		},
+		{
+			name:     "default labels",
+			config:   &config.OpenTofuPullRequestEnvironment{},
+			labels:   map[string]string{"pull-request": "12", "branch": "feature/login"},
+			expected: &pullRequest{number: "12", branch: "feature/login", workspace: "pr-12"},
+		},
+		{
+			name:     "custom labels and prefix",
+			config:   &config.OpenTofuPullRequestEnvironment{PullRequestLabel: "pr", BranchLabel: "head", WorkspacePrefix: "preview-"},
+			labels:   map[string]string{"pr": "7"},
+			expected: &pullRequest{number: "7", workspace: "preview-7"},
+		},
+		{
+			name:        "invalid number",
+			config:      &config.OpenTofuPullRequestEnvironment{},
+			labels:      map[string]string{"pull-request": "../main"},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			pr, err := findPullRequest(tc.config, sdk.Deployment{Labels: tc.labels})
+			assert.Equal(t, tc.expectedErr, err != nil, err)
+			assert.Equal(t, tc.expected, pr)
+		})
+	}
+}
+
+func TestMakeDeploymentStacks(t *testing.T) {
+	t.Parallel()
+
+	ds := sdk.DeploymentSource[config.ApplicationConfigSpec]{
+		ApplicationDirectory: "/app",
+		ApplicationConfig: &sdk.ApplicationConfig[config.ApplicationConfigSpec]{
+			Spec: &config.ApplicationConfigSpec{
+				Workspace: "prod",
+				Stacks: []config.OpenTofuStack{
+					{Name: "network", Dir: "network", Vars: []string{"cidr=10.0.0.0/16"}},
+					{Name: "app", Dir: "app", DependsOn: []string{"network"}},
+				},
+				PullRequestEnvironment: &config.OpenTofuPullRequestEnvironment{},
+			},
+		},
+	}
+	lp := logpersistertest.NewTestLogPersister(t)
+
+	stacks, pr, err := makeDeploymentStacks(lp, ds, sdk.Deployment{})
+	require.NoError(t, err)
+	assert.Nil(t, pr)
+	assert.Equal(t, "prod", stacks[0].workspace)
+	assert.False(t, stacks[0].createWorkspace)
+
+	stacks, pr, err = makeDeploymentStacks(lp, ds, sdk.Deployment{Labels: map[string]string{"pull-request": "12", "branch": "feature/login"}})
+	require.NoError(t, err)
+	require.NotNil(t, pr)
+	for _, st := range stacks {
+		assert.Equal(t, "pr-12", st.workspace)
+		assert.True(t, st.createWorkspace)
+	}
+	assert.Equal(t, []string{"cidr=10.0.0.0/16", "pull_request_number=12", "pull_request_branch=feature/login"}, stacks[0].vars)
+	assert.Equal(t, []string{"pull_request_number=12", "pull_request_branch=feature/login"}, stacks[1].vars)
+	// The stack config isn't changed.
+	assert.Equal(t, []string{"cidr=10.0.0.0/16"}, ds.ApplicationConfig.Spec.Stacks[0].Vars)
+}
+
+func TestReverseDependencies(t *testing.T) {
+	t.Parallel()
+
+	stacks := []stack{
+		{name: "network"},
+		{name: "data", dependsOn: []string{"network"}},
+		{name: "app", dependsOn: []string{"network", "data"}},
+	}
+	reversed := reverseDependencies(stacks)
+	assert.Equal(t, []string{"data", "app"}, reversed[0].dependsOn)
+	assert.Equal(t, []string{"app"}, reversed[1].dependsOn)
+	assert.Empty(t, reversed[2].dependsOn)
+	// The given stacks aren't changed.
+	assert.Equal(t, []string{"network", "data"}, stacks[2].dependsOn)
+}
+
+func TestReportOutputs(t *testing.T) {
+	t.Parallel()
+
+	runner := providertest.NewRunner().On("output", providertest.Response{Stdout: `{
+  "url": {"sensitive": false, "type": "string", "value": "https://pr-12.example.com"},
+  "ports": {"sensitive": false, "type": ["list", "number"], "value": [80, 443]},
+  "password": {"sensitive": true, "type": "string", "value": "s3cr3t"}
+}`})
+	cmd := provider.NewOpenTofu("tofu", t.TempDir(), provider.WithRunner(runner))
+
+	testcases := []struct {
+		name     string
+		names    []string
+		expected string
+	}{
+		{
+			name: "all outputs",
+			expected: `Outputs:
+  password: (sensitive value)
+  ports: [80,443]
+  url: https://pr-12.example.com
+`,
+		},
+		{
+			name:  "selected outputs",
+			names: []string{"url", "missing"},
+			expected: `Outputs:
+  url: https://pr-12.example.com
+  missing: (not found)
+`,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			lp := &bufferLogPersister{}
+			reportOutputs(context.Background(), lp, cmd, tc.names)
+			assert.Equal(t, tc.expected, lp.buf.String())
+		})
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	sdk "github.com/pipe-cd/piped-plugin-sdk-go"
+
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/config"
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/provider"
+)
+
+const (
+	refreshOnlyFlag   = "-refresh-only"
+	waitApprovalStage = "WAIT_APPROVAL"
+)
+
+func (p *Plugin) executeRefreshStage(ctx context.Context, cfg *config.Config, input *sdk.ExecuteStageInput[config.ApplicationConfigSpec], dts []*sdk.DeployTarget[config.DeployTargetConfig]) sdk.StageStatus {
+	lp := input.Client.LogPersister()
+
+	var stageConfig config.OpenTofuRefreshStageOptions
+	if err := json.Unmarshal(input.Request.StageConfig, &stageConfig); err != nil {
+		lp.Errorf("Failed to unmarshal stage config (%v)", err)
+		return sdk.StageStatusFailure
+	}
+
+	if err := stageConfig.Validate(); err != nil {
+		lp.Errorf("Invalid stage config (%v)", err)
+		return sdk.StageStatusFailure
+	}
+
+	// The changes to the state are applied without a plan file in the same way as the apply stage,
+	// so they must be approved in the pipeline before this stage.
+	if !stageConfig.SkipApprovalCheck && !hasStage(input.Request.TargetDeploymentSource.ApplicationConfig, waitApprovalStage) {
+		lp.Errorf("The pipeline must have a %s stage before this stage to approve the changes to the state, or set skipApprovalCheck to run without approval", waitApprovalStage)
+		return sdk.StageStatusFailure
+	}
+
+	retry, err := newRetryPolicy(stageConfig.Retry)
+	if err != nil {
+		lp.Errorf("Invalid retry options (%v)", err)
+		return sdk.StageStatusFailure
+	}
+
+	stacks, _, err := makeDeploymentStacks(lp, input.Request.TargetDeploymentSource, input.Request.Deployment)
+	if err != nil {
+		lp.Errorf("Invalid application config (%v)", err)
+		return sdk.StageStatusFailure
+	}
+
+	ctx, cancel := withStageTimeout(ctx, stageConfig.Timeout)
+	defer cancel()
+
+	var changed atomic.Int32
+	results := runStacks(ctx, lp, stacks, func(ctx context.Context, st stack, lp sdk.StageLogPersister) (string, error) {
+		cmd, cleanup, err := p.initOpenTofuCommand(ctx, input.Client, lp, cfg, input.Request.TargetDeploymentSource, dts[0], st)
+		if err != nil {
+			return "", err
+		}
+		defer cleanup()
+
+		var planResult provider.PlanResult
+		err = retry.do(ctx, lp, "plan", func(int) ([]provider.Diagnostic, error) {
+			var err error
+			planResult, err = cmd.Plan(ctx, lp, refreshOnlyFlag)
+			return planResult.Diagnostics, err
+		})
+		if err != nil {
+			if errors.Is(err, errGaveUp) {
+				lp.Errorf("Gave up planning (%v)", err)
+			} else {
+				lp.Errorf("Failed to plan (%v)", err)
+			}
+			return "", err
+		}
+
+		if planResult.NoChanges() {
+			lp.Success("The state already matches the real infrastructure")
+			return "no changes", nil
+		}
+		changed.Add(1)
+
+		if diff, err := planResult.Render(provider.WithResourceDrift()); err != nil {
+			lp.Errorf("Failed to render the changes to the state (%v)", err)
+		} else if diff != "" {
+			lp.Infof("The following changes will be accepted into the state:\n%s", diff)
+		}
+
+		if _, err := applyStack(ctx, lp, cmd, retry, st.dir, stageConfig.OpenTofuApplyStageOptions, refreshOnlyFlag); err != nil {
+			return "", err
+		}
+		lp.Success("Successfully updated the state")
+		if len(stageConfig.Waves) > 0 {
+			return fmt.Sprintf("refreshed in %d waves", len(stageConfig.Waves)), nil
+		}
+		return "refreshed", nil
+	})
+	if !stacksSucceeded(results) {
+		return sdk.StageStatusFailure
+	}
+
+	if changed.Load() == 0 && stageConfig.ExitOnNoChanges {
+		return sdk.StageStatusExited
+	}
+	return sdk.StageStatusSuccess
+}
+
+// hasStage returns true when the pipeline of the application has the given stage.
+func hasStage(ac *sdk.ApplicationConfig[config.ApplicationConfigSpec], name string) bool {
+	// The pipeline can't be read before the generic spec is loaded, which is checked by Validate.
+	return ac.Validate() == nil && ac.HasStage(name)
+}
@@ -0,0 +1,122 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	sdk "github.com/pipe-cd/piped-plugin-sdk-go"
+
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/config"
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/provider"
+)
+
+const defaultRetryBackoff = 10 * time.Second
+
+// errGaveUp is returned when the command kept failing with retryable errors until the max attempts.
+var errGaveUp = errors.New("gave up after retries")
+
+type retryPolicy struct {
+	maxAttempts     int
+	backoff         time.Duration
+	retryable       []*regexp.Regexp
+	retryableErrors []error
+}
+
+// newRetryPolicy creates a retry policy from the options.
+// The given errors are retryable in addition to the errors matching the retryableErrors of the options, which are required otherwise to retry.
+func newRetryPolicy(opts config.OpenTofuRetryOptions, retryableErrors ...error) (*retryPolicy, error) {
+	p := &retryPolicy{
+		maxAttempts:     max(opts.MaxAttempts, 1),
+		backoff:         opts.Backoff.Duration(),
+		retryable:       make([]*regexp.Regexp, 0, len(opts.RetryableErrors)),
+		retryableErrors: retryableErrors,
+	}
+	if p.backoff <= 0 {
+		p.backoff = defaultRetryBackoff
+	}
+	if p.maxAttempts > 1 && len(opts.RetryableErrors) == 0 && len(retryableErrors) == 0 {
+		return nil, errors.New("retryableErrors must be set to retry, otherwise no error is retried")
+	}
+	for _, e := range opts.RetryableErrors {
+		r, err := regexp.Compile(e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retryable error %q: %w", e, err)
+		}
+		p.retryable = append(p.retryable, r)
+	}
+	return p, nil
+}
+
+// isRetryable returns true when the error is one of the retryable errors, or it or one of the error diagnostics matches the retryable patterns.
+func (p *retryPolicy) isRetryable(err error, diags []provider.Diagnostic) bool {
+	for _, e := range p.retryableErrors {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	msgs := []string{err.Error()}
+	for _, d := range diags {
+		if d.Severity != "warning" {
+			msgs = append(msgs, d.String())
+		}
+	}
+	for _, msg := range msgs {
+		for _, r := range p.retryable {
+			if r.MatchString(msg) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// do calls fn until it succeeds, it fails with a non-retryable error, or the attempts reach the max.
+// fn returns the diagnostics of the failed command to decide whether the error is retryable.
+// The returned error wraps errGaveUp when all attempts failed with retryable errors.
+func (p *retryPolicy) do(ctx context.Context, lp sdk.StageLogPersister, name string, fn func(attempt int) ([]provider.Diagnostic, error)) error {
+	backoff := p.backoff
+	for attempt := 1; ; attempt++ {
+		if p.maxAttempts > 1 {
+			lp.Infof("Attempt %d/%d to %s", attempt, p.maxAttempts, name)
+		}
+
+		diags, err := fn(attempt)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil || !p.isRetryable(err, diags) {
+			return err
+		}
+		if attempt >= p.maxAttempts {
+			if p.maxAttempts == 1 {
+				return err
+			}
+			return fmt.Errorf("%w: %d attempts to %s failed with retryable errors, the last error: %w", errGaveUp, attempt, name, err)
+		}
+
+		lp.Infof("Attempt %d/%d to %s failed with a retryable error (%v). Retrying in %s", attempt, p.maxAttempts, name, err, backoff)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
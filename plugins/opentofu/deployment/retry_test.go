@@ -0,0 +1,165 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pipe-cd/piped-plugin-sdk-go/logpersister/logpersistertest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/config"
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/provider"
+)
+
+func TestNewRetryPolicy(t *testing.T) {
+	t.Parallel()
+
+	p, err := newRetryPolicy(config.OpenTofuRetryOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, p.maxAttempts)
+	assert.Equal(t, defaultRetryBackoff, p.backoff)
+
+	_, err = newRetryPolicy(config.OpenTofuRetryOptions{RetryableErrors: []string{"("}})
+	assert.Error(t, err)
+
+	// Retrying requires the retryable errors.
+	_, err = newRetryPolicy(config.OpenTofuRetryOptions{MaxAttempts: 3})
+	assert.Error(t, err)
+	_, err = newRetryPolicy(config.OpenTofuRetryOptions{MaxAttempts: 3}, errNotConverged)
+	assert.NoError(t, err)
+}
+
+func TestRetryPolicy_Do(t *testing.T) {
+	t.Parallel()
+
+	var (
+		errFailed = errors.New("exit status 1")
+		throttled = []provider.Diagnostic{{Severity: "error", Summary: "ThrottlingException: Rate exceeded"}}
+		denied    = []provider.Diagnostic{{Severity: "error", Summary: "AccessDenied"}}
+	)
+
+	testcases := []struct {
+		name             string
+		opts             config.OpenTofuRetryOptions
+		retryableErrors  []error
+		err              error
+		results          [][]provider.Diagnostic
+		expectedAttempts int
+		expectedErr      bool
+		expectedGaveUp   bool
+	}{
+		{
+			name:             "succeed at first",
+			opts:             config.OpenTofuRetryOptions{MaxAttempts: 3, RetryableErrors: []string{"Throttling"}},
+			results:          nil,
+			expectedAttempts: 1,
+		},
+		{
+			name:             "succeed after retries",
+			opts:             config.OpenTofuRetryOptions{MaxAttempts: 3, RetryableErrors: []string{"Throttling"}},
+			results:          [][]provider.Diagnostic{throttled, throttled},
+			expectedAttempts: 3,
+		},
+		{
+			name:             "give up after retries",
+			opts:             config.OpenTofuRetryOptions{MaxAttempts: 2, RetryableErrors: []string{"Throttling"}},
+			results:          [][]provider.Diagnostic{throttled, throttled, throttled},
+			expectedAttempts: 2,
+			expectedErr:      true,
+			expectedGaveUp:   true,
+		},
+		{
+			name:             "hard failure",
+			opts:             config.OpenTofuRetryOptions{MaxAttempts: 3, RetryableErrors: []string{"Throttling"}},
+			results:          [][]provider.Diagnostic{denied},
+			expectedAttempts: 1,
+			expectedErr:      true,
+		},
+		{
+			name:             "retryable error",
+			opts:             config.OpenTofuRetryOptions{MaxAttempts: 3},
+			retryableErrors:  []error{errNotConverged},
+			err:              fmt.Errorf("%w: 1 add pending", errNotConverged),
+			results:          [][]provider.Diagnostic{nil},
+			expectedAttempts: 2,
+		},
+		{
+			name:             "hard failure with retryable errors",
+			opts:             config.OpenTofuRetryOptions{MaxAttempts: 3},
+			retryableErrors:  []error{errNotConverged},
+			results:          [][]provider.Diagnostic{throttled},
+			expectedAttempts: 1,
+			expectedErr:      true,
+		},
+		{
+			name:             "no retry by default",
+			results:          [][]provider.Diagnostic{throttled},
+			expectedAttempts: 1,
+			expectedErr:      true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tc.opts.Backoff = config.Duration(time.Millisecond)
+			p, err := newRetryPolicy(tc.opts, tc.retryableErrors...)
+			require.NoError(t, err)
+			failed := cmp.Or(tc.err, errFailed)
+
+			attempts := 0
+			err = p.do(context.Background(), logpersistertest.NewTestLogPersister(t), "apply", func(attempt int) ([]provider.Diagnostic, error) {
+				attempts++
+				assert.Equal(t, attempts, attempt)
+				if attempt > len(tc.results) {
+					return nil, nil
+				}
+				return tc.results[attempt-1], failed
+			})
+			assert.Equal(t, tc.expectedAttempts, attempts)
+			assert.Equal(t, tc.expectedErr, err != nil)
+			assert.Equal(t, tc.expectedGaveUp, errors.Is(err, errGaveUp))
+			if tc.expectedErr {
+				assert.ErrorIs(t, err, failed)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_Do_Cancelled(t *testing.T) {
+	t.Parallel()
+
+	p, err := newRetryPolicy(config.OpenTofuRetryOptions{MaxAttempts: 3, Backoff: config.Duration(time.Hour), RetryableErrors: []string{"interrupted"}})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	err = p.do(ctx, logpersistertest.NewTestLogPersister(t), "apply", func(int) ([]provider.Diagnostic, error) {
+		attempts++
+		cancel()
+		return nil, errors.New("interrupted")
+	})
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, errGaveUp))
+	assert.Equal(t, 1, attempts)
+}
@@ -22,7 +22,7 @@ import (
 	"github.com/pipe-cd/community-plugins/plugins/opentofu/config"
 )
 
-func (p *Plugin) executeRollbackStage(ctx context.Context, input *sdk.ExecuteStageInput[config.ApplicationConfigSpec], dts []*sdk.DeployTarget[config.DeployTargetConfig]) sdk.StageStatus {
+func (p *Plugin) executeRollbackStage(ctx context.Context, cfg *config.Config, input *sdk.ExecuteStageInput[config.ApplicationConfigSpec], dts []*sdk.DeployTarget[config.DeployTargetConfig]) sdk.StageStatus {
 	lp := input.Client.LogPersister()
 	rds := input.Request.RunningDeploymentSource
 
@@ -31,14 +31,36 @@ func (p *Plugin) executeRollbackStage(ctx context.Context, input *sdk.ExecuteSta
 		return sdk.StageStatusFailure
 	}
 
-	cmd, err := initOpenTofuCommand(ctx, input.Client, input.Request.TargetDeploymentSource, dts[0])
+	stageConfig := rds.ApplicationConfig.Spec.Rollback
+	retry, err := newRetryPolicy(stageConfig.Retry)
 	if err != nil {
+		lp.Errorf("Invalid retry options (%v)", err)
 		return sdk.StageStatusFailure
 	}
 
+	stacks, _, err := makeDeploymentStacks(lp, rds, input.Request.Deployment)
+	if err != nil {
+		lp.Errorf("Invalid application config (%v)", err)
+		return sdk.StageStatusFailure
+	}
+
+	ctx, cancel := withStageTimeout(ctx, stageConfig.Timeout)
+	defer cancel()
+
 	lp.Infof("Start rolling back to the state defined at commit %s", rds.CommitHash)
-	if err = cmd.Apply(ctx, lp); err != nil {
-		lp.Errorf("Failed to apply changes (%v)", err)
+	results := runStacks(ctx, lp, stacks, func(ctx context.Context, st stack, lp sdk.StageLogPersister) (string, error) {
+		cmd, cleanup, err := p.initOpenTofuCommand(ctx, input.Client, lp, cfg, rds, dts[0], st)
+		if err != nil {
+			return "", err
+		}
+		defer cleanup()
+
+		if err := applyWithRetry(ctx, lp, cmd, retry); err != nil {
+			return "", err
+		}
+		return "rolled back", nil
+	})
+	if !stacksSucceeded(results) {
 		return sdk.StageStatusFailure
 	}
 
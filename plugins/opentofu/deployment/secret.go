@@ -0,0 +1,59 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/pipe-cd/pipecd/pkg/crypto"
+
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/config"
+)
+
+type decrypter interface {
+	Decrypt(encryptedText string) (string, error)
+}
+
+// newSecretDecrypter returns a decrypter for the secrets encrypted by piped's secret management.
+func newSecretDecrypter(cfg *config.Config) (decrypter, error) {
+	if cfg == nil || cfg.SecretManagement == nil || cfg.SecretManagement.PrivateKeyFile == "" {
+		return nil, errors.New("secretManagement.privateKeyFile must be set in the plugin config to use encrypted values")
+	}
+	key, err := os.ReadFile(cfg.SecretManagement.PrivateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the private key file: %w", err)
+	}
+	return crypto.NewHybridDecrypter(key)
+}
+
+// decryptVars decrypts the given encrypted vars and returns them formatted by "key=value" in the order of their keys.
+// The decrypted values are also returned to mask them in the logs.
+func decryptVars(d decrypter, encryptedVars map[string]string) (vars []string, secrets []string, err error) {
+	vars = make([]string, 0, len(encryptedVars))
+	secrets = make([]string, 0, len(encryptedVars))
+	for _, k := range slices.Sorted(maps.Keys(encryptedVars)) {
+		v, err := d.Decrypt(encryptedVars[k])
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decrypt the var %q: %w", k, err)
+		}
+		vars = append(vars, fmt.Sprintf("%s=%s", k, v))
+		secrets = append(secrets, v)
+	}
+	return vars, secrets, nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pipe-cd/pipecd/pkg/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/config"
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/provider"
+)
+
+func TestDecryptVars(t *testing.T) {
+	t.Parallel()
+
+	private, public, err := crypto.GenerateRSAPems(2048)
+	require.NoError(t, err)
+
+	keyFile := filepath.Join(t.TempDir(), "private.key")
+	require.NoError(t, os.WriteFile(keyFile, private, 0600))
+
+	encrypter, err := crypto.NewHybridEncrypter(public)
+	require.NoError(t, err)
+	encryptedPassword, err := encrypter.Encrypt("s3cr3t")
+	require.NoError(t, err)
+	encryptedToken, err := encrypter.Encrypt("t0k3n")
+	require.NoError(t, err)
+
+	d, err := newSecretDecrypter(&config.Config{
+		SecretManagement: &config.SecretManagementConfig{PrivateKeyFile: keyFile},
+	})
+	require.NoError(t, err)
+
+	vars, secrets, err := decryptVars(d, map[string]string{
+		"token":    encryptedToken,
+		"password": encryptedPassword,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"password=s3cr3t", "token=t0k3n"}, vars)
+	assert.Equal(t, []string{"s3cr3t", "t0k3n"}, secrets)
+
+	_, _, err = decryptVars(d, map[string]string{"invalid": "not-encrypted"})
+	assert.Error(t, err)
+}
+
+func TestNewSecretDecrypter_NoKey(t *testing.T) {
+	t.Parallel()
+
+	_, err := newSecretDecrypter(&config.Config{})
+	assert.Error(t, err)
+}
+
+func TestMakeEncryption(t *testing.T) {
+	t.Parallel()
+
+	private, public, err := crypto.GenerateRSAPems(2048)
+	require.NoError(t, err)
+
+	keyFile := filepath.Join(t.TempDir(), "private.key")
+	require.NoError(t, os.WriteFile(keyFile, private, 0600))
+
+	encrypter, err := crypto.NewHybridEncrypter(public)
+	require.NoError(t, err)
+	encryptedPassphrase, err := encrypter.Encrypt("s3cr3t-passphrase")
+	require.NoError(t, err)
+
+	cfg := &config.Config{
+		SecretManagement: &config.SecretManagementConfig{PrivateKeyFile: keyFile},
+	}
+	c := &config.EncryptionConfig{
+		KeyProviders: []config.EncryptionKeyProvider{
+			{Type: "pbkdf2", Name: "default", EncryptedPassphrase: encryptedPassphrase},
+			{Type: "external", Name: "kms", Command: []string{"keys"}},
+		},
+		Methods: []config.EncryptionMethod{
+			{Type: "aes_gcm", Name: "default", KeyProvider: "default"},
+			{Type: "aes_gcm", Name: "old", KeyProvider: "kms"},
+		},
+		State: &config.EncryptionTarget{Method: "default", Fallback: "old", Enforced: true},
+	}
+
+	got, err := makeEncryption(cfg, c)
+	require.NoError(t, err)
+	assert.Equal(t, provider.Encryption{
+		KeyProviders: []provider.KeyProvider{
+			{Type: "pbkdf2", Name: "default", Passphrase: "s3cr3t-passphrase"},
+			{Type: "external", Name: "kms", Command: []string{"keys"}},
+		},
+		Methods: []provider.EncryptionMethod{
+			{Type: "aes_gcm", Name: "default", KeyProvider: "default"},
+			{Type: "aes_gcm", Name: "old", KeyProvider: "kms"},
+		},
+		State: &provider.EncryptionTarget{Method: "default", Fallback: "old", Enforced: true},
+	}, got)
+
+	// The passphrase can't be decrypted without secretManagement.
+	_, err = makeEncryption(&config.Config{}, c)
+	assert.Error(t, err)
+}
@@ -0,0 +1,221 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	sdk "github.com/pipe-cd/piped-plugin-sdk-go"
+
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/config"
+)
+
+// stack is a root module which is planned and applied separately.
+// An application without stacks is handled as a single stack which has no name.
+type stack struct {
+	name      string
+	dir       string
+	workspace string
+	// Whether to create the workspace when it doesn't exist.
+	createWorkspace bool
+	vars            []string
+	varFiles        []string
+	dependsOn       []string
+}
+
+// makeStacks returns the stacks of the application after validating the application config.
+func makeStacks(ds sdk.DeploymentSource[config.ApplicationConfigSpec]) ([]stack, error) {
+	spec := ds.ApplicationConfig.Spec
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	if len(spec.Stacks) == 0 {
+		return []stack{{dir: ds.ApplicationDirectory, workspace: spec.Workspace}}, nil
+	}
+
+	stacks := make([]stack, 0, len(spec.Stacks))
+	for _, st := range spec.Stacks {
+		workspace := st.Workspace
+		if workspace == "" {
+			workspace = spec.Workspace
+		}
+		stacks = append(stacks, stack{
+			name:      st.Name,
+			dir:       filepath.Join(ds.ApplicationDirectory, st.Dir),
+			workspace: workspace,
+			vars:      st.Vars,
+			varFiles:  st.VarFiles,
+			dependsOn: st.DependsOn,
+		})
+	}
+	return stacks, nil
+}
+
+type stackStatus string
+
+const (
+	stackStatusSucceeded stackStatus = "succeeded"
+	stackStatusFailed    stackStatus = "failed"
+	stackStatusSkipped   stackStatus = "skipped"
+)
+
+type stackResult struct {
+	name   string
+	status stackStatus
+	detail string
+}
+
+// runStacks calls fn for each stack in the order of their dependencies, and returns the results in the order of the given stacks.
+// The stacks whose dependencies have succeeded run in parallel, and the ones depending on a failed stack are skipped.
+// fn returns a short description of the result which is shown in the summary.
+func runStacks(ctx context.Context, lp sdk.StageLogPersister, stacks []stack, fn func(ctx context.Context, st stack, lp sdk.StageLogPersister) (string, error)) []stackResult {
+	if len(stacks) == 1 && stacks[0].name == "" {
+		detail, err := fn(ctx, stacks[0], lp)
+		if err != nil {
+			return []stackResult{{status: stackStatusFailed, detail: err.Error()}}
+		}
+		return []stackResult{{status: stackStatusSucceeded, detail: detail}}
+	}
+
+	var (
+		results = make([]stackResult, len(stacks))
+		done    = make(map[string]chan struct{}, len(stacks))
+		index   = make(map[string]int, len(stacks))
+		wg      sync.WaitGroup
+	)
+	for i, st := range stacks {
+		done[st.name] = make(chan struct{})
+		index[st.name] = i
+	}
+
+	for i, st := range stacks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(done[st.name])
+
+			results[i] = stackResult{name: st.name, status: stackStatusSkipped}
+			for _, d := range st.dependsOn {
+				<-done[d]
+				if r := results[index[d]]; r.status != stackStatusSucceeded {
+					results[i].detail = fmt.Sprintf("dependency %q %s", d, r.status)
+					lp.Infof("Skipped stack %q because its dependency %q %s", st.name, d, r.status)
+					return
+				}
+			}
+			if ctx.Err() != nil {
+				results[i].detail = "cancelled"
+				return
+			}
+
+			slp := newStackLogPersister(lp, st.name)
+			slp.Infof("Starting stack %q in %s", st.name, st.dir)
+			detail, err := fn(ctx, st, slp)
+			if err != nil {
+				results[i].status = stackStatusFailed
+				results[i].detail = err.Error()
+				return
+			}
+			results[i].status = stackStatusSucceeded
+			results[i].detail = detail
+		}()
+	}
+	wg.Wait()
+
+	if summary := summarizeStacks(results); summary != "" {
+		lp.Infof("Results of the stacks:\n%s", summary)
+	}
+	return results
+}
+
+// stacksSucceeded returns true when all the stacks succeeded.
+func stacksSucceeded(results []stackResult) bool {
+	for _, r := range results {
+		if r.status != stackStatusSucceeded {
+			return false
+		}
+	}
+	return true
+}
+
+func summarizeStacks(results []stackResult) string {
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STACK\tSTATUS\tDETAIL")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.name, r.status, r.detail)
+	}
+	tw.Flush()
+	return buf.String()
+}
+
+// stackLogPersister prefixes every line with the stack name
+// so that the logs of the stacks running in parallel can be told apart.
+type stackLogPersister struct {
+	lp     sdk.StageLogPersister
+	prefix string
+
+	mu          sync.Mutex
+	atLineStart bool
+}
+
+func newStackLogPersister(lp sdk.StageLogPersister, name string) *stackLogPersister {
+	return &stackLogPersister{lp: lp, prefix: "[" + name + "] ", atLineStart: true}
+}
+
+func (s *stackLogPersister) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(string(p), "\n") {
+		if line == "" {
+			continue
+		}
+		if s.atLineStart {
+			b.WriteString(s.prefix)
+		}
+		b.WriteString(line)
+		s.atLineStart = strings.HasSuffix(line, "\n")
+	}
+	if _, err := s.lp.Write([]byte(b.String())); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *stackLogPersister) Info(log string) { s.lp.Info(s.prefix + log) }
+
+func (s *stackLogPersister) Infof(format string, a ...interface{}) {
+	s.lp.Info(s.prefix + fmt.Sprintf(format, a...))
+}
+
+func (s *stackLogPersister) Success(log string) { s.lp.Success(s.prefix + log) }
+
+func (s *stackLogPersister) Successf(format string, a ...interface{}) {
+	s.lp.Success(s.prefix + fmt.Sprintf(format, a...))
+}
+
+func (s *stackLogPersister) Error(log string) { s.lp.Error(s.prefix + log) }
+
+func (s *stackLogPersister) Errorf(format string, a ...interface{}) {
+	s.lp.Error(s.prefix + fmt.Sprintf(format, a...))
+}
@@ -0,0 +1,141 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	sdk "github.com/pipe-cd/piped-plugin-sdk-go"
+	"github.com/pipe-cd/piped-plugin-sdk-go/logpersister/logpersistertest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/config"
+)
+
+func TestMakeStacks(t *testing.T) {
+	t.Parallel()
+
+	ds := sdk.DeploymentSource[config.ApplicationConfigSpec]{
+		ApplicationDirectory: "/app",
+		ApplicationConfig: &sdk.ApplicationConfig[config.ApplicationConfigSpec]{
+			Spec: &config.ApplicationConfigSpec{
+				Workspace: "prod",
+				Stacks: []config.OpenTofuStack{
+					{Name: "network", Dir: "network"},
+					{Name: "app", Dir: "app", Workspace: "app-prod", Vars: []string{"a=b"}, DependsOn: []string{"network"}},
+				},
+			},
+		},
+	}
+	stacks, err := makeStacks(ds)
+	require.NoError(t, err)
+	assert.Equal(t, []stack{
+		{name: "network", dir: "/app/network", workspace: "prod"},
+		{name: "app", dir: "/app/app", workspace: "app-prod", vars: []string{"a=b"}, dependsOn: []string{"network"}},
+	}, stacks)
+
+	ds.ApplicationConfig.Spec.Stacks = nil
+	stacks, err = makeStacks(ds)
+	require.NoError(t, err)
+	assert.Equal(t, []stack{{dir: "/app", workspace: "prod"}}, stacks)
+}
+
+func TestRunStacks(t *testing.T) {
+	t.Parallel()
+
+	stacks := []stack{
+		{name: "app", dependsOn: []string{"network", "data"}},
+		{name: "data", dependsOn: []string{"network"}},
+		{name: "network"},
+		{name: "monitoring"},
+		{name: "dns", dependsOn: []string{"broken"}},
+		{name: "broken"},
+	}
+
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+	results := runStacks(context.Background(), logpersistertest.NewTestLogPersister(t), stacks, func(_ context.Context, st stack, _ sdk.StageLogPersister) (string, error) {
+		mu.Lock()
+		order = append(order, st.name)
+		mu.Unlock()
+		if st.name == "broken" {
+			return "", errors.New("failed")
+		}
+		return "ok", nil
+	})
+
+	assert.Equal(t, []stackResult{
+		{name: "app", status: stackStatusSucceeded, detail: "ok"},
+		{name: "data", status: stackStatusSucceeded, detail: "ok"},
+		{name: "network", status: stackStatusSucceeded, detail: "ok"},
+		{name: "monitoring", status: stackStatusSucceeded, detail: "ok"},
+		{name: "dns", status: stackStatusSkipped, detail: `dependency "broken" failed`},
+		{name: "broken", status: stackStatusFailed, detail: "failed"},
+	}, results)
+	assert.False(t, stacksSucceeded(results))
+
+	indexOf := func(name string) int {
+		for i, n := range order {
+			if n == name {
+				return i
+			}
+		}
+		return -1
+	}
+	assert.Less(t, indexOf("network"), indexOf("data"))
+	assert.Less(t, indexOf("data"), indexOf("app"))
+	assert.Equal(t, -1, indexOf("dns"))
+}
+
+type bufferLogPersister struct {
+	sdk.StageLogPersister
+	buf bytes.Buffer
+}
+
+func (b *bufferLogPersister) Write(p []byte) (int, error) {
+	return b.buf.Write(p)
+}
+
+func (b *bufferLogPersister) Info(log string) {
+	b.buf.WriteString(log)
+}
+
+func (b *bufferLogPersister) Infof(format string, a ...any) {
+	b.Info(fmt.Sprintf(format, a...))
+}
+
+func (b *bufferLogPersister) Errorf(format string, a ...any) {
+	b.Info(fmt.Sprintf(format, a...))
+}
+
+func TestStackLogPersister_Write(t *testing.T) {
+	t.Parallel()
+
+	base := &bufferLogPersister{}
+	lp := newStackLogPersister(base, "network")
+	for _, s := range []string{"tofu plan", "\nline1\nli", "ne2\n"} {
+		_, err := lp.Write([]byte(s))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, "[network] tofu plan\n[network] line1\n[network] line2\n", base.buf.String())
+}
@@ -0,0 +1,575 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"cmp"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	sdk "github.com/pipe-cd/piped-plugin-sdk-go"
+	"github.com/pipe-cd/piped-plugin-sdk-go/logpersister/logpersistertest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/config"
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/provider/providertest"
+)
+
+// recorded returns the recorded output of the fake tofu in testdata/tofu.
+func recorded(t *testing.T, name string, exitCode int) providertest.Response {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "tofu", name))
+	require.NoError(t, err)
+	return providertest.Response{Stdout: string(data), ExitCode: exitCode}
+}
+
+type stageHarness struct {
+	plugin *Plugin
+	runner *providertest.Runner
+	cfg    *config.Config
+	dts    []*sdk.DeployTarget[config.DeployTargetConfig]
+}
+
+func newStageHarness(t *testing.T) *stageHarness {
+	runner := providertest.NewRunner()
+	return &stageHarness{
+		plugin: &Plugin{runner: runner},
+		runner: runner,
+		cfg:    &config.Config{PlanHistoryDir: t.TempDir()},
+		dts:    []*sdk.DeployTarget[config.DeployTargetConfig]{{Name: "dt", Config: config.DeployTargetConfig{}}},
+	}
+}
+
+func (s *stageHarness) input(t *testing.T, stageName, stageConfig, runningCommit string) *sdk.ExecuteStageInput[config.ApplicationConfigSpec] {
+	appDir := t.TempDir()
+	source := func(commit string) sdk.DeploymentSource[config.ApplicationConfigSpec] {
+		if commit == "" {
+			return sdk.DeploymentSource[config.ApplicationConfigSpec]{}
+		}
+		return sdk.DeploymentSource[config.ApplicationConfigSpec]{
+			ApplicationDirectory: appDir,
+			CommitHash:           commit,
+			ApplicationConfig: &sdk.ApplicationConfig[config.ApplicationConfigSpec]{
+				Spec: &config.ApplicationConfigSpec{},
+			},
+		}
+	}
+	return &sdk.ExecuteStageInput[config.ApplicationConfigSpec]{
+		Request: sdk.ExecuteStageRequest[config.ApplicationConfigSpec]{
+			StageName:               stageName,
+			StageConfig:             []byte(stageConfig),
+			RunningDeploymentSource: source(runningCommit),
+			TargetDeploymentSource:  source("target-commit"),
+			Deployment:              sdk.Deployment{ID: "deployment-1", ApplicationID: "app-1"},
+		},
+		Client: sdk.NewClient(nil, "opentofu", "app-1", "stage-1", logpersistertest.NewTestLogPersister(t), nil),
+	}
+}
+
+func (s *stageHarness) execute(t *testing.T, stageName, stageConfig, runningCommit string) sdk.StageStatus {
+	resp, err := s.plugin.ExecuteStage(context.Background(), s.cfg, s.dts, s.input(t, stageName, stageConfig, runningCommit))
+	require.NoError(t, err)
+	return resp.Status
+}
+
+func TestExecuteStage_Plan(t *testing.T) {
+	t.Parallel()
+
+	s := newStageHarness(t)
+	s.runner.
+		On("plan", recorded(t, "plan_changes.jsonl", 2)).
+		On("show", recorded(t, "plan_changes.json", 0))
+
+	status := s.execute(t, stagePlan, `{}`, "")
+	assert.Equal(t, sdk.StageStatusSuccess, status)
+	assert.Equal(t, []string{"version", "init", "plan", "show"}, s.runner.Subcommands())
+
+	// The plan is stored in the history.
+	h, err := newPlanHistory(s.cfg)
+	require.NoError(t, err)
+	rec, err := readRecord(filepath.Join(h.recordDir("app-1", "target-commit", ""), planHistorySummaryFile))
+	require.NoError(t, err)
+	assert.Equal(t, 1, rec.Adds)
+	assert.Equal(t, 1, rec.Destroys)
+	assert.Equal(t, map[string]string{"aws_instance.web": "replace"}, rec.Resources)
+}
+
+func TestExecuteStage_Plan_HistoryUnavailable(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		name        string
+		stageConfig string
+		expected    sdk.StageStatus
+	}{
+		{
+			name:        "the plan is not stored",
+			stageConfig: `{}`,
+			expected:    sdk.StageStatusSuccess,
+		},
+		{
+			name:        "the plan is required for the comparison",
+			stageConfig: `{"compareWithLastApplied": true}`,
+			expected:    sdk.StageStatusFailure,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			// The plan history directory can't be created under a file.
+			file := filepath.Join(t.TempDir(), "file")
+			require.NoError(t, os.WriteFile(file, nil, 0600))
+
+			s := newStageHarness(t)
+			s.cfg.PlanHistoryDir = filepath.Join(file, "plans")
+			s.runner.
+				On("plan", recorded(t, "plan_changes.jsonl", 2)).
+				On("show", recorded(t, "plan_changes.json", 0))
+
+			assert.Equal(t, tc.expected, s.execute(t, stagePlan, tc.stageConfig, ""))
+		})
+	}
+}
+
+func TestExecuteStage_Plan_NoChanges(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		name        string
+		stageConfig string
+		expected    sdk.StageStatus
+	}{
+		{
+			name:        "continue the pipeline",
+			stageConfig: `{}`,
+			expected:    sdk.StageStatusSuccess,
+		},
+		{
+			name:        "exit the pipeline",
+			stageConfig: `{"exitOnNoChanges": true}`,
+			expected:    sdk.StageStatusExited,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := newStageHarness(t)
+			s.runner.
+				On("plan", recorded(t, "plan_no_changes.jsonl", 0)).
+				On("show", recorded(t, "plan_no_changes.json", 0))
+
+			assert.Equal(t, tc.expected, s.execute(t, stagePlan, tc.stageConfig, ""))
+		})
+	}
+}
+
+func TestExecuteStage_Plan_Failed(t *testing.T) {
+	t.Parallel()
+
+	s := newStageHarness(t)
+	s.runner.On("plan", providertest.Response{Stderr: "Error: Invalid reference", ExitCode: 1})
+
+	assert.Equal(t, sdk.StageStatusFailure, s.execute(t, stagePlan, `{}`, ""))
+	assert.Equal(t, []string{"version", "init", "plan"}, s.runner.Subcommands())
+}
+
+func TestExecuteStage_Apply(t *testing.T) {
+	t.Parallel()
+
+	s := newStageHarness(t)
+	s.runner.On("apply", recorded(t, "apply.jsonl", 0))
+
+	// The plan stored by the plan stage is marked as applied.
+	h, err := newPlanHistory(s.cfg)
+	require.NoError(t, err)
+	_, err = h.save(planRecord{ApplicationID: "app-1", CommitHash: "target-commit", PlannedAt: time.Now()}, "", nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, sdk.StageStatusSuccess, s.execute(t, stageApply, `{}`, "running-commit"))
+	assert.Equal(t, []string{"version", "init", "apply"}, s.runner.Subcommands())
+
+	applied, err := h.applied("app-1", "")
+	require.NoError(t, err)
+	require.Len(t, applied, 1)
+	assert.Equal(t, "target-commit", applied[0].CommitHash)
+}
+
+func TestExecuteStage_Apply_LockContention(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		name                string
+		stageConfig         string
+		expected            sdk.StageStatus
+		expectedSubcommands []string
+	}{
+		{
+			name:                "fail without retry",
+			stageConfig:         `{}`,
+			expected:            sdk.StageStatusFailure,
+			expectedSubcommands: []string{"version", "init", "apply"},
+		},
+		{
+			name:                "retry after the lock is released",
+			stageConfig:         `{"retry": {"maxAttempts": 2, "backoff": "1ms", "retryableErrors": ["state lock"]}}`,
+			expected:            sdk.StageStatusSuccess,
+			expectedSubcommands: []string{"version", "init", "apply", "plan", "show", "apply"},
+		},
+		{
+			name:                "not retry other errors",
+			stageConfig:         `{"retry": {"maxAttempts": 2, "backoff": "1ms", "retryableErrors": ["ThrottlingException"]}}`,
+			expected:            sdk.StageStatusFailure,
+			expectedSubcommands: []string{"version", "init", "apply"},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := newStageHarness(t)
+			s.runner.
+				On("apply", recorded(t, "apply_locked.jsonl", 1), recorded(t, "apply.jsonl", 0)).
+				On("plan", recorded(t, "plan_changes.jsonl", 2)).
+				On("show", recorded(t, "plan_changes.json", 0))
+
+			assert.Equal(t, tc.expected, s.execute(t, stageApply, tc.stageConfig, "running-commit"))
+			assert.Equal(t, tc.expectedSubcommands, s.runner.Subcommands())
+		})
+	}
+}
+
+func TestExecuteStage_Rollback(t *testing.T) {
+	t.Parallel()
+
+	t.Run("apply the previous commit", func(t *testing.T) {
+		t.Parallel()
+
+		s := newStageHarness(t)
+		s.runner.On("apply", recorded(t, "apply.jsonl", 0))
+
+		// The running deployment source is applied instead of the target one.
+		input := s.input(t, stageRollback, `{}`, "running-commit")
+		runningDir := t.TempDir()
+		input.Request.RunningDeploymentSource.ApplicationDirectory = runningDir
+		input.Request.RunningDeploymentSource.ApplicationConfig = &sdk.ApplicationConfig[config.ApplicationConfigSpec]{
+			Spec: &config.ApplicationConfigSpec{Vars: []string{"image=v1"}},
+		}
+		resp, err := s.plugin.ExecuteStage(context.Background(), s.cfg, s.dts, input)
+		require.NoError(t, err)
+		assert.Equal(t, sdk.StageStatusSuccess, resp.Status)
+		assert.Equal(t, []string{"version", "init", "apply"}, s.runner.Subcommands())
+
+		for _, c := range s.runner.Calls() {
+			assert.Equal(t, runningDir, c.Dir)
+		}
+		apply := s.runner.Calls()[2]
+		require.Len(t, apply.VarFiles, 1)
+		assert.JSONEq(t, `{"image": "v1"}`, apply.VarFiles[0])
+	})
+
+	t.Run("retry with the rollback options", func(t *testing.T) {
+		t.Parallel()
+
+		s := newStageHarness(t)
+		s.runner.
+			On("apply", recorded(t, "apply_locked.jsonl", 1), recorded(t, "apply.jsonl", 0)).
+			On("plan", recorded(t, "plan_changes.jsonl", 2)).
+			On("show", recorded(t, "plan_changes.json", 0))
+
+		input := s.input(t, stageRollback, `{}`, "running-commit")
+		input.Request.RunningDeploymentSource.ApplicationConfig = &sdk.ApplicationConfig[config.ApplicationConfigSpec]{
+			Spec: &config.ApplicationConfigSpec{
+				Rollback: config.OpenTofuRollbackStageOptions{
+					Retry: config.OpenTofuRetryOptions{MaxAttempts: 2, Backoff: config.Duration(time.Millisecond), RetryableErrors: []string{"state lock"}},
+				},
+			},
+		}
+		resp, err := s.plugin.ExecuteStage(context.Background(), s.cfg, s.dts, input)
+		require.NoError(t, err)
+		assert.Equal(t, sdk.StageStatusSuccess, resp.Status)
+		assert.Equal(t, []string{"version", "init", "apply", "plan", "show", "apply"}, s.runner.Subcommands())
+	})
+
+	t.Run("fail on the first deployment", func(t *testing.T) {
+		t.Parallel()
+
+		s := newStageHarness(t)
+		assert.Equal(t, sdk.StageStatusFailure, s.execute(t, stageRollback, `{}`, ""))
+		assert.Empty(t, s.runner.Calls())
+	})
+
+	t.Run("fail when the apply fails", func(t *testing.T) {
+		t.Parallel()
+
+		s := newStageHarness(t)
+		s.runner.On("apply", recorded(t, "apply_locked.jsonl", 1))
+
+		assert.Equal(t, sdk.StageStatusFailure, s.execute(t, stageRollback, `{}`, "running-commit"))
+	})
+}
+
+func TestExecuteStage_Credentials(t *testing.T) {
+	t.Parallel()
+
+	s := newStageHarness(t)
+	s.dts[0].Config.Credentials = &config.CredentialsConfig{
+		AWS: &config.AWSCredentials{RoleARN: "arn:aws:iam::123456789012:role/deploy"},
+	}
+	s.runner.On("apply", recorded(t, "apply.jsonl", 0))
+
+	assert.Equal(t, sdk.StageStatusSuccess, s.execute(t, stageApply, `{}`, "running-commit"))
+
+	// Every command uses the generated config file, which is removed after the stage.
+	var configFile string
+	for _, c := range s.runner.Calls() {
+		assert.Contains(t, c.Env, "AWS_PROFILE="+awsAssumeRoleProfile)
+		for _, e := range c.Env {
+			if v, ok := strings.CutPrefix(e, "AWS_CONFIG_FILE="); ok {
+				configFile = v
+			}
+		}
+	}
+	require.NotEmpty(t, configFile)
+	assert.NoFileExists(t, configFile)
+}
+
+func TestExecuteStage_Test_Terraform(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		name           string
+		version        string
+		expectedStatus sdk.StageStatus
+		expectedCalls  []string
+	}{
+		{
+			name:           "terraform supporting the test framework",
+			version:        "Terraform v1.9.8\non linux_amd64",
+			expectedStatus: sdk.StageStatusSuccess,
+			expectedCalls:  []string{"version", "init", "version", "test"},
+		},
+		{
+			name:           "terraform older than the test framework",
+			version:        "Terraform v1.5.7\non linux_amd64",
+			expectedStatus: sdk.StageStatusFailure,
+			expectedCalls:  []string{"version", "init", "version"},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := newStageHarness(t)
+			s.runner.On("version", providertest.Response{Stdout: tc.version})
+
+			input := s.input(t, stageTest, `{}`, "")
+			input.Request.TargetDeploymentSource.ApplicationConfig.Spec.Engine = config.EngineTerraform
+			resp, err := s.plugin.ExecuteStage(context.Background(), s.cfg, s.dts, input)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedStatus, resp.Status)
+			assert.Equal(t, tc.expectedCalls, s.runner.Subcommands())
+		})
+	}
+}
+
+func TestExecuteStage_Variables(t *testing.T) {
+	t.Parallel()
+
+	s := newStageHarness(t)
+	s.dts[0].Config.Vars = []string{"region=us-east-1"}
+	s.dts[0].Config.Variables = map[string]any{"azs": []any{"a", "b"}, "region": "us-west-2"}
+	s.runner.On("apply", recorded(t, "apply.jsonl", 0))
+
+	input := s.input(t, stageApply, `{}`, "running-commit")
+	input.Request.TargetDeploymentSource.ApplicationConfig.Spec.VarFiles = []string{"prod.tfvars"}
+	resp, err := s.plugin.ExecuteStage(context.Background(), s.cfg, s.dts, input)
+	require.NoError(t, err)
+	assert.Equal(t, sdk.StageStatusSuccess, resp.Status)
+
+	// The vars and variables are passed with the same var file after the other var files.
+	calls := s.runner.Calls()
+	require.Len(t, calls[2].VarFiles, 2)
+	assert.JSONEq(t, `{"region": "us-east-1", "azs": ["a", "b"]}`, calls[2].VarFiles[1])
+	assert.Equal(t, "-var-file=prod.tfvars", calls[2].Args[len(calls[2].Args)-2])
+
+	// Nothing is written to the application directory.
+	entries, err := os.ReadDir(input.Request.TargetDeploymentSource.ApplicationDirectory)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestExecuteStage_PullRequest(t *testing.T) {
+	t.Parallel()
+
+	pullRequestInput := func(s *stageHarness, t *testing.T, stageName string, labels map[string]string) *sdk.ExecuteStageInput[config.ApplicationConfigSpec] {
+		input := s.input(t, stageName, `{}`, "running-commit")
+		input.Request.TargetDeploymentSource.ApplicationConfig.Spec.PullRequestEnvironment = &config.OpenTofuPullRequestEnvironment{}
+		input.Request.Deployment.Labels = labels
+		return input
+	}
+	labels := map[string]string{"pull-request": "12", "branch": "feature/login"}
+
+	t.Run("apply to the workspace of the pull request", func(t *testing.T) {
+		t.Parallel()
+
+		s := newStageHarness(t)
+		s.runner.
+			On("apply", recorded(t, "apply.jsonl", 0)).
+			On("output", providertest.Response{Stdout: `{"url": {"sensitive": false, "value": "https://pr-12.example.com"}}`})
+
+		resp, err := s.plugin.ExecuteStage(context.Background(), s.cfg, s.dts, pullRequestInput(s, t, stageApply, labels))
+		require.NoError(t, err)
+		assert.Equal(t, sdk.StageStatusSuccess, resp.Status)
+
+		calls := s.runner.Calls()
+		assert.Equal(t, []string{"version", "init", "workspace", "apply", "output"}, s.runner.Subcommands())
+		assert.Equal(t, []string{"workspace", "select", "-or-create=true", "pr-12"}, calls[2].Args)
+		require.Len(t, calls[3].VarFiles, 1)
+		assert.JSONEq(t, `{"pull_request_number": "12", "pull_request_branch": "feature/login"}`, calls[3].VarFiles[0])
+	})
+
+	t.Run("destroy the environment and delete the workspace", func(t *testing.T) {
+		t.Parallel()
+
+		s := newStageHarness(t)
+		s.runner.
+			On("workspace list", providertest.Response{Stdout: "* default\n  pr-12\n  pr-13\n"}).
+			On("apply", recorded(t, "apply.jsonl", 0))
+
+		resp, err := s.plugin.ExecuteStage(context.Background(), s.cfg, s.dts, pullRequestInput(s, t, stagePullRequestCleanup, labels))
+		require.NoError(t, err)
+		assert.Equal(t, sdk.StageStatusSuccess, resp.Status)
+
+		calls := s.runner.Calls()
+		require.Len(t, calls, 7)
+		assert.Equal(t, []string{"workspace", "list"}, calls[2].Args)
+		assert.Equal(t, []string{"workspace", "select", "pr-12"}, calls[3].Args)
+		assert.Contains(t, calls[4].Args, "-destroy")
+		assert.Equal(t, []string{"workspace", "select", "default"}, calls[5].Args)
+		assert.Equal(t, []string{"workspace", "delete", "pr-12"}, calls[6].Args)
+	})
+
+	t.Run("nothing to clean up when the workspace doesn't exist", func(t *testing.T) {
+		t.Parallel()
+
+		s := newStageHarness(t)
+		s.runner.On("workspace list", providertest.Response{Stdout: "* default\n  pr-13\n"})
+
+		resp, err := s.plugin.ExecuteStage(context.Background(), s.cfg, s.dts, pullRequestInput(s, t, stagePullRequestCleanup, labels))
+		require.NoError(t, err)
+		assert.Equal(t, sdk.StageStatusSuccess, resp.Status)
+
+		// The workspace is neither created nor destroyed.
+		assert.Equal(t, []string{"version", "init", "workspace"}, s.runner.Subcommands())
+		assert.Equal(t, []string{"workspace", "list"}, s.runner.Calls()[2].Args)
+	})
+
+	t.Run("refuse to clean up the deployment not for a pull request", func(t *testing.T) {
+		t.Parallel()
+
+		s := newStageHarness(t)
+		resp, err := s.plugin.ExecuteStage(context.Background(), s.cfg, s.dts, pullRequestInput(s, t, stagePullRequestCleanup, nil))
+		require.NoError(t, err)
+		assert.Equal(t, sdk.StageStatusFailure, resp.Status)
+		assert.Empty(t, s.runner.Calls())
+	})
+}
+
+func TestExecuteStage_Refresh(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		name          string
+		appConfig     string
+		stageConfig   string
+		expected      sdk.StageStatus
+		expectedCalls [][]string
+	}{
+		{
+			name:        "apply at once",
+			stageConfig: `{}`,
+			expected:    sdk.StageStatusSuccess,
+			expectedCalls: [][]string{
+				{"apply", "-auto-approve", "-input=false", "-json", "-refresh-only"},
+			},
+		},
+		{
+			name:        "apply in waves",
+			stageConfig: `{"waves": [{"targets": ["module.network"]}]}`,
+			expected:    sdk.StageStatusSuccess,
+			expectedCalls: [][]string{
+				{"apply", "-auto-approve", "-input=false", "-json", "-refresh-only", "-target=module.network"},
+				{"apply", "-auto-approve", "-input=false", "-json", "-refresh-only"},
+			},
+		},
+		{
+			name:        "invalid waves are rejected as in the apply stage",
+			stageConfig: `{"waves": [{"name": "empty"}]}`,
+			expected:    sdk.StageStatusFailure,
+		},
+		{
+			name:        "fail without approval",
+			appConfig:   "no_approval.pipecd.yaml",
+			stageConfig: `{}`,
+			expected:    sdk.StageStatusFailure,
+		},
+		{
+			name:        "skip the approval check",
+			appConfig:   "no_approval.pipecd.yaml",
+			stageConfig: `{"skipApprovalCheck": true}`,
+			expected:    sdk.StageStatusSuccess,
+			expectedCalls: [][]string{
+				{"apply", "-auto-approve", "-input=false", "-json", "-refresh-only"},
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := newStageHarness(t)
+			s.runner.
+				On("plan", recorded(t, "plan_changes.jsonl", 2)).
+				On("show", recorded(t, "plan_changes.json", 0))
+
+			input := s.input(t, stageRefresh, tc.stageConfig, "")
+			appConfig := cmp.Or(tc.appConfig, "approval.pipecd.yaml")
+			input.Request.TargetDeploymentSource.ApplicationConfig = sdk.LoadApplicationConfigForTest[config.ApplicationConfigSpec](t, filepath.Join("testdata", "refresh", appConfig), "opentofu")
+			resp, err := s.plugin.ExecuteStage(context.Background(), s.cfg, s.dts, input)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, resp.Status)
+
+			var applies [][]string
+			for _, c := range s.runner.Calls() {
+				if c.Args[0] == "apply" {
+					applies = append(applies, c.Args)
+				}
+			}
+			assert.Equal(t, tc.expectedCalls, applies)
+		})
+	}
+}
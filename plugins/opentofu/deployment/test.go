@@ -0,0 +1,88 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	sdk "github.com/pipe-cd/piped-plugin-sdk-go"
+
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/config"
+)
+
+func (p *Plugin) executeTestStage(ctx context.Context, cfg *config.Config, input *sdk.ExecuteStageInput[config.ApplicationConfigSpec], dts []*sdk.DeployTarget[config.DeployTargetConfig]) sdk.StageStatus {
+	lp := input.Client.LogPersister()
+
+	var stageConfig config.OpenTofuTestStageOptions
+	if err := json.Unmarshal(input.Request.StageConfig, &stageConfig); err != nil {
+		lp.Errorf("Failed to unmarshal stage config (%v)", err)
+		return sdk.StageStatusFailure
+	}
+	if err := validateVars(stageConfig.Vars); err != nil {
+		lp.Errorf("Invalid vars (%v)", err)
+		return sdk.StageStatusFailure
+	}
+
+	stacks, err := makeStacks(input.Request.TargetDeploymentSource)
+	if err != nil {
+		lp.Errorf("Invalid application config (%v)", err)
+		return sdk.StageStatusFailure
+	}
+
+	ctx, cancel := withStageTimeout(ctx, stageConfig.Timeout)
+	defer cancel()
+
+	results := runStacks(ctx, lp, stacks, func(ctx context.Context, st stack, lp sdk.StageLogPersister) (string, error) {
+		// The vars for the tests are passed after the vars of the stack to take precedence over them.
+		st.vars = append(slices.Clone(st.vars), stageConfig.Vars...)
+		cmd, cleanup, err := p.initOpenTofuCommand(ctx, input.Client, lp, cfg, input.Request.TargetDeploymentSource, dts[0], st)
+		if err != nil {
+			return "", err
+		}
+		defer cleanup()
+
+		if err := cmd.CheckTestSupported(ctx); err != nil {
+			lp.Errorf("Unable to run the tests (%v)", err)
+			return "", err
+		}
+
+		result, err := cmd.Test(ctx, lp, stageConfig.Filter)
+		if summary := result.Summary(); summary != "" {
+			lp.Infof("Results of the tests:\n%s", summary)
+		}
+		if result.Failed() {
+			lp.Errorf("The following tests failed:\n%s", result.Failures())
+			return "", errors.New("some tests failed")
+		}
+		if err != nil {
+			lp.Errorf("Failed to execute tests (%v)", err)
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				lp.Errorf("The stage timed out after %s", stageConfig.Timeout.Duration())
+			}
+			return "", err
+		}
+
+		lp.Success("All tests passed")
+		return fmt.Sprintf("%d test files passed", len(result.Files)), nil
+	})
+	if !stacksSucceeded(results) {
+		return sdk.StageStatusFailure
+	}
+	return sdk.StageStatusSuccess
+}
@@ -0,0 +1,107 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	sdk "github.com/pipe-cd/piped-plugin-sdk-go"
+
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/config"
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/provider"
+)
+
+func (p *Plugin) executeValidateStage(ctx context.Context, cfg *config.Config, input *sdk.ExecuteStageInput[config.ApplicationConfigSpec], dts []*sdk.DeployTarget[config.DeployTargetConfig]) sdk.StageStatus {
+	lp := input.Client.LogPersister()
+
+	var stageConfig config.OpenTofuValidateStageOptions
+	if err := json.Unmarshal(input.Request.StageConfig, &stageConfig); err != nil {
+		lp.Errorf("Failed to unmarshal stage config (%v)", err)
+		return sdk.StageStatusFailure
+	}
+
+	stacks, err := makeStacks(input.Request.TargetDeploymentSource)
+	if err != nil {
+		lp.Errorf("Invalid application config (%v)", err)
+		return sdk.StageStatusFailure
+	}
+
+	ctx, cancel := withStageTimeout(ctx, stageConfig.Timeout)
+	defer cancel()
+
+	results := runStacks(ctx, lp, stacks, func(ctx context.Context, st stack, lp sdk.StageLogPersister) (string, error) {
+		cmd, cleanup, err := p.newOpenTofuCommand(ctx, input.Client, lp, cfg, input.Request.TargetDeploymentSource, dts[0], st)
+		if err != nil {
+			return "", err
+		}
+		defer cleanup()
+
+		// The backend is not initialized not to access the state before the configuration is validated.
+		if err := cmd.Init(ctx, lp, "-backend=false"); err != nil {
+			lp.Errorf("Failed to execute 'tofu init' (%v)", err)
+			return "", err
+		}
+		return validateStack(ctx, lp, cmd, stageConfig)
+	})
+	if !stacksSucceeded(results) {
+		return sdk.StageStatusFailure
+	}
+	return sdk.StageStatusSuccess
+}
+
+func validateStack(ctx context.Context, lp sdk.StageLogPersister, cmd *provider.OpenTofu, stageConfig config.OpenTofuValidateStageOptions) (string, error) {
+	result, err := cmd.Validate(ctx, lp)
+	if err != nil {
+		lp.Errorf("Failed to execute 'tofu validate' (%v)", err)
+		return "", err
+	}
+	for _, d := range result.Diagnostics {
+		if d.Severity == "warning" {
+			lp.Info(d.StringWithSnippet())
+		} else {
+			lp.Error(d.StringWithSnippet())
+		}
+	}
+
+	files, err := cmd.FormatCheck(ctx, lp)
+	if err != nil {
+		lp.Errorf("Failed to execute 'tofu fmt' (%v)", err)
+		return "", err
+	}
+	if len(files) > 0 {
+		msg := fmt.Sprintf("The following files are not formatted. Run %q to format them:\n  %s", cmd.Engine().Command()+" fmt -recursive", strings.Join(files, "\n  "))
+		if stageConfig.FailOnFormatIssues {
+			lp.Error(msg)
+		} else {
+			lp.Info(msg)
+		}
+	}
+
+	switch {
+	case !result.Valid || result.ErrorCount > 0:
+		return "", fmt.Errorf("%d errors, %d warnings", result.ErrorCount, result.WarningCount)
+	case stageConfig.FailOnWarnings && result.WarningCount > 0:
+		return "", fmt.Errorf("%d warnings", result.WarningCount)
+	case stageConfig.FailOnFormatIssues && len(files) > 0:
+		return "", errors.New("some files are not formatted")
+	}
+
+	lp.Successf("The configuration is valid with %d warnings and %d files to be formatted", result.WarningCount, len(files))
+	return fmt.Sprintf("%d warnings, %d files to be formatted", result.WarningCount, len(files)), nil
+}
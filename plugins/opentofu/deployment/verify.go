@@ -0,0 +1,124 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	sdk "github.com/pipe-cd/piped-plugin-sdk-go"
+
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/config"
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/provider"
+)
+
+// errNotConverged is returned when the infrastructure doesn't match the configuration or a check fails.
+var errNotConverged = errors.New("not converged")
+
+func (p *Plugin) executeVerifyStage(ctx context.Context, cfg *config.Config, input *sdk.ExecuteStageInput[config.ApplicationConfigSpec], dts []*sdk.DeployTarget[config.DeployTargetConfig]) sdk.StageStatus {
+	lp := input.Client.LogPersister()
+
+	var stageConfig config.OpenTofuVerifyStageOptions
+	if err := json.Unmarshal(input.Request.StageConfig, &stageConfig); err != nil {
+		lp.Errorf("Failed to unmarshal stage config (%v)", err)
+		return sdk.StageStatusFailure
+	}
+
+	// Not converged is always retryable since it's what the retry of this stage is for.
+	retry, err := newRetryPolicy(stageConfig.Retry, errNotConverged)
+	if err != nil {
+		lp.Errorf("Invalid retry options (%v)", err)
+		return sdk.StageStatusFailure
+	}
+
+	stacks, _, err := makeDeploymentStacks(lp, input.Request.TargetDeploymentSource, input.Request.Deployment)
+	if err != nil {
+		lp.Errorf("Invalid application config (%v)", err)
+		return sdk.StageStatusFailure
+	}
+
+	ctx, cancel := withStageTimeout(ctx, stageConfig.Timeout)
+	defer cancel()
+
+	results := runStacks(ctx, lp, stacks, func(ctx context.Context, st stack, lp sdk.StageLogPersister) (string, error) {
+		cmd, cleanup, err := p.initOpenTofuCommand(ctx, input.Client, lp, cfg, input.Request.TargetDeploymentSource, dts[0], st)
+		if err != nil {
+			return "", err
+		}
+		defer cleanup()
+
+		err = retry.do(ctx, lp, "verify", func(int) ([]provider.Diagnostic, error) {
+			return verifyStack(ctx, lp, cmd)
+		})
+		if err != nil {
+			if errors.Is(err, errGaveUp) {
+				lp.Errorf("Gave up verifying (%v)", err)
+			} else {
+				lp.Errorf("Failed to verify (%v)", err)
+			}
+			return "", err
+		}
+		lp.Success("The infrastructure has converged and all checks passed")
+		return "converged", nil
+	})
+	if !stacksSucceeded(results) {
+		return sdk.StageStatusFailure
+	}
+	return sdk.StageStatusSuccess
+}
+
+// verifyStack runs a fresh plan and returns an error wrapping errNotConverged when it has changes or a check fails.
+// The checks are taken from both the plan and the state, so that the ones evaluated only while applying are also verified.
+func verifyStack(ctx context.Context, lp sdk.StageLogPersister, cmd *provider.OpenTofu) ([]provider.Diagnostic, error) {
+	planResult, err := cmd.Plan(ctx, lp)
+	if err != nil {
+		return planResult.Diagnostics, err
+	}
+
+	state, err := cmd.ShowState(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to show the state: %w", err)
+	}
+	var planChecks []provider.CheckResult
+	if planResult.Plan != nil {
+		planChecks = planResult.Plan.Checks
+	}
+	failures := provider.FailedChecks(provider.MergeChecks(state.Checks, planChecks))
+
+	var reasons []string
+	if !planResult.NoChanges() {
+		if diff, err := planResult.Render(); err != nil {
+			lp.Errorf("Failed to render the pending changes (%v)", err)
+		} else if diff != "" {
+			lp.Infof("Pending changes:\n%s", diff)
+		}
+		reasons = append(reasons, fmt.Sprintf("%d import, %d add, %d change, %d destroy pending", planResult.Imports, planResult.Adds, planResult.Changes, planResult.Destroys))
+	}
+	if len(failures) > 0 {
+		var b strings.Builder
+		for _, f := range failures {
+			fmt.Fprintf(&b, "  %s\n", f)
+		}
+		lp.Errorf("Found %d failed check(s):\n%s", len(failures), b.String())
+		reasons = append(reasons, fmt.Sprintf("%d failed check(s)", len(failures)))
+	}
+	if len(reasons) > 0 {
+		return nil, fmt.Errorf("%w: %s", errNotConverged, strings.Join(reasons, ", "))
+	}
+	return nil, nil
+}
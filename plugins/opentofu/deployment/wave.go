@@ -0,0 +1,76 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	sdk "github.com/pipe-cd/piped-plugin-sdk-go"
+
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/config"
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/provider"
+)
+
+// applyWaves applies the changes wave by wave with the "-target" flag, and verifies each wave before the next one.
+// After the last wave, it applies without targets to apply the remaining changes and confirm the convergence.
+// The given flags are passed to every apply.
+func applyWaves(ctx context.Context, lp sdk.StageLogPersister, cmd *provider.OpenTofu, retry *retryPolicy, dir string, waves []config.OpenTofuApplyWave, flags ...string) error {
+	for i, w := range waves {
+		name := waveName(i, w)
+		lp.Infof("Applying %s (%d/%d) targeting %s", name, i+1, len(waves), strings.Join(w.Targets, ", "))
+
+		waveFlags := append(make([]string, 0, len(flags)+len(w.Targets)), flags...)
+		for _, t := range w.Targets {
+			waveFlags = append(waveFlags, "-target="+t)
+		}
+		if err := applyWithRetry(ctx, lp, cmd, retry, waveFlags...); err != nil {
+			return fmt.Errorf("failed to apply %s: %w", name, err)
+		}
+
+		if w.Verify != "" {
+			lp.Infof("Verifying %s by %q", name, w.Verify)
+			if err := runVerifyCommand(ctx, lp, dir, w.Verify); err != nil {
+				lp.Errorf("Verification of %s failed (%v). The following waves are not applied", name, err)
+				return fmt.Errorf("verification of %s failed: %w", name, err)
+			}
+			lp.Successf("Verified %s", name)
+		}
+	}
+
+	lp.Info("Applying without targets to confirm all changes are applied")
+	if err := applyWithRetry(ctx, lp, cmd, retry, flags...); err != nil {
+		return fmt.Errorf("failed to apply the remaining changes: %w", err)
+	}
+	return nil
+}
+
+func waveName(index int, w config.OpenTofuApplyWave) string {
+	if w.Name != "" {
+		return fmt.Sprintf("wave %q", w.Name)
+	}
+	return fmt.Sprintf("wave-%d", index+1)
+}
+
+// runVerifyCommand executes the given shell command in the directory and writes its output to the log.
+func runVerifyCommand(ctx context.Context, lp sdk.StageLogPersister, dir, command string) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = dir
+	cmd.Stdout = lp
+	cmd.Stderr = lp
+	return cmd.Run()
+}
@@ -0,0 +1,99 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pipe-cd/piped-plugin-sdk-go/logpersister/logpersistertest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/config"
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/provider"
+)
+
+func TestApplyWaves(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		name          string
+		waves         []config.OpenTofuApplyWave
+		flags         []string
+		expectedCalls []string
+		expectedErr   bool
+	}{
+		{
+			name: "all waves succeed",
+			waves: []config.OpenTofuApplyWave{
+				{Name: "network", Targets: []string{"module.network"}, Verify: "true"},
+				{Targets: []string{"module.app", "aws_instance.web"}},
+			},
+			expectedCalls: []string{
+				"apply -auto-approve -input=false -target=module.network",
+				"apply -auto-approve -input=false -target=module.app -target=aws_instance.web",
+				"apply -auto-approve -input=false",
+			},
+		},
+		{
+			name: "the flags are passed to every apply",
+			waves: []config.OpenTofuApplyWave{
+				{Targets: []string{"module.network"}},
+			},
+			flags: []string{"-refresh-only"},
+			expectedCalls: []string{
+				"apply -auto-approve -input=false -refresh-only -target=module.network",
+				"apply -auto-approve -input=false -refresh-only",
+			},
+		},
+		{
+			name: "verification fails",
+			waves: []config.OpenTofuApplyWave{
+				{Targets: []string{"module.network"}, Verify: "exit 1"},
+				{Targets: []string{"module.app"}},
+			},
+			expectedCalls: []string{
+				"apply -auto-approve -input=false -target=module.network",
+			},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			calls := filepath.Join(dir, "calls")
+			script := filepath.Join(dir, "tofu")
+			require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" >> "+calls+"\n"), 0755))
+
+			retry, err := newRetryPolicy(config.OpenTofuRetryOptions{})
+			require.NoError(t, err)
+
+			cmd := provider.NewOpenTofu(script, dir)
+			err = applyWaves(context.Background(), logpersistertest.NewTestLogPersister(t), cmd, retry, dir, tc.waves, tc.flags...)
+			assert.Equal(t, tc.expectedErr, err != nil)
+
+			data, err := os.ReadFile(calls)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedCalls, strings.Split(strings.TrimSpace(string(data)), "\n"))
+		})
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// CheckStatus represents the result of a checkable object.
+type CheckStatus string
+
+const (
+	CheckStatusPass    CheckStatus = "pass"
+	CheckStatusFail    CheckStatus = "fail"
+	CheckStatusError   CheckStatus = "error"
+	CheckStatusUnknown CheckStatus = "unknown"
+)
+
+// Failed returns true when the check failed or errored.
+func (s CheckStatus) Failed() bool {
+	return s == CheckStatusFail || s == CheckStatusError
+}
+
+// CheckResult represents the result of a checkable object,
+// which is a check block, or a resource or an output with preconditions or postconditions.
+type CheckResult struct {
+	Address   CheckAddress    `json:"address"`
+	Status    CheckStatus     `json:"status"`
+	Instances []CheckInstance `json:"instances,omitempty"`
+}
+
+// CheckAddress represents the address of a checkable object or its instance.
+type CheckAddress struct {
+	// One of "resource", "output_value" or "check".
+	Kind      string `json:"kind,omitempty"`
+	ToDisplay string `json:"to_display"`
+}
+
+// CheckInstance represents the result of an instance of a checkable object.
+type CheckInstance struct {
+	Address  CheckAddress   `json:"address"`
+	Status   CheckStatus    `json:"status"`
+	Problems []CheckProblem `json:"problems,omitempty"`
+}
+
+// CheckProblem represents a failed assertion.
+type CheckProblem struct {
+	Message string `json:"message"`
+}
+
+// CheckFailure represents a failed assertion of a checkable object instance.
+type CheckFailure struct {
+	Address string
+	Status  CheckStatus
+	Message string
+}
+
+func (f CheckFailure) String() string {
+	if f.Message == "" {
+		return fmt.Sprintf("%s: %s", f.Address, f.Status)
+	}
+	return fmt.Sprintf("%s: %s: %s", f.Address, f.Status, f.Message)
+}
+
+// State represents the state output by "tofu show -json".
+// Only the fields used by the plugin are defined.
+type State struct {
+	FormatVersion string `json:"format_version"`
+	// The results of the check blocks and the conditions evaluated by the last apply.
+	Checks []CheckResult `json:"checks,omitempty"`
+}
+
+func parseState(data []byte) (*State, error) {
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// MergeChecks merges the results of the checks evaluated by a plan into the ones recorded in the state.
+// The results of the plan take precedence unless they are unknown, for example because they depend on the values known after apply.
+func MergeChecks(state, plan []CheckResult) []CheckResult {
+	merged := make([]CheckResult, 0, len(state)+len(plan))
+	index := make(map[string]int, len(state))
+	for _, c := range state {
+		index[c.Address.ToDisplay] = len(merged)
+		merged = append(merged, c)
+	}
+	for _, c := range plan {
+		i, ok := index[c.Address.ToDisplay]
+		switch {
+		case !ok:
+			index[c.Address.ToDisplay] = len(merged)
+			merged = append(merged, c)
+		case c.Status != CheckStatusUnknown:
+			merged[i] = c
+		}
+	}
+	return merged
+}
+
+// FailedChecks returns the failed assertions of the given checks with the addresses of the instances.
+func FailedChecks(checks []CheckResult) []CheckFailure {
+	var failures []CheckFailure
+	for _, c := range checks {
+		if !c.Status.Failed() {
+			continue
+		}
+		found := false
+		for _, inst := range c.Instances {
+			if !inst.Status.Failed() {
+				continue
+			}
+			found = true
+			address := inst.Address.ToDisplay
+			if address == "" {
+				address = c.Address.ToDisplay
+			}
+			if len(inst.Problems) == 0 {
+				failures = append(failures, CheckFailure{Address: address, Status: inst.Status})
+			}
+			for _, p := range inst.Problems {
+				failures = append(failures, CheckFailure{Address: address, Status: inst.Status, Message: p.Message})
+			}
+		}
+		if !found {
+			failures = append(failures, CheckFailure{Address: c.Address.ToDisplay, Status: c.Status})
+		}
+	}
+	return failures
+}
@@ -0,0 +1,123 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseState_Checks(t *testing.T) {
+	t.Parallel()
+
+	data := `{
+  "format_version": "1.0",
+  "values": {"root_module": {}},
+  "checks": [
+    {
+      "address": {"kind": "check", "name": "health", "to_display": "check.health"},
+      "status": "fail",
+      "instances": [
+        {
+          "address": {"to_display": "check.health"},
+          "status": "fail",
+          "problems": [{"message": "The endpoint returned 503."}]
+        }
+      ]
+    },
+    {
+      "address": {"kind": "resource", "mode": "managed", "type": "aws_instance", "name": "web", "to_display": "aws_instance.web"},
+      "status": "pass",
+      "instances": [{"address": {"to_display": "aws_instance.web[0]", "instance_key": 0}, "status": "pass"}]
+    }
+  ]
+}`
+	state, err := parseState([]byte(data))
+	require.NoError(t, err)
+	assert.Equal(t, []CheckResult{
+		{
+			Address: CheckAddress{Kind: "check", ToDisplay: "check.health"},
+			Status:  CheckStatusFail,
+			Instances: []CheckInstance{
+				{Address: CheckAddress{ToDisplay: "check.health"}, Status: CheckStatusFail, Problems: []CheckProblem{{Message: "The endpoint returned 503."}}},
+			},
+		},
+		{
+			Address:   CheckAddress{Kind: "resource", ToDisplay: "aws_instance.web"},
+			Status:    CheckStatusPass,
+			Instances: []CheckInstance{{Address: CheckAddress{ToDisplay: "aws_instance.web[0]"}, Status: CheckStatusPass}},
+		},
+	}, state.Checks)
+}
+
+func TestMergeChecks(t *testing.T) {
+	t.Parallel()
+
+	state := []CheckResult{
+		{Address: CheckAddress{ToDisplay: "check.health"}, Status: CheckStatusFail},
+		{Address: CheckAddress{ToDisplay: "output.url"}, Status: CheckStatusFail},
+	}
+	plan := []CheckResult{
+		{Address: CheckAddress{ToDisplay: "check.health"}, Status: CheckStatusPass},
+		{Address: CheckAddress{ToDisplay: "output.url"}, Status: CheckStatusUnknown},
+		{Address: CheckAddress{ToDisplay: "aws_instance.web"}, Status: CheckStatusPass},
+	}
+	assert.Equal(t, []CheckResult{
+		{Address: CheckAddress{ToDisplay: "check.health"}, Status: CheckStatusPass},
+		{Address: CheckAddress{ToDisplay: "output.url"}, Status: CheckStatusFail},
+		{Address: CheckAddress{ToDisplay: "aws_instance.web"}, Status: CheckStatusPass},
+	}, MergeChecks(state, plan))
+}
+
+func TestFailedChecks(t *testing.T) {
+	t.Parallel()
+
+	checks := []CheckResult{
+		{
+			Address: CheckAddress{Kind: "check", ToDisplay: "check.health"},
+			Status:  CheckStatusFail,
+			Instances: []CheckInstance{
+				{Address: CheckAddress{ToDisplay: "check.health"}, Status: CheckStatusFail, Problems: []CheckProblem{{Message: "returned 503"}, {Message: "too slow"}}},
+			},
+		},
+		{
+			Address: CheckAddress{Kind: "resource", ToDisplay: "aws_instance.web"},
+			Status:  CheckStatusFail,
+			Instances: []CheckInstance{
+				{Address: CheckAddress{ToDisplay: "aws_instance.web[0]"}, Status: CheckStatusPass},
+				{Address: CheckAddress{ToDisplay: "aws_instance.web[1]"}, Status: CheckStatusFail, Problems: []CheckProblem{{Message: "no public IP"}}},
+			},
+		},
+		{
+			Address: CheckAddress{Kind: "output_value", ToDisplay: "output.url"},
+			Status:  CheckStatusError,
+		},
+		{
+			Address: CheckAddress{Kind: "check", ToDisplay: "check.pending"},
+			Status:  CheckStatusUnknown,
+		},
+	}
+	failures := FailedChecks(checks)
+	assert.Equal(t, []CheckFailure{
+		{Address: "check.health", Status: CheckStatusFail, Message: "returned 503"},
+		{Address: "check.health", Status: CheckStatusFail, Message: "too slow"},
+		{Address: "aws_instance.web[1]", Status: CheckStatusFail, Message: "no public IP"},
+		{Address: "output.url", Status: CheckStatusError},
+	}, failures)
+	assert.Equal(t, "aws_instance.web[1]: fail: no public IP", failures[2].String())
+	assert.Equal(t, "output.url: error", failures[3].String())
+}
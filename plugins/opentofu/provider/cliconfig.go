@@ -0,0 +1,206 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	cliConfigFileName = "pipecd.tfrc"
+	// CLIConfigFileEnv is the environment variable which sets the path to the CLI configuration file.
+	CLIConfigFileEnv = "TF_CLI_CONFIG_FILE"
+)
+
+var cliConfigBlockSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "provider_installation"},
+		{Type: "credentials", LabelNames: []string{"host"}},
+	},
+}
+
+// CLIConfig represents the OpenTofu CLI configuration file.
+// See https://opentofu.org/docs/cli/config/config-file/
+type CLIConfig struct {
+	ProviderInstallation *ProviderInstallation
+	Credentials          []Credential
+}
+
+// Credential represents a "credentials" block in the CLI configuration,
+// which is used to authenticate to the registry or the remote backend of the host.
+type Credential struct {
+	Host  string
+	Token string
+}
+
+// ProviderInstallation represents the "provider_installation" block in the CLI configuration.
+type ProviderInstallation struct {
+	// The directory which contains providers laid out as a filesystem mirror.
+	FilesystemMirror string
+	// The base URL of a network mirror.
+	NetworkMirror string
+	// The provider source address patterns installed from the mirrors.
+	// Empty means all providers.
+	Include []string
+	// The provider source address patterns never installed from the mirrors.
+	Exclude []string
+	// Whether to install providers that are not found in the mirrors from their origin registries.
+	AllowDirect bool
+}
+
+// IsEmpty returns true when the configuration has nothing to be written.
+func (c CLIConfig) IsEmpty() bool {
+	return c.ProviderInstallation == nil && len(c.Credentials) == 0
+}
+
+// Bytes renders the configuration in the HCL native syntax.
+func (c CLIConfig) Bytes() []byte {
+	f := hclwrite.NewEmptyFile()
+	body := f.Body()
+
+	if pi := c.ProviderInstallation; pi != nil {
+		b := body.AppendNewBlock("provider_installation", nil).Body()
+		if pi.FilesystemMirror != "" {
+			m := b.AppendNewBlock("filesystem_mirror", nil).Body()
+			m.SetAttributeValue("path", cty.StringVal(pi.FilesystemMirror))
+			setPatterns(m, pi.Include, pi.Exclude)
+		}
+		if pi.NetworkMirror != "" {
+			m := b.AppendNewBlock("network_mirror", nil).Body()
+			m.SetAttributeValue("url", cty.StringVal(pi.NetworkMirror))
+			setPatterns(m, pi.Include, pi.Exclude)
+		}
+		if pi.AllowDirect {
+			b.AppendNewBlock("direct", nil)
+		}
+	}
+
+	for _, cred := range c.Credentials {
+		b := body.AppendNewBlock("credentials", []string{cred.Host}).Body()
+		b.SetAttributeValue("token", cty.StringVal(cred.Token))
+	}
+
+	return f.Bytes()
+}
+
+// WriteFile writes the configuration into the given directory and returns the path of the written file.
+// The configuration in baseFile such as "plugin_cache_dir" is kept by writing it together,
+// and an error is returned when it has the blocks which conflict with the configuration.
+// Empty baseFile means there is no configuration to be kept.
+func (c CLIConfig) WriteFile(dir, baseFile string) (string, error) {
+	var data []byte
+	if baseFile != "" {
+		base, err := os.ReadFile(baseFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read the CLI configuration %s: %w", baseFile, err)
+		}
+		if err := c.checkConflicts(baseFile, base); err != nil {
+			return "", err
+		}
+		data = append(base, '\n')
+	}
+	data = append(data, c.Bytes()...)
+
+	path := filepath.Join(dir, cliConfigFileName)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// checkConflicts returns an error when the given configuration has the blocks which can't be written together with the configuration.
+func (c CLIConfig) checkConflicts(filename string, base []byte) error {
+	f, diags := hclparse.NewParser().ParseHCL(base, filename)
+	if diags.HasErrors() {
+		return fmt.Errorf("failed to parse the CLI configuration %s: %w", filename, diags)
+	}
+	content, _, diags := f.Body.PartialContent(cliConfigBlockSchema)
+	if diags.HasErrors() {
+		return fmt.Errorf("failed to parse the CLI configuration %s: %w", filename, diags)
+	}
+
+	for _, b := range content.Blocks {
+		switch b.Type {
+		case "provider_installation":
+			if c.ProviderInstallation != nil {
+				return fmt.Errorf("the CLI configuration %s already has provider_installation, which conflicts with the provider mirror", filename)
+			}
+		case "credentials":
+			for _, cred := range c.Credentials {
+				if strings.EqualFold(cred.Host, b.Labels[0]) {
+					return fmt.Errorf("the CLI configuration %s already has the credentials for host %q", filename, cred.Host)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// HostCLIConfigFile returns the path to the CLI configuration file which the engine uses when the generated one isn't given.
+// It's the one set by TF_CLI_CONFIG_FILE in the given environment variables, or the one in the default location.
+// Empty means there is no such file.
+func HostCLIConfigFile(engine Engine, env []string) string {
+	var path string
+	for _, e := range env {
+		if v, ok := strings.CutPrefix(e, CLIConfigFileEnv+"="); ok {
+			path = v
+		}
+	}
+	if path != "" {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	names := []string{".terraformrc"}
+	if engine != EngineTerraform {
+		// OpenTofu falls back to the file of terraform when its own one doesn't exist.
+		names = []string{".tofurc", ".terraformrc"}
+	}
+	for _, name := range names {
+		path := filepath.Join(home, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+func setPatterns(body *hclwrite.Body, include, exclude []string) {
+	if len(include) > 0 {
+		body.SetAttributeValue("include", stringListVal(include))
+	}
+	if len(exclude) > 0 {
+		body.SetAttributeValue("exclude", stringListVal(exclude))
+	}
+}
+
+func stringListVal(values []string) cty.Value {
+	vals := make([]cty.Value, 0, len(values))
+	for _, v := range values {
+		vals = append(vals, cty.StringVal(v))
+	}
+	return cty.ListVal(vals)
+}
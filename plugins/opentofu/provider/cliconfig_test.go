@@ -0,0 +1,195 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCLIConfig_Bytes(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		name     string
+		config   CLIConfig
+		expected string
+	}{
+		{
+			name:     "empty",
+			config:   CLIConfig{},
+			expected: "",
+		},
+		{
+			name: "filesystem mirror only",
+			config: CLIConfig{
+				ProviderInstallation: &ProviderInstallation{
+					FilesystemMirror: "/usr/share/opentofu/providers",
+				},
+			},
+			expected: `provider_installation {
+  filesystem_mirror {
+    path = "/usr/share/opentofu/providers"
+  }
+}
+`,
+		},
+		{
+			name: "both mirrors with patterns and direct",
+			config: CLIConfig{
+				ProviderInstallation: &ProviderInstallation{
+					FilesystemMirror: "/mirror",
+					NetworkMirror:    "https://mirror.example.com/",
+					Include:          []string{"registry.opentofu.org/hashicorp/*"},
+					Exclude:          []string{"registry.opentofu.org/hashicorp/aws"},
+					AllowDirect:      true,
+				},
+			},
+			expected: `provider_installation {
+  filesystem_mirror {
+    path    = "/mirror"
+    include = ["registry.opentofu.org/hashicorp/*"]
+    exclude = ["registry.opentofu.org/hashicorp/aws"]
+  }
+  network_mirror {
+    url     = "https://mirror.example.com/"
+    include = ["registry.opentofu.org/hashicorp/*"]
+    exclude = ["registry.opentofu.org/hashicorp/aws"]
+  }
+  direct {
+  }
+}
+`,
+		},
+		{
+			name: "credentials",
+			config: CLIConfig{
+				Credentials: []Credential{
+					{Host: "registry.example.com", Token: "t0k3n"},
+					{Host: "app.terraform.io", Token: "abc.atlasv1.def"},
+				},
+			},
+			expected: `credentials "registry.example.com" {
+  token = "t0k3n"
+}
+credentials "app.terraform.io" {
+  token = "abc.atlasv1.def"
+}
+`,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.expected, string(tc.config.Bytes()))
+		})
+	}
+}
+
+func TestCLIConfig_WriteFile(t *testing.T) {
+	t.Parallel()
+
+	c := CLIConfig{
+		ProviderInstallation: &ProviderInstallation{FilesystemMirror: "/mirror"},
+		Credentials:          []Credential{{Host: "registry.example.com", Token: "t0k3n"}},
+	}
+	path, err := c.WriteFile(t.TempDir(), "")
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, c.Bytes(), data)
+}
+
+func TestCLIConfig_WriteFile_Base(t *testing.T) {
+	t.Parallel()
+
+	c := CLIConfig{
+		ProviderInstallation: &ProviderInstallation{FilesystemMirror: "/mirror"},
+		Credentials:          []Credential{{Host: "registry.example.com", Token: "t0k3n"}},
+	}
+
+	testcases := []struct {
+		name    string
+		base    string
+		wantErr bool
+	}{
+		{
+			name: "keep the host configuration",
+			base: `plugin_cache_dir = "/cache"
+
+credentials "app.terraform.io" {
+  token = "other"
+}
+`,
+		},
+		{
+			name: "conflicting provider installation",
+			base: `provider_installation {
+  direct {}
+}
+`,
+			wantErr: true,
+		},
+		{
+			name: "conflicting credentials",
+			base: `credentials "Registry.example.com" {
+  token = "other"
+}
+`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid configuration",
+			base:    `plugin_cache_dir = `,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			base := filepath.Join(t.TempDir(), ".tofurc")
+			require.NoError(t, os.WriteFile(base, []byte(tc.base), 0600))
+
+			path, err := c.WriteFile(t.TempDir(), base)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, tc.base+"\n"+string(c.Bytes()), string(data))
+		})
+	}
+
+	// The file set explicitly must exist.
+	_, err := c.WriteFile(t.TempDir(), filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+func TestHostCLIConfigFile(t *testing.T) {
+	t.Parallel()
+
+	// The last one wins in the same way as the environment variables of the commands.
+	env := []string{"HOME=/root", CLIConfigFileEnv + "=/host.tfrc", CLIConfigFileEnv + "=/shared.tfrc"}
+	assert.Equal(t, "/shared.tfrc", HostCLIConfigFile(EngineOpenTofu, env))
+}
@@ -0,0 +1,220 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+// PriceCatalog represents the monthly prices of the resource types, loaded from a YAML or JSON file.
+// The prices are maintained by hand, so that the costs can be estimated without accessing any pricing API.
+type PriceCatalog struct {
+	// The version of the catalog which is shown with the estimates, such as the date the prices were taken.
+	Version string `json:"version"`
+	// The currency of the prices, such as "USD".
+	Currency string `json:"currency,omitempty"`
+	// The prices of the resource types.
+	Resources []ResourcePrice `json:"resources"`
+}
+
+// ResourcePrice represents the monthly price of a resource type.
+type ResourcePrice struct {
+	// The resource type, such as "aws_instance".
+	Type string `json:"type"`
+	// The attribute whose value selects the price from prices, such as "instance_type".
+	// Empty means the resource always costs monthlyPrice.
+	Attribute string `json:"attribute,omitempty"`
+	// Map of the value of attribute to the monthly price.
+	Prices map[string]float64 `json:"prices,omitempty"`
+	// The monthly price used when attribute is empty or its value isn't in prices.
+	MonthlyPrice *float64 `json:"monthlyPrice,omitempty"`
+	// The number attribute the price is multiplied by, such as "allocated_storage" for the price per GB.
+	QuantityAttribute string `json:"quantityAttribute,omitempty"`
+}
+
+// LoadPriceCatalog reads the price catalog from the given file.
+func LoadPriceCatalog(path string) (*PriceCatalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c PriceCatalog
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse the price catalog %s: %w", path, err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid price catalog %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+func (c *PriceCatalog) Validate() error {
+	if c.Version == "" {
+		return errors.New("version must be set")
+	}
+	types := make(map[string]struct{}, len(c.Resources))
+	for _, r := range c.Resources {
+		if r.Type == "" {
+			return errors.New("type of resource price must be set")
+		}
+		if _, ok := types[r.Type]; ok {
+			return fmt.Errorf("resource type %q is duplicated", r.Type)
+		}
+		types[r.Type] = struct{}{}
+		if r.Attribute == "" && r.MonthlyPrice == nil {
+			return fmt.Errorf("either attribute or monthlyPrice of resource type %q must be set", r.Type)
+		}
+		if r.Attribute != "" && len(r.Prices) == 0 && r.MonthlyPrice == nil {
+			return fmt.Errorf("prices of resource type %q must be set to use attribute", r.Type)
+		}
+	}
+	return nil
+}
+
+// ResourceCost represents the estimated monthly costs of a resource before and after the change.
+type ResourceCost struct {
+	Address string
+	Action  ChangeAction
+	Before  float64
+	After   float64
+}
+
+// Delta returns the change of the monthly cost.
+func (c ResourceCost) Delta() float64 {
+	return c.After - c.Before
+}
+
+// CostEstimate represents the estimated change of the monthly cost by a plan.
+type CostEstimate struct {
+	CatalogVersion string
+	Currency       string
+	// The costs of the changed resources whose types are in the catalog.
+	Resources []ResourceCost
+	// The addresses of the changed resources whose types are in the catalog,
+	// but whose costs can't be estimated because the values are unknown until applied or not in the catalog.
+	Unestimated []string
+	// The number of the changed resources whose types aren't in the catalog.
+	Unpriced int
+}
+
+// TotalDelta returns the change of the monthly cost of all estimated resources.
+func (e CostEstimate) TotalDelta() float64 {
+	var total float64
+	for _, r := range e.Resources {
+		total += r.Delta()
+	}
+	return total
+}
+
+// EstimateCost estimates the change of the monthly cost by the managed resources changed in the plan.
+func (c *PriceCatalog) EstimateCost(plan *Plan) CostEstimate {
+	prices := make(map[string]ResourcePrice, len(c.Resources))
+	for _, r := range c.Resources {
+		prices[r.Type] = r
+	}
+
+	out := CostEstimate{CatalogVersion: c.Version, Currency: c.Currency}
+	for _, rc := range plan.ResourceChanges {
+		if rc.Mode != "managed" {
+			continue
+		}
+		action := rc.Change.Action()
+		var before, after bool
+		switch action {
+		case ChangeActionCreate:
+			after = true
+		case ChangeActionDelete:
+			before = true
+		case ChangeActionUpdate, ChangeActionReplace:
+			before, after = true, true
+		default:
+			// The costs don't change by the other actions, e.g. a resource removed only from the state is still running.
+			continue
+		}
+
+		price, ok := prices[rc.Type]
+		if !ok {
+			out.Unpriced++
+			continue
+		}
+		cost := ResourceCost{Address: rc.Address, Action: action}
+		estimated := true
+		if before {
+			cost.Before, ok = price.monthlyCost(rc.Change.Before)
+			estimated = estimated && ok
+		}
+		if after {
+			cost.After, ok = price.monthlyCost(rc.Change.After)
+			estimated = estimated && ok
+		}
+		if !estimated {
+			out.Unestimated = append(out.Unestimated, rc.Address)
+			continue
+		}
+		out.Resources = append(out.Resources, cost)
+	}
+	return out
+}
+
+// monthlyCost returns the monthly cost of the resource with the given values.
+// It returns false when the values needed to estimate are unknown or not in the catalog.
+func (p ResourcePrice) monthlyCost(values any) (float64, bool) {
+	var unit float64
+	if p.Attribute == "" {
+		unit = *p.MonthlyPrice
+	} else {
+		v, ok := attributeString(child(values, p.Attribute))
+		price, found := p.Prices[v]
+		switch {
+		case ok && found:
+			unit = price
+		case ok && p.MonthlyPrice != nil:
+			unit = *p.MonthlyPrice
+		default:
+			return 0, false
+		}
+	}
+	if p.QuantityAttribute == "" {
+		return unit, true
+	}
+	n, ok := child(values, p.QuantityAttribute).(json.Number)
+	if !ok {
+		return 0, false
+	}
+	quantity, err := n.Float64()
+	if err != nil {
+		return 0, false
+	}
+	return unit * quantity, true
+}
+
+// attributeString returns the string representation of the primitive value.
+// It returns false for null which means the value is unknown until applied.
+func attributeString(v any) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return fmt.Sprint(v), true
+	}
+	return "", false
+}
@@ -0,0 +1,141 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPriceCatalog = `
+version: "2025-06-01"
+currency: USD
+resources:
+  - type: aws_instance
+    attribute: instance_type
+    prices:
+      t3.micro: 7.5
+      t3.small: 15
+  - type: aws_nat_gateway
+    monthlyPrice: 32.5
+  - type: aws_ebs_volume
+    attribute: type
+    prices:
+      gp3: 0.08
+    quantityAttribute: size
+`
+
+func TestLoadPriceCatalog(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "prices.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testPriceCatalog), 0600))
+	c, err := LoadPriceCatalog(path)
+	require.NoError(t, err)
+	assert.Equal(t, "2025-06-01", c.Version)
+	assert.Equal(t, "USD", c.Currency)
+	require.Len(t, c.Resources, 3)
+	assert.Equal(t, map[string]float64{"t3.micro": 7.5, "t3.small": 15}, c.Resources[0].Prices)
+	assert.Equal(t, 32.5, *c.Resources[1].MonthlyPrice)
+
+	invalid := filepath.Join(t.TempDir(), "invalid.yaml")
+	require.NoError(t, os.WriteFile(invalid, []byte("resources:\n  - type: aws_instance\n    monthlyPrice: 1\n"), 0600))
+	_, err = LoadPriceCatalog(invalid)
+	assert.Error(t, err)
+}
+
+func TestPriceCatalog_Validate(t *testing.T) {
+	t.Parallel()
+
+	price := 1.0
+	testcases := []struct {
+		name        string
+		catalog     PriceCatalog
+		expectedErr bool
+	}{
+		{
+			name:    "valid",
+			catalog: PriceCatalog{Version: "v1", Resources: []ResourcePrice{{Type: "aws_instance", Attribute: "instance_type", Prices: map[string]float64{"t3.micro": 7.5}}}},
+		},
+		{
+			name:        "no version",
+			catalog:     PriceCatalog{},
+			expectedErr: true,
+		},
+		{
+			name:        "duplicated type",
+			catalog:     PriceCatalog{Version: "v1", Resources: []ResourcePrice{{Type: "aws_eip", MonthlyPrice: &price}, {Type: "aws_eip", MonthlyPrice: &price}}},
+			expectedErr: true,
+		},
+		{
+			name:        "no price",
+			catalog:     PriceCatalog{Version: "v1", Resources: []ResourcePrice{{Type: "aws_eip"}}},
+			expectedErr: true,
+		},
+		{
+			name:        "attribute without prices",
+			catalog:     PriceCatalog{Version: "v1", Resources: []ResourcePrice{{Type: "aws_instance", Attribute: "instance_type"}}},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			err := tc.catalog.Validate()
+			assert.Equal(t, tc.expectedErr, err != nil, err)
+		})
+	}
+}
+
+func TestPriceCatalog_EstimateCost(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "prices.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testPriceCatalog), 0600))
+	c, err := LoadPriceCatalog(path)
+	require.NoError(t, err)
+
+	plan, err := parsePlan([]byte(`{
+  "format_version": "1.2",
+  "resource_changes": [
+    {"address": "aws_instance.web", "mode": "managed", "type": "aws_instance", "change": {"actions": ["update"], "before": {"instance_type": "t3.micro"}, "after": {"instance_type": "t3.small"}}},
+    {"address": "aws_instance.batch", "mode": "managed", "type": "aws_instance", "change": {"actions": ["create"], "before": null, "after": {"instance_type": "m5.large"}}},
+    {"address": "aws_instance.worker", "mode": "managed", "type": "aws_instance", "change": {"actions": ["create"], "before": null, "after": {}, "after_unknown": {"instance_type": true}}},
+    {"address": "aws_nat_gateway.main", "mode": "managed", "type": "aws_nat_gateway", "change": {"actions": ["delete"], "before": {}, "after": null}},
+    {"address": "aws_ebs_volume.data", "mode": "managed", "type": "aws_ebs_volume", "change": {"actions": ["delete", "create"], "before": {"type": "gp3", "size": 100}, "after": {"type": "gp3", "size": 250}}},
+    {"address": "aws_s3_bucket.logs", "mode": "managed", "type": "aws_s3_bucket", "change": {"actions": ["create"], "before": null, "after": {}}},
+    {"address": "aws_instance.idle", "mode": "managed", "type": "aws_instance", "change": {"actions": ["no-op"], "before": {"instance_type": "t3.micro"}, "after": {"instance_type": "t3.micro"}}},
+    {"address": "data.aws_instance.lookup", "mode": "data", "type": "aws_instance", "change": {"actions": ["read"], "before": null, "after": {"instance_type": "t3.micro"}}}
+  ]
+}`))
+	require.NoError(t, err)
+
+	e := c.EstimateCost(plan)
+	assert.Equal(t, "2025-06-01", e.CatalogVersion)
+	assert.Equal(t, "USD", e.Currency)
+	assert.Equal(t, []ResourceCost{
+		{Address: "aws_instance.web", Action: ChangeActionUpdate, Before: 7.5, After: 15},
+		{Address: "aws_nat_gateway.main", Action: ChangeActionDelete, Before: 32.5},
+		{Address: "aws_ebs_volume.data", Action: ChangeActionReplace, Before: 8, After: 20},
+	}, e.Resources)
+	assert.Equal(t, []string{"aws_instance.batch", "aws_instance.worker"}, e.Unestimated)
+	assert.Equal(t, 1, e.Unpriced)
+	assert.InDelta(t, -13, e.TotalDelta(), 1e-9)
+}
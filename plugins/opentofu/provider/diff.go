@@ -0,0 +1,491 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	signCreate    = "+"
+	signDelete    = "-"
+	signUpdate    = "~"
+	signRead      = "<="
+	signUnchanged = ""
+
+	sensitiveValue = "(sensitive value)"
+	unknownValue   = "(known after apply)"
+)
+
+// RenderOption configures how a plan is rendered.
+type RenderOption func(*renderOptions)
+
+type renderOptions struct {
+	showUnchanged bool
+	showDrift     bool
+	// The name of the engine shown in the section headers.
+	engineName string
+}
+
+// WithUnchangedAttributes shows the attributes which are not changed instead of hiding them.
+func WithUnchangedAttributes() RenderOption {
+	return func(o *renderOptions) {
+		o.showUnchanged = true
+	}
+}
+
+// WithResourceDrift shows the changes made outside of OpenTofu which are detected while refreshing.
+// This is useful for rendering a refresh-only plan, whose changes are all drifts.
+func WithResourceDrift() RenderOption {
+	return func(o *renderOptions) {
+		o.showDrift = true
+	}
+}
+
+// diffRenderer renders a structured plan as a unified diff.
+// Every line starts with its sign ("+", "-", "~" or a space) at the first column,
+// so that the output is highlighted by the PipeCD diff viewer and by "diff" code blocks of PR comments.
+type diffRenderer struct {
+	opts renderOptions
+	b    strings.Builder
+
+	// The replace paths of the resource being rendered.
+	replacePaths map[string]struct{}
+}
+
+func renderPlan(p *Plan, opts renderOptions) string {
+	r := &diffRenderer{opts: opts}
+	if opts.showDrift && len(p.ResourceDrift) > 0 {
+		fmt.Fprintf(&r.b, "Objects have changed outside of %s:\n\n", opts.engineName)
+		for _, rc := range p.ResourceDrift {
+			r.renderResource(rc, true)
+		}
+	}
+	for _, rc := range p.ResourceChanges {
+		r.renderResource(rc, false)
+	}
+	r.renderOutputs(p.OutputChanges)
+	return r.b.String()
+}
+
+func (r *diffRenderer) line(sign string, depth int, text string) {
+	fmt.Fprintf(&r.b, "%-4s%s%s\n", sign, strings.Repeat("    ", depth), text)
+}
+
+func (r *diffRenderer) renderResource(rc ResourceChange, drift bool) {
+	c := rc.Change
+	action := c.Action()
+	if action == ChangeActionNoop && c.Importing == nil {
+		return
+	}
+
+	if drift {
+		fmt.Fprintf(&r.b, "# %s\n", driftHeader(rc))
+	} else {
+		fmt.Fprintf(&r.b, "# %s\n", resourceHeader(rc))
+	}
+
+	var sign string
+	switch action {
+	case ChangeActionCreate:
+		sign = signCreate
+	case ChangeActionDelete, ChangeActionForget:
+		sign = signDelete
+	case ChangeActionUpdate:
+		sign = signUpdate
+	case ChangeActionRead:
+		sign = signRead
+	case ChangeActionReplace:
+		sign = "-/+"
+		if c.createBeforeDestroy() {
+			sign = "+/-"
+		}
+	}
+
+	kind := "resource"
+	if rc.Mode == "data" {
+		kind = "data"
+	}
+	r.line(sign, 0, fmt.Sprintf("%s %q %q {", kind, rc.Type, rc.Name))
+
+	r.replacePaths = make(map[string]struct{}, len(c.ReplacePaths))
+	for _, p := range c.ReplacePaths {
+		r.replacePaths[pathKey(p)] = struct{}{}
+	}
+
+	r.renderAttributes(1, nil, c.Before, c.After, c.AfterUnknown, c.BeforeSensitive, c.AfterSensitive)
+
+	r.line(signUnchanged, 0, "}")
+	r.b.WriteString("\n")
+}
+
+// resourceHeader returns the description of the change for a resource in the same words as the human readable plan.
+func resourceHeader(rc ResourceChange) string {
+	addr := rc.Address
+	switch rc.ActionReason {
+	case "replace_because_tainted":
+		return addr + " is tainted, so must be replaced"
+	case "replace_by_request":
+		return addr + " will be replaced, as requested"
+	case "replace_by_triggers":
+		return addr + " will be replaced due to changes in replace_triggered_by"
+	}
+
+	var header string
+	switch rc.Change.Action() {
+	case ChangeActionCreate:
+		header = addr + " will be created"
+	case ChangeActionRead:
+		header = addr + " will be read during apply"
+	case ChangeActionUpdate:
+		header = addr + " will be updated in-place"
+	case ChangeActionReplace:
+		header = addr + " must be replaced"
+	case ChangeActionDelete:
+		header = addr + " will be destroyed"
+	case ChangeActionForget:
+		header = addr + " will be removed from the state, but the real object will not be destroyed"
+	default:
+		header = addr + " will be imported"
+	}
+	if rc.Change.Importing != nil && rc.Change.Action() != ChangeActionNoop {
+		header += fmt.Sprintf(" (imported from %q)", rc.Change.Importing.ID)
+	}
+
+	switch rc.ActionReason {
+	case "delete_because_no_resource_config":
+		header += fmt.Sprintf(" (because %s is not in configuration)", addr)
+	case "delete_because_no_module":
+		header += fmt.Sprintf(" (because %s is not in configuration)", rc.ModuleAddress)
+	case "delete_because_wrong_repetition", "delete_because_count_index", "delete_because_each_key":
+		header += " (because its index is no longer in the configuration)"
+	case "read_because_config_unknown":
+		header += " (config refers to values not yet known)"
+	case "read_because_dependency_pending":
+		header += " (depends on a resource or a module with changes pending)"
+	}
+	return header
+}
+
+// driftHeader returns the description of the change made outside of OpenTofu.
+func driftHeader(rc ResourceChange) string {
+	if rc.Change.Action() == ChangeActionDelete {
+		return rc.Address + " has been deleted"
+	}
+	return rc.Address + " has changed"
+}
+
+func (r *diffRenderer) renderOutputs(outputs map[string]Change) {
+	names := slices.Sorted(maps.Keys(outputs))
+	names = slices.DeleteFunc(names, func(name string) bool { return outputs[name].Action() == ChangeActionNoop })
+	width := 0
+	for _, name := range names {
+		width = max(width, len(name))
+	}
+
+	sub := &diffRenderer{opts: r.opts}
+	for _, name := range names {
+		c := outputs[name]
+		sub.renderAttribute(0, nil, name+strings.Repeat(" ", width-len(name)), c.Before, c.After, c.AfterUnknown, c.BeforeSensitive, c.AfterSensitive)
+	}
+	if sub.b.Len() == 0 {
+		return
+	}
+	r.b.WriteString("Changes to Outputs:\n")
+	r.b.WriteString(sub.b.String())
+	r.b.WriteString("\n")
+}
+
+// renderAttributes renders the attributes of an object.
+// The attributes which are not changed are hidden unless showUnchanged is set.
+func (r *diffRenderer) renderAttributes(depth int, path []any, before, after, unknown, beforeSens, afterSens any) {
+	bm, _ := before.(map[string]any)
+	am, _ := after.(map[string]any)
+	um, _ := unknown.(map[string]any)
+
+	keys := make(map[string]struct{}, len(bm)+len(am)+len(um))
+	for k, v := range bm {
+		if v != nil {
+			keys[k] = struct{}{}
+		}
+	}
+	for k, v := range am {
+		if v != nil {
+			keys[k] = struct{}{}
+		}
+	}
+	for k, v := range um {
+		if isTrue(v) {
+			keys[k] = struct{}{}
+		}
+	}
+	sorted := slices.Sorted(maps.Keys(keys))
+
+	width := 0
+	for _, k := range sorted {
+		width = max(width, len(k))
+	}
+
+	hidden := 0
+	for _, k := range sorted {
+		name := k + strings.Repeat(" ", width-len(k))
+		if !r.renderAttribute(depth, append(slices.Clip(path), k), name, bm[k], am[k], child(unknown, k), child(beforeSens, k), child(afterSens, k)) {
+			hidden++
+		}
+	}
+	if hidden > 0 {
+		r.line(signUnchanged, depth, fmt.Sprintf("# (%d unchanged %s hidden)", hidden, plural(hidden, "attribute")))
+	}
+}
+
+// renderElements renders the elements of a list or a set by comparing them index by index.
+func (r *diffRenderer) renderElements(depth int, path []any, before, after, unknown, beforeSens, afterSens any) {
+	bl, _ := before.([]any)
+	al, _ := after.([]any)
+	ul, _ := unknown.([]any)
+
+	hidden := 0
+	for i := range max(len(bl), len(al), len(ul)) {
+		var b, a any
+		if i < len(bl) {
+			b = bl[i]
+		}
+		if i < len(al) {
+			a = al[i]
+		}
+		if !r.renderAttribute(depth, append(slices.Clip(path), i), "", b, a, child(unknown, i), child(beforeSens, i), child(afterSens, i)) {
+			hidden++
+		}
+	}
+	if hidden > 0 {
+		r.line(signUnchanged, depth, fmt.Sprintf("# (%d unchanged %s hidden)", hidden, plural(hidden, "element")))
+	}
+}
+
+// renderAttribute renders a value which is named by name, or an element of a list when name is empty.
+// It returns false when the value was hidden because it is not changed.
+func (r *diffRenderer) renderAttribute(depth int, path []any, name string, before, after, unknown, beforeSens, afterSens any) bool {
+	hasBefore, hasAfter := before != nil, after != nil || isTrue(unknown)
+	if !hasBefore && !hasAfter {
+		return true
+	}
+
+	sign := signUpdate
+	switch {
+	case !hasBefore:
+		sign = signCreate
+	case !hasAfter:
+		sign = signDelete
+	case reflect.DeepEqual(before, after) && !containsTrue(unknown) && reflect.DeepEqual(beforeSens, afterSens):
+		if !r.opts.showUnchanged {
+			return false
+		}
+		sign = signUnchanged
+	}
+
+	prefix := ""
+	if name != "" {
+		prefix = name + " = "
+	}
+	suffix := ""
+	if _, ok := r.replacePaths[pathKey(path)]; ok {
+		suffix = " # forces replacement"
+	}
+
+	switch {
+	case isTrue(beforeSens) || isTrue(afterSens):
+		r.line(sign, depth, prefix+sensitiveValue+suffix)
+	case isTrue(unknown):
+		if hasBefore {
+			r.line(sign, depth, prefix+r.inline(before)+" -> "+unknownValue+suffix)
+		} else {
+			r.line(sign, depth, prefix+unknownValue+suffix)
+		}
+	case isMap(before, after):
+		r.line(sign, depth, prefix+"{"+suffix)
+		r.renderAttributes(depth+1, path, before, after, unknown, beforeSens, afterSens)
+		r.line(signUnchanged, depth, "}")
+	case isList(before, after):
+		r.line(sign, depth, prefix+"["+suffix)
+		r.renderElements(depth+1, path, before, after, unknown, beforeSens, afterSens)
+		r.line(signUnchanged, depth, "]")
+	case isMultiline(before) || isMultiline(after):
+		r.line(sign, depth, prefix+"<<-EOT"+suffix)
+		r.renderLines(depth+1, before, after)
+		r.line(signUnchanged, depth, "EOT")
+	case sign == signCreate || sign == signUnchanged:
+		r.line(sign, depth, prefix+r.inline(after)+suffix)
+	case sign == signDelete:
+		r.line(sign, depth, prefix+r.inline(before)+" -> null"+suffix)
+	default:
+		r.line(sign, depth, prefix+r.inline(before)+" -> "+r.inline(after)+suffix)
+	}
+	return true
+}
+
+// renderLines renders a diff of multi-line strings in a heredoc.
+// The lines common at the beginning and the end are shown as unchanged.
+func (r *diffRenderer) renderLines(depth int, before, after any) {
+	bs, _ := before.(string)
+	as, _ := after.(string)
+	var bl, al []string
+	if bs != "" {
+		bl = strings.Split(strings.TrimSuffix(bs, "\n"), "\n")
+	}
+	if as != "" {
+		al = strings.Split(strings.TrimSuffix(as, "\n"), "\n")
+	}
+
+	prefix := 0
+	for prefix < len(bl) && prefix < len(al) && bl[prefix] == al[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(bl)-prefix && suffix < len(al)-prefix && bl[len(bl)-1-suffix] == al[len(al)-1-suffix] {
+		suffix++
+	}
+
+	for _, l := range bl[:prefix] {
+		r.line(signUnchanged, depth, l)
+	}
+	for _, l := range bl[prefix : len(bl)-suffix] {
+		r.line(signDelete, depth, l)
+	}
+	for _, l := range al[prefix : len(al)-suffix] {
+		r.line(signCreate, depth, l)
+	}
+	for _, l := range bl[len(bl)-suffix:] {
+		r.line(signUnchanged, depth, l)
+	}
+}
+
+// inline returns the value formatted in a single line.
+func (r *diffRenderer) inline(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(v)
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(b)
+	}
+}
+
+// child returns the value of the given key or index in a nested value such as "after_unknown".
+func child(v any, key any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		if k, ok := key.(string); ok {
+			return v[k]
+		}
+	case []any:
+		if i, ok := key.(int); ok && i < len(v) {
+			return v[i]
+		}
+	}
+	return nil
+}
+
+func isTrue(v any) bool {
+	b, ok := v.(bool)
+	return ok && b
+}
+
+// containsTrue returns true when the value or any of its nested values is true.
+func containsTrue(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case map[string]any:
+		for _, c := range v {
+			if containsTrue(c) {
+				return true
+			}
+		}
+	case []any:
+		for _, c := range v {
+			if containsTrue(c) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isMap returns true when the non-nil values are all objects.
+func isMap(values ...any) bool {
+	found := false
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		if _, ok := v.(map[string]any); !ok {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+// isList returns true when the non-nil values are all lists.
+func isList(values ...any) bool {
+	found := false
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		if _, ok := v.([]any); !ok {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+func isMultiline(v any) bool {
+	s, ok := v.(string)
+	return ok && strings.Contains(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// pathKey returns a comparable key of a path to an attribute.
+// The indexes decoded as json.Number and the ones given as int result in the same key.
+func pathKey(path []any) string {
+	parts := make([]string, 0, len(path))
+	for _, p := range path {
+		parts = append(parts, fmt.Sprint(p))
+	}
+	return strings.Join(parts, "\x00")
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
@@ -0,0 +1,238 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanResult_Render_StructuredPlan(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile("testdata/plan.json")
+	require.NoError(t, err)
+	plan, err := parsePlan(data)
+	require.NoError(t, err)
+
+	result := PlanResult{Adds: 2, Changes: 1, Destroys: 2, HasStateChanges: true, Plan: plan}
+
+	testcases := []struct {
+		name     string
+		opts     []RenderOption
+		expected string
+	}{
+		{
+			name: "hide unchanged attributes",
+			expected: `# aws_instance.web must be replaced
+-/+ resource "aws_instance" "web" {
+~       ami           = "ami-1" -> "ami-2" # forces replacement
+~       id            = "i-123" -> (known after apply)
+~       tags          = {
++           Env  = "prod"
+            # (1 unchanged attribute hidden)
+        }
+        # (1 unchanged attribute hidden)
+    }
+
+# aws_iam_policy.this will be updated in-place
+~   resource "aws_iam_policy" "this" {
+~       password = (sensitive value)
+~       policy   = <<-EOT
+            {
+-             "Effect": "Deny",
++             "Effect": "Allow",
+              "Action": "s3:*"
+            }
+        EOT
+~       ports    = [
+~           443 -> 8443
+            # (1 unchanged element hidden)
+        ]
+        # (1 unchanged attribute hidden)
+    }
+
+# null_resource.new will be created
++   resource "null_resource" "new" {
++       id = (known after apply)
+    }
+
+# null_resource.old will be destroyed (because null_resource.old is not in configuration)
+-   resource "null_resource" "old" {
+-       id = "42" -> null
+    }
+
+Changes to Outputs:
++   ip    = (known after apply)
+~   token = (sensitive value)
+
+Plan: 0 to import, 2 to add, 1 to change, 2 to destroy.
+`,
+		},
+		{
+			name: "show unchanged attributes",
+			opts: []RenderOption{WithUnchangedAttributes()},
+			expected: `# aws_instance.web must be replaced
+-/+ resource "aws_instance" "web" {
+~       ami           = "ami-1" -> "ami-2" # forces replacement
+~       id            = "i-123" -> (known after apply)
+        instance_type = "t3.micro"
+~       tags          = {
++           Env  = "prod"
+            Name = "web"
+        }
+    }
+
+# aws_iam_policy.this will be updated in-place
+~   resource "aws_iam_policy" "this" {
+        name     = "policy"
+~       password = (sensitive value)
+~       policy   = <<-EOT
+            {
+-             "Effect": "Deny",
++             "Effect": "Allow",
+              "Action": "s3:*"
+            }
+        EOT
+~       ports    = [
+            80
+~           443 -> 8443
+        ]
+    }
+
+# null_resource.new will be created
++   resource "null_resource" "new" {
++       id = (known after apply)
+    }
+
+# null_resource.old will be destroyed (because null_resource.old is not in configuration)
+-   resource "null_resource" "old" {
+-       id = "42" -> null
+    }
+
+Changes to Outputs:
++   ip    = (known after apply)
+~   token = (sensitive value)
+
+Plan: 0 to import, 2 to add, 1 to change, 2 to destroy.
+`,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			actual, err := result.Render(tc.opts...)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestResourceHeader(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		name     string
+		rc       ResourceChange
+		expected string
+	}{
+		{
+			name:     "tainted",
+			rc:       ResourceChange{Address: "a.b", Change: Change{Actions: []string{"delete", "create"}}, ActionReason: "replace_because_tainted"},
+			expected: "a.b is tainted, so must be replaced",
+		},
+		{
+			name:     "create before destroy",
+			rc:       ResourceChange{Address: "a.b", Change: Change{Actions: []string{"create", "delete"}}},
+			expected: "a.b must be replaced",
+		},
+		{
+			name:     "data source",
+			rc:       ResourceChange{Address: "data.a.b", Change: Change{Actions: []string{"read"}}, ActionReason: "read_because_config_unknown"},
+			expected: "data.a.b will be read during apply (config refers to values not yet known)",
+		},
+		{
+			name:     "import",
+			rc:       ResourceChange{Address: "a.b", Change: Change{Actions: []string{"no-op"}, Importing: &Importing{ID: "i-1"}}},
+			expected: "a.b will be imported",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.expected, resourceHeader(tc.rc))
+		})
+	}
+}
+
+func TestPlanResult_Render_ResourceDrift(t *testing.T) {
+	t.Parallel()
+
+	result := PlanResult{
+		HasStateChanges: true,
+		Plan: &Plan{
+			ResourceDrift: []ResourceChange{
+				{
+					Address: "aws_instance.web",
+					Mode:    "managed",
+					Type:    "aws_instance",
+					Name:    "web",
+					Change: Change{
+						Actions: []string{"update"},
+						Before:  map[string]any{"id": "i-123", "instance_type": "t3.micro"},
+						After:   map[string]any{"id": "i-123", "instance_type": "t3.large"},
+					},
+				},
+				{
+					Address: "aws_s3_bucket.logs",
+					Mode:    "managed",
+					Type:    "aws_s3_bucket",
+					Name:    "logs",
+					Change: Change{
+						Actions: []string{"delete"},
+						Before:  map[string]any{"bucket": "logs"},
+					},
+				},
+			},
+		},
+	}
+
+	expected := `Objects have changed outside of OpenTofu:
+
+# aws_instance.web has changed
+~   resource "aws_instance" "web" {
+~       instance_type = "t3.micro" -> "t3.large"
+        # (1 unchanged attribute hidden)
+    }
+
+# aws_s3_bucket.logs has been deleted
+-   resource "aws_s3_bucket" "logs" {
+-       bucket = "logs" -> null
+    }
+
+`
+	actual, err := result.Render(WithResourceDrift())
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+
+	actual, err = result.Render()
+	require.NoError(t, err)
+	assert.Empty(t, actual)
+}
@@ -0,0 +1,175 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const encryptionEnv = "TF_ENCRYPTION"
+
+// Encryption represents the configuration of the state and plan encryption passed by the TF_ENCRYPTION environment variable.
+// It's the same as the "encryption" block in the "terraform" block.
+// See https://opentofu.org/docs/language/state/encryption/
+type Encryption struct {
+	KeyProviders []KeyProvider
+	Methods      []EncryptionMethod
+	State        *EncryptionTarget
+	Plan         *EncryptionTarget
+}
+
+// KeyProvider represents a "key_provider" block.
+type KeyProvider struct {
+	// One of "pbkdf2" or "external".
+	Type string
+	Name string
+
+	// The attributes of the "pbkdf2" key provider.
+	// The zero values are not written to use the defaults of OpenTofu.
+	Passphrase   string
+	KeyLength    int
+	Iterations   int
+	SaltLength   int
+	HashFunction string
+
+	// The command of the "external" key provider.
+	Command []string
+}
+
+// EncryptionMethod represents a "method" block.
+type EncryptionMethod struct {
+	// One of "aes_gcm" or "unencrypted".
+	Type string
+	Name string
+	// The name of the key provider which provides the keys. Required for "aes_gcm".
+	KeyProvider string
+}
+
+// EncryptionTarget represents the "state" and the "plan" blocks.
+type EncryptionTarget struct {
+	// The name of the method used to encrypt and decrypt.
+	Method string
+	// The name of the method used to decrypt the data which can't be decrypted by Method,
+	// e.g. the data encrypted by the previous key while rotating keys.
+	Fallback string
+	// Whether to refuse writing the data unencrypted.
+	Enforced bool
+}
+
+// Bytes renders the configuration in the HCL native syntax.
+func (e Encryption) Bytes() ([]byte, error) {
+	f := hclwrite.NewEmptyFile()
+	body := f.Body()
+
+	providerTypes := make(map[string]string, len(e.KeyProviders))
+	for _, kp := range e.KeyProviders {
+		providerTypes[kp.Name] = kp.Type
+		b := body.AppendNewBlock("key_provider", []string{kp.Type, kp.Name}).Body()
+		switch kp.Type {
+		case "pbkdf2":
+			b.SetAttributeValue("passphrase", cty.StringVal(kp.Passphrase))
+			setIntAttribute(b, "key_length", kp.KeyLength)
+			setIntAttribute(b, "iterations", kp.Iterations)
+			setIntAttribute(b, "salt_length", kp.SaltLength)
+			if kp.HashFunction != "" {
+				b.SetAttributeValue("hash_function", cty.StringVal(kp.HashFunction))
+			}
+		case "external":
+			b.SetAttributeValue("command", stringListVal(kp.Command))
+		default:
+			return nil, fmt.Errorf("unsupported key provider type %q", kp.Type)
+		}
+	}
+
+	methodTypes := make(map[string]string, len(e.Methods))
+	for _, m := range e.Methods {
+		methodTypes[m.Name] = m.Type
+		b := body.AppendNewBlock("method", []string{m.Type, m.Name}).Body()
+		if m.KeyProvider == "" {
+			continue
+		}
+		t, ok := providerTypes[m.KeyProvider]
+		if !ok {
+			return nil, fmt.Errorf("method %q refers to unknown key provider %q", m.Name, m.KeyProvider)
+		}
+		b.SetAttributeTraversal("keys", traversal("key_provider", t, m.KeyProvider))
+	}
+
+	targets := []struct {
+		name   string
+		target *EncryptionTarget
+	}{
+		{"state", e.State},
+		{"plan", e.Plan},
+	}
+	for _, tt := range targets {
+		name, target := tt.name, tt.target
+		if target == nil {
+			continue
+		}
+		t, ok := methodTypes[target.Method]
+		if !ok {
+			return nil, fmt.Errorf("%s refers to unknown method %q", name, target.Method)
+		}
+		b := body.AppendNewBlock(name, nil).Body()
+		b.SetAttributeTraversal("method", traversal("method", t, target.Method))
+		if target.Enforced {
+			b.SetAttributeValue("enforced", cty.True)
+		}
+		if target.Fallback != "" {
+			ft, ok := methodTypes[target.Fallback]
+			if !ok {
+				return nil, fmt.Errorf("%s refers to unknown fallback method %q", name, target.Fallback)
+			}
+			b.AppendNewBlock("fallback", nil).Body().SetAttributeTraversal("method", traversal("method", ft, target.Fallback))
+		}
+	}
+
+	return f.Bytes(), nil
+}
+
+// WithEncryption makes every command use the given encryption configuration.
+func WithEncryption(e Encryption) (Option, error) {
+	data, err := e.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	var secrets []string
+	for _, kp := range e.KeyProviders {
+		secrets = append(secrets, kp.Passphrase)
+	}
+	return func(opts *options) {
+		opts.sharedEnvs = append(opts.sharedEnvs, fmt.Sprintf("%s=%s", encryptionEnv, data))
+		opts.secrets = append(opts.secrets, secrets...)
+	}, nil
+}
+
+func traversal(names ...string) hcl.Traversal {
+	t := hcl.Traversal{hcl.TraverseRoot{Name: names[0]}}
+	for _, n := range names[1:] {
+		t = append(t, hcl.TraverseAttr{Name: n})
+	}
+	return t
+}
+
+func setIntAttribute(body *hclwrite.Body, name string, v int) {
+	if v != 0 {
+		body.SetAttributeValue(name, cty.NumberIntVal(int64(v)))
+	}
+}
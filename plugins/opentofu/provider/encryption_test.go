@@ -0,0 +1,146 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryption_Bytes(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		name       string
+		encryption Encryption
+		expected   string
+		wantErr    bool
+	}{
+		{
+			name: "pbkdf2 with fallback for key rotation",
+			encryption: Encryption{
+				KeyProviders: []KeyProvider{
+					{Type: "pbkdf2", Name: "new", Passphrase: "new-passphrase", Iterations: 600000},
+					{Type: "pbkdf2", Name: "old", Passphrase: "old-passphrase"},
+				},
+				Methods: []EncryptionMethod{
+					{Type: "aes_gcm", Name: "new", KeyProvider: "new"},
+					{Type: "aes_gcm", Name: "old", KeyProvider: "old"},
+				},
+				State: &EncryptionTarget{Method: "new", Fallback: "old", Enforced: true},
+				Plan:  &EncryptionTarget{Method: "new"},
+			},
+			expected: `key_provider "pbkdf2" "new" {
+  passphrase = "new-passphrase"
+  iterations = 600000
+}
+key_provider "pbkdf2" "old" {
+  passphrase = "old-passphrase"
+}
+method "aes_gcm" "new" {
+  keys = key_provider.pbkdf2.new
+}
+method "aes_gcm" "old" {
+  keys = key_provider.pbkdf2.old
+}
+state {
+  method   = method.aes_gcm.new
+  enforced = true
+  fallback {
+    method = method.aes_gcm.old
+  }
+}
+plan {
+  method = method.aes_gcm.new
+}
+`,
+		},
+		{
+			name: "external key provider migrating from unencrypted state",
+			encryption: Encryption{
+				KeyProviders: []KeyProvider{
+					{Type: "external", Name: "kms", Command: []string{"/usr/local/bin/keys", "--format=json"}},
+				},
+				Methods: []EncryptionMethod{
+					{Type: "aes_gcm", Name: "default", KeyProvider: "kms"},
+					{Type: "unencrypted", Name: "migrate"},
+				},
+				State: &EncryptionTarget{Method: "default", Fallback: "migrate"},
+			},
+			expected: `key_provider "external" "kms" {
+  command = ["/usr/local/bin/keys", "--format=json"]
+}
+method "aes_gcm" "default" {
+  keys = key_provider.external.kms
+}
+method "unencrypted" "migrate" {
+}
+state {
+  method = method.aes_gcm.default
+  fallback {
+    method = method.unencrypted.migrate
+  }
+}
+`,
+		},
+		{
+			name: "unknown key provider",
+			encryption: Encryption{
+				Methods: []EncryptionMethod{{Type: "aes_gcm", Name: "default", KeyProvider: "missing"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown fallback method",
+			encryption: Encryption{
+				Methods: []EncryptionMethod{{Type: "unencrypted", Name: "migrate"}},
+				State:   &EncryptionTarget{Method: "migrate", Fallback: "missing"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			data, err := tc.encryption.Bytes()
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, string(data))
+		})
+	}
+}
+
+func TestWithEncryption(t *testing.T) {
+	t.Parallel()
+
+	opt, err := WithEncryption(Encryption{
+		KeyProviders: []KeyProvider{{Type: "pbkdf2", Name: "default", Passphrase: "s3cr3t-passphrase"}},
+		Methods:      []EncryptionMethod{{Type: "aes_gcm", Name: "default", KeyProvider: "default"}},
+		State:        &EncryptionTarget{Method: "default"},
+	})
+	require.NoError(t, err)
+
+	var opts options
+	opt(&opts)
+	require.Len(t, opts.sharedEnvs, 1)
+	assert.Contains(t, opts.sharedEnvs[0], "TF_ENCRYPTION=key_provider \"pbkdf2\" \"default\"")
+	assert.Equal(t, []string{"s3cr3t-passphrase"}, opts.secrets)
+}
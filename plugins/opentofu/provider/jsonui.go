@@ -0,0 +1,401 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// uiMessage represents a line of the machine-readable UI output enabled by the "-json" flag.
+// See https://opentofu.org/docs/internals/machine-readable-ui/
+type uiMessage struct {
+	Level      string           `json:"@level"`
+	Message    string           `json:"@message"`
+	Type       string           `json:"type"`
+	Hook       *uiHook          `json:"hook,omitempty"`
+	Diagnostic *Diagnostic      `json:"diagnostic,omitempty"`
+	Changes    *uiChangeSummary `json:"changes,omitempty"`
+
+	// The fields reported by "tofu test".
+	TestFileName string      `json:"@testfile,omitempty"`
+	TestRunName  string      `json:"@testrun,omitempty"`
+	TestFile     *uiTestFile `json:"test_file,omitempty"`
+	TestRun      *uiTestRun  `json:"test_run,omitempty"`
+}
+
+type uiHook struct {
+	Resource struct {
+		Addr string `json:"addr"`
+	} `json:"resource"`
+	Action         string  `json:"action"`
+	IDKey          string  `json:"id_key,omitempty"`
+	IDValue        string  `json:"id_value,omitempty"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+}
+
+type uiChangeSummary struct {
+	Add       int    `json:"add"`
+	Change    int    `json:"change"`
+	Import    int    `json:"import"`
+	Remove    int    `json:"remove"`
+	Operation string `json:"operation"`
+}
+
+// Diagnostic represents an error or a warning reported by OpenTofu.
+type Diagnostic struct {
+	Severity string             `json:"severity"`
+	Summary  string             `json:"summary"`
+	Detail   string             `json:"detail"`
+	Address  string             `json:"address,omitempty"`
+	Range    *DiagnosticRange   `json:"range,omitempty"`
+	Snippet  *DiagnosticSnippet `json:"snippet,omitempty"`
+}
+
+// DiagnosticRange represents the location in the configuration which a diagnostic refers to.
+type DiagnosticRange struct {
+	Filename string `json:"filename"`
+	Start    struct {
+		Line   int `json:"line"`
+		Column int `json:"column"`
+	} `json:"start"`
+}
+
+// DiagnosticSnippet represents the source code which a diagnostic refers to.
+type DiagnosticSnippet struct {
+	// The block which contains the code, e.g. `resource "aws_instance" "web"`.
+	Context string `json:"context,omitempty"`
+	// The lines of the source code which contain the range.
+	Code      string `json:"code"`
+	StartLine int    `json:"start_line"`
+	// The byte offsets of the range in the code.
+	HighlightStartOffset int `json:"highlight_start_offset"`
+	HighlightEndOffset   int `json:"highlight_end_offset"`
+}
+
+// String returns a human readable representation of the diagnostic.
+func (d Diagnostic) String() string {
+	var b strings.Builder
+	if d.Severity == "warning" {
+		b.WriteString("Warning: ")
+	} else {
+		b.WriteString("Error: ")
+	}
+	b.WriteString(d.Summary)
+	if d.Range != nil {
+		fmt.Fprintf(&b, " (%s:%d)", d.Range.Filename, d.Range.Start.Line)
+	}
+	if d.Address != "" {
+		fmt.Fprintf(&b, " [%s]", d.Address)
+	}
+	if d.Detail != "" {
+		b.WriteString("\n  ")
+		b.WriteString(strings.ReplaceAll(d.Detail, "\n", "\n  "))
+	}
+	return b.String()
+}
+
+// StringWithSnippet returns a human readable representation of the diagnostic with its location formatted by "file:line:column"
+// and the source code which it refers to.
+func (d Diagnostic) StringWithSnippet() string {
+	var b strings.Builder
+	if d.Severity == "warning" {
+		b.WriteString("Warning: ")
+	} else {
+		b.WriteString("Error: ")
+	}
+	b.WriteString(d.Summary)
+	if d.Address != "" {
+		fmt.Fprintf(&b, " [%s]", d.Address)
+	}
+
+	if d.Range != nil {
+		fmt.Fprintf(&b, "\n  on %s:%d:%d", d.Range.Filename, d.Range.Start.Line, d.Range.Start.Column)
+		if d.Snippet != nil && d.Snippet.Context != "" {
+			fmt.Fprintf(&b, ", in %s", d.Snippet.Context)
+		}
+	}
+	if sn := d.Snippet; sn != nil && sn.Code != "" {
+		offset := 0
+		for i, line := range strings.Split(strings.TrimSuffix(sn.Code, "\n"), "\n") {
+			prefix := fmt.Sprintf("  %4d: ", sn.StartLine+i)
+			b.WriteString("\n" + prefix + line)
+			// Underline the highlighted range in this line.
+			start := max(sn.HighlightStartOffset-offset, 0)
+			end := min(sn.HighlightEndOffset-offset, len(line))
+			if start < end {
+				b.WriteString("\n" + strings.Repeat(" ", len(prefix)+start) + strings.Repeat("^", end-start))
+			}
+			offset += len(line) + 1
+		}
+	}
+
+	if d.Detail != "" {
+		b.WriteString("\n\n  ")
+		b.WriteString(strings.ReplaceAll(d.Detail, "\n", "\n  "))
+	}
+	return b.String()
+}
+
+// ResourceStatus represents the status of a resource while applying.
+type ResourceStatus string
+
+const (
+	ResourceStatusApplying ResourceStatus = "applying"
+	ResourceStatusComplete ResourceStatus = "complete"
+	ResourceStatusErrored  ResourceStatus = "errored"
+)
+
+// ResourceProgress represents the progress of a resource while applying.
+type ResourceProgress struct {
+	Address string
+	Action  string
+	Status  ResourceStatus
+	Elapsed time.Duration
+}
+
+// ApplyResult represents the result of "tofu apply" collected from the machine-readable UI output.
+type ApplyResult struct {
+	// The resources in the order they started to be applied.
+	Resources   []*ResourceProgress
+	Diagnostics []Diagnostic
+}
+
+// Unfinished returns the resources which started to be applied but have not completed or errored.
+// Those resources may be in an unknown state when the apply was interrupted.
+func (r ApplyResult) Unfinished() []*ResourceProgress {
+	var out []*ResourceProgress
+	for _, res := range r.Resources {
+		if res.Status == ResourceStatusApplying {
+			out = append(out, res)
+		}
+	}
+	return out
+}
+
+// Summary returns a table of the elapsed time for each resource, the slowest first.
+func (r ApplyResult) Summary() string {
+	if len(r.Resources) == 0 {
+		return ""
+	}
+
+	resources := slices.Clone(r.Resources)
+	slices.SortStableFunc(resources, func(a, b *ResourceProgress) int {
+		return cmp.Compare(b.Elapsed, a.Elapsed)
+	})
+
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESOURCE\tACTION\tSTATUS\tELAPSED")
+	for _, res := range resources {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", res.Address, res.Action, res.Status, res.Elapsed)
+	}
+	tw.Flush()
+	return buf.String()
+}
+
+// uiStreamer is an io.Writer which converts the machine-readable UI output into human readable lines.
+// Lines which are not formatted as JSON are written as they are.
+type uiStreamer struct {
+	w   io.Writer
+	buf []byte
+
+	summary     *uiChangeSummary
+	resources   []*ResourceProgress
+	diagnostics []Diagnostic
+	testFiles   []*TestFileResult
+	output      strings.Builder
+}
+
+func newUIStreamer(w io.Writer) *uiStreamer {
+	return &uiStreamer{w: w}
+}
+
+func (s *uiStreamer) Write(p []byte) (int, error) {
+	s.buf = append(s.buf, p...)
+	for {
+		i := bytes.IndexByte(s.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := s.buf[:i]
+		s.buf = s.buf[i+1:]
+		if err := s.handleLine(line); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush handles the remaining line which doesn't end with a newline.
+func (s *uiStreamer) Flush() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+	line := s.buf
+	s.buf = nil
+	return s.handleLine(line)
+}
+
+func (s *uiStreamer) handleLine(line []byte) error {
+	line = bytes.TrimRight(line, "\r")
+	if len(bytes.TrimSpace(line)) == 0 {
+		return nil
+	}
+
+	var msg uiMessage
+	if line[0] != '{' || json.Unmarshal(line, &msg) != nil {
+		return s.writeLine(string(line))
+	}
+
+	switch msg.Type {
+	case "apply_start":
+		if msg.Hook == nil {
+			break
+		}
+		s.resources = append(s.resources, &ResourceProgress{
+			Address: msg.Hook.Resource.Addr,
+			Action:  msg.Hook.Action,
+			Status:  ResourceStatusApplying,
+		})
+	case "apply_progress":
+		if res := s.findResource(msg.Hook); res != nil {
+			res.Elapsed = elapsed(msg.Hook)
+		}
+	case "apply_complete", "apply_errored":
+		if res := s.findResource(msg.Hook); res != nil {
+			res.Elapsed = elapsed(msg.Hook)
+			res.Status = ResourceStatusComplete
+			if msg.Type == "apply_errored" {
+				res.Status = ResourceStatusErrored
+			}
+		}
+	case "change_summary":
+		s.summary = msg.Changes
+	case "diagnostic":
+		if msg.Diagnostic != nil {
+			if msg.TestRunName != "" {
+				run := s.findTestRun(msg.TestFileName, msg.TestRunName)
+				run.Diagnostics = append(run.Diagnostics, *msg.Diagnostic)
+			} else {
+				s.diagnostics = append(s.diagnostics, *msg.Diagnostic)
+			}
+			return s.writeLine(msg.Diagnostic.String())
+		}
+	case "test_file":
+		if msg.TestFile != nil {
+			s.findTestFile(msg.TestFile.Path).Status = msg.TestFile.Status
+		}
+	case "test_run":
+		// The run blocks report their progress before completing when they take a while.
+		if r := msg.TestRun; r != nil && (r.Progress == "" || r.Progress == "complete") {
+			s.findTestRun(r.Path, r.Run).Status = r.Status
+		}
+	case "version":
+		// The version is already shown before executing the commands.
+		return nil
+	}
+
+	return s.writeLine(msg.Message)
+}
+
+func (s *uiStreamer) findResource(hook *uiHook) *ResourceProgress {
+	if hook == nil {
+		return nil
+	}
+	for i := len(s.resources) - 1; i >= 0; i-- {
+		if s.resources[i].Address == hook.Resource.Addr {
+			return s.resources[i]
+		}
+	}
+	return nil
+}
+
+func (s *uiStreamer) findTestFile(path string) *TestFileResult {
+	for _, f := range s.testFiles {
+		if f.Path == path {
+			return f
+		}
+	}
+	f := &TestFileResult{Path: path, Status: TestStatusPending}
+	s.testFiles = append(s.testFiles, f)
+	return f
+}
+
+func (s *uiStreamer) findTestRun(path, name string) *TestRunResult {
+	f := s.findTestFile(path)
+	for _, r := range f.Runs {
+		if r.Name == name {
+			return r
+		}
+	}
+	r := &TestRunResult{Name: name, Status: TestStatusPending}
+	f.Runs = append(f.Runs, r)
+	return r
+}
+
+func (s *uiStreamer) writeLine(line string) error {
+	if line == "" {
+		return nil
+	}
+	s.output.WriteString(line)
+	s.output.WriteString("\n")
+	_, err := io.WriteString(s.w, line+"\n")
+	return err
+}
+
+func (s *uiStreamer) planResult() PlanResult {
+	// The plan only has changes to outputs when there is no change summary.
+	result := PlanResult{
+		HasStateChanges: true,
+		PlanOutput:      s.output.String(),
+		Diagnostics:     s.diagnostics,
+	}
+	if c := s.summary; c != nil {
+		result.Adds = c.Add
+		result.Changes = c.Change
+		result.Destroys = c.Remove
+		result.Imports = c.Import
+	}
+	return result
+}
+
+func (s *uiStreamer) applyResult() ApplyResult {
+	return ApplyResult{
+		Resources:   s.resources,
+		Diagnostics: s.diagnostics,
+	}
+}
+
+func (s *uiStreamer) testResult() TestResult {
+	return TestResult{
+		Files:       s.testFiles,
+		Diagnostics: s.diagnostics,
+	}
+}
+
+func elapsed(hook *uiHook) time.Duration {
+	if hook == nil {
+		return 0
+	}
+	return time.Duration(hook.ElapsedSeconds * float64(time.Second))
+}
@@ -0,0 +1,141 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const applyJSONOutput = `{"@level":"info","@message":"OpenTofu 1.9.1","@module":"tofu.ui","type":"version","tofu":"1.9.1","ui":"1.2"}
+{"@level":"info","@message":"null_resource.a: Creating...","@module":"tofu.ui","type":"apply_start","hook":{"resource":{"addr":"null_resource.a"},"action":"create"}}
+{"@level":"info","@message":"null_resource.b: Creating...","@module":"tofu.ui","type":"apply_start","hook":{"resource":{"addr":"null_resource.b"},"action":"create"}}
+{"@level":"info","@message":"null_resource.a: Still creating... [10s elapsed]","@module":"tofu.ui","type":"apply_progress","hook":{"resource":{"addr":"null_resource.a"},"action":"create","elapsed_seconds":10}}
+{"@level":"info","@message":"null_resource.b: Creation complete after 1s [id=123]","@module":"tofu.ui","type":"apply_complete","hook":{"resource":{"addr":"null_resource.b"},"action":"create","id_key":"id","id_value":"123","elapsed_seconds":1}}
+{"@level":"error","@message":"Error: creation failed","@module":"tofu.ui","type":"diagnostic","diagnostic":{"severity":"error","summary":"creation failed","detail":"the API returned 500","address":"null_resource.a","range":{"filename":"main.tf","start":{"line":12,"column":1}}}}
+{"@level":"error","@message":"null_resource.a: Creation errored after 12s","@module":"tofu.ui","type":"apply_errored","hook":{"resource":{"addr":"null_resource.a"},"action":"create","elapsed_seconds":12}}
+not a json line
+`
+
+func TestUIStreamer_Apply(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	s := newUIStreamer(&out)
+
+	// Write the output in small chunks to make sure that lines split across writes are handled.
+	r := strings.NewReader(applyJSONOutput)
+	_, err := io.CopyBuffer(s, r, make([]byte, 7))
+	require.NoError(t, err)
+	require.NoError(t, s.Flush())
+
+	expected := `null_resource.a: Creating...
+null_resource.b: Creating...
+null_resource.a: Still creating... [10s elapsed]
+null_resource.b: Creation complete after 1s [id=123]
+Error: creation failed (main.tf:12) [null_resource.a]
+  the API returned 500
+null_resource.a: Creation errored after 12s
+not a json line
+`
+	assert.Equal(t, expected, out.String())
+
+	result := s.applyResult()
+	assert.Equal(t, []*ResourceProgress{
+		{Address: "null_resource.a", Action: "create", Status: ResourceStatusErrored, Elapsed: 12 * time.Second},
+		{Address: "null_resource.b", Action: "create", Status: ResourceStatusComplete, Elapsed: time.Second},
+	}, result.Resources)
+	assert.Empty(t, result.Unfinished())
+	require.Len(t, result.Diagnostics, 1)
+	assert.Equal(t, "creation failed", result.Diagnostics[0].Summary)
+
+	expectedSummary := `RESOURCE         ACTION  STATUS    ELAPSED
+null_resource.a  create  errored   12s
+null_resource.b  create  complete  1s
+`
+	assert.Equal(t, expectedSummary, result.Summary())
+}
+
+func TestApplyResult_Unfinished(t *testing.T) {
+	t.Parallel()
+
+	result := ApplyResult{
+		Resources: []*ResourceProgress{
+			{Address: "null_resource.a", Status: ResourceStatusComplete},
+			{Address: "null_resource.b", Status: ResourceStatusApplying},
+			{Address: "null_resource.c", Status: ResourceStatusErrored},
+		},
+	}
+	assert.Equal(t, []*ResourceProgress{result.Resources[1]}, result.Unfinished())
+}
+
+func TestUIStreamer_Plan(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		name     string
+		input    string
+		expected PlanResult
+	}{
+		{
+			name: "resource changes",
+			input: `{"@level":"info","@message":"null_resource.a: Plan to create","type":"planned_change","change":{"resource":{"addr":"null_resource.a"},"action":"create"}}
+{"@level":"info","@message":"Plan: 1 to import, 2 to add, 3 to change, 4 to destroy.","type":"change_summary","changes":{"add":2,"change":3,"import":1,"remove":4,"operation":"plan"}}
+`,
+			expected: PlanResult{
+				Imports:         1,
+				Adds:            2,
+				Changes:         3,
+				Destroys:        4,
+				HasStateChanges: true,
+				PlanOutput: `null_resource.a: Plan to create
+Plan: 1 to import, 2 to add, 3 to change, 4 to destroy.
+`,
+			},
+		},
+		{
+			name:  "changes to outputs only",
+			input: `{"@level":"info","@message":"Outputs: 1","type":"outputs","outputs":{"foo":{"sensitive":false,"action":"create"}}}`,
+			expected: PlanResult{
+				HasStateChanges: true,
+				PlanOutput:      "Outputs: 1\n",
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			s := newUIStreamer(io.Discard)
+			_, err := io.WriteString(s, tc.input)
+			require.NoError(t, err)
+			require.NoError(t, s.Flush())
+			assert.Equal(t, tc.expected, s.planResult())
+		})
+	}
+}
+
+func TestDiagnostic_String(t *testing.T) {
+	t.Parallel()
+
+	d := Diagnostic{Severity: "warning", Summary: "deprecated", Detail: "line1\nline2"}
+	assert.Equal(t, "Warning: deprecated\n  line1\n  line2", d.String())
+}
@@ -42,6 +42,8 @@ type ModuleMapping struct {
 
 // File represents a OpenTofu file.
 type File struct {
+	// The path to the file.
+	Path    string
 	Modules []*Module
 }
 
@@ -93,6 +95,7 @@ func LoadOpenTofuFiles(dir string) ([]File, error) {
 		}
 
 		tf := File{
+			Path:    fp,
 			Modules: make([]*Module, 0, len(fm.ModuleMappings)),
 		}
 		for _, m := range fm.ModuleMappings {
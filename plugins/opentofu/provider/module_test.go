@@ -37,6 +37,7 @@ func TestLoadOpenTofuFiles(t *testing.T) {
 			moduleDir: "./testdata/single_module",
 			expected: []File{
 				{
+					Path: "testdata/single_module/main.tf",
 					Modules: []*Module{
 						{
 							Name:    "helloworld",
@@ -53,6 +54,7 @@ func TestLoadOpenTofuFiles(t *testing.T) {
 			moduleDir: "./testdata/single_module_optional",
 			expected: []File{
 				{
+					Path: "testdata/single_module_optional/main.tf",
 					Modules: []*Module{
 						{
 							Name:    "helloworld",
@@ -69,6 +71,7 @@ func TestLoadOpenTofuFiles(t *testing.T) {
 			moduleDir: "./testdata/multi_modules",
 			expected: []File{
 				{
+					Path: "testdata/multi_modules/main.tf",
 					Modules: []*Module{
 						{
 							Name:    "helloworld_01",
@@ -90,6 +93,7 @@ func TestLoadOpenTofuFiles(t *testing.T) {
 			moduleDir: "./testdata/multi_modules_with_multi_files",
 			expected: []File{
 				{
+					Path: "testdata/multi_modules_with_multi_files/helloworld_01.tf",
 					Modules: []*Module{
 						{
 							Name:    "helloworld_01",
@@ -99,6 +103,7 @@ func TestLoadOpenTofuFiles(t *testing.T) {
 					},
 				},
 				{
+					Path: "testdata/multi_modules_with_multi_files/helloworld_02.tf",
 					Modules: []*Module{
 						{
 							Name:    "helloworld_02",
@@ -0,0 +1,281 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// defaultRegistryHost is the host of the module registry used when the source of a registry module has no host.
+const defaultRegistryHost = "registry.opentofu.org"
+
+var (
+	// exactVersionRegex matches a version constraint which allows only one version such as "1.2.0" or "= 1.2.0".
+	exactVersionRegex = regexp.MustCompile(`^(=\s*)?v?\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+	// commitSHARegex matches a full commit SHA-1 or SHA-256 hash.
+	commitSHARegex = regexp.MustCompile(`^([0-9a-f]{40}|[0-9a-f]{64})$`)
+	// versionTagRegex matches a tag which looks like a version such as "v1.2.0" or "1.2".
+	versionTagRegex = regexp.MustCompile(`^v?\d+(\.\d+)*([-+][0-9A-Za-z.-]+)?$`)
+)
+
+// ModuleSourcePolicy is the policy for the sources of the "module" blocks.
+type ModuleSourcePolicy struct {
+	// Require the remote modules to be pinned to a fixed version.
+	RequirePinned bool
+	// The locations allowed to be used. Empty means any location.
+	// A location is a host optionally followed by path segments such as "github.com/my-org" and "registry.opentofu.org/my-namespace".
+	Allowed []string
+	// The locations denied to be used. This takes precedence over Allowed.
+	Denied []string
+}
+
+// ModuleSourceViolation represents a "module" block which violates the policy.
+type ModuleSourceViolation struct {
+	// The path to the file which has the block.
+	File string
+	// The name of the "module" block.
+	Module string
+	Source string
+	Reason string
+}
+
+func (v ModuleSourceViolation) String() string {
+	return fmt.Sprintf("%s: module %q (source %q): %s", v.File, v.Module, v.Source, v.Reason)
+}
+
+// CheckModuleTree returns the "module" blocks which violate the policy in the module in dir
+// and in the local modules called from it recursively.
+// The local modules must be inside root, so that a module outside the application directory can't be used to bypass the policy.
+func CheckModuleTree(root, dir string, p ModuleSourcePolicy) ([]ModuleSourceViolation, error) {
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		violations []ModuleSourceViolation
+		visited    = make(map[string]struct{})
+		walk       func(dir string) error
+	)
+	walk = func(dir string) error {
+		realDir, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return err
+		}
+		if _, ok := visited[realDir]; ok {
+			return nil
+		}
+		visited[realDir] = struct{}{}
+
+		tfs, err := LoadOpenTofuFiles(dir)
+		if err != nil {
+			return fmt.Errorf("failed to load the module in %s: %w", dir, err)
+		}
+		violations = append(violations, CheckModuleSources(tfs, p)...)
+
+		for _, tf := range tfs {
+			for _, m := range tf.Modules {
+				if parseModuleSource(m.Source).kind != moduleSourceLocal {
+					continue
+				}
+				child := filepath.Join(filepath.Dir(tf.Path), m.Source)
+				if !isInside(root, child) {
+					violations = append(violations, ModuleSourceViolation{
+						File:   tf.Path,
+						Module: m.Name,
+						Source: m.Source,
+						Reason: "local module outside the application directory can't be checked",
+					})
+					continue
+				}
+				if err := walk(child); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(dir); err != nil {
+		return nil, err
+	}
+	return violations, nil
+}
+
+// isInside returns true when the path resolved following the symlinks is root or under it.
+func isInside(root, path string) bool {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		// The directory doesn't exist, so it is checked only lexically and fails to be loaded later.
+		resolved = filepath.Clean(path)
+	}
+	rel, err := filepath.Rel(root, resolved)
+	return err == nil && filepath.IsLocal(rel)
+}
+
+// CheckModuleSources returns the "module" blocks in the given files which violate the policy.
+// The local modules are always allowed. Use CheckModuleTree to check the modules called from them as well.
+func CheckModuleSources(tfs []File, p ModuleSourcePolicy) []ModuleSourceViolation {
+	var violations []ModuleSourceViolation
+	for _, tf := range tfs {
+		for _, m := range tf.Modules {
+			if reason := p.check(m); reason != "" {
+				violations = append(violations, ModuleSourceViolation{
+					File:   tf.Path,
+					Module: m.Name,
+					Source: m.Source,
+					Reason: reason,
+				})
+			}
+		}
+	}
+	return violations
+}
+
+func (p ModuleSourcePolicy) check(m *Module) string {
+	src := parseModuleSource(m.Source)
+	if src.kind == moduleSourceLocal {
+		return ""
+	}
+
+	if src.location != "" {
+		if matched := matchLocation(src.location, p.Denied); matched != "" {
+			return fmt.Sprintf("%s is denied by %q", src.location, matched)
+		}
+		if len(p.Allowed) > 0 && matchLocation(src.location, p.Allowed) == "" {
+			return fmt.Sprintf("%s is not in the allowed locations", src.location)
+		}
+	} else if len(p.Allowed) > 0 {
+		return "unable to determine the location of the source"
+	}
+
+	if !p.RequirePinned {
+		return ""
+	}
+	switch src.kind {
+	case moduleSourceRegistry:
+		if !exactVersionRegex.MatchString(strings.TrimSpace(m.Version)) {
+			return "registry module must have an exact version"
+		}
+	case moduleSourceGit:
+		ref := src.query.Get("ref")
+		if ref == "" {
+			return "git source must be pinned by ref=<commit SHA or tag>"
+		}
+		if !commitSHARegex.MatchString(ref) && !versionTagRegex.MatchString(ref) {
+			return fmt.Sprintf("ref %q is neither a commit SHA nor a version tag", ref)
+		}
+	default:
+		return "unable to verify that the source is pinned"
+	}
+	return ""
+}
+
+// matchLocation returns the first pattern matching the location.
+// A pattern matches the location equal to it or under it.
+func matchLocation(location string, patterns []string) string {
+	for _, p := range patterns {
+		p = strings.TrimSuffix(strings.ToLower(p), "/")
+		if location == p || strings.HasPrefix(location, p+"/") {
+			return p
+		}
+	}
+	return ""
+}
+
+type moduleSourceKind int
+
+const (
+	moduleSourceUnknown moduleSourceKind = iota
+	moduleSourceLocal
+	moduleSourceRegistry
+	moduleSourceGit
+)
+
+type moduleSource struct {
+	kind moduleSourceKind
+	// The host and the path to the module without the scheme, the user, the subdirectory and the query,
+	// such as "github.com/my-org/my-module" and "registry.opentofu.org/my-namespace/my-module/aws".
+	location string
+	query    url.Values
+}
+
+// parseModuleSource parses the module source address.
+// See https://opentofu.org/docs/language/modules/sources/
+func parseModuleSource(source string) moduleSource {
+	if strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../") {
+		return moduleSource{kind: moduleSourceLocal}
+	}
+
+	addr, rawQuery, _ := strings.Cut(source, "?")
+	query, _ := url.ParseQuery(rawQuery)
+
+	forced, rest, ok := strings.Cut(addr, "::")
+	if !ok {
+		forced, rest = "", addr
+	}
+	switch {
+	case forced == "git":
+	case forced != "":
+		return moduleSource{location: sourceLocation(rest), query: query}
+	case strings.HasPrefix(rest, "git@"), strings.HasPrefix(rest, "github.com/"), strings.HasPrefix(rest, "bitbucket.org/"):
+	case strings.Contains(rest, "://"):
+		return moduleSource{location: sourceLocation(rest), query: query}
+	default:
+		// The registry module address is "<host>/<namespace>/<name>/<system>" where the host is optional.
+		parts := strings.Split(stripSubdir(rest), "/")
+		switch len(parts) {
+		case 3:
+			parts = append([]string{defaultRegistryHost}, parts...)
+		case 4:
+		default:
+			return moduleSource{}
+		}
+		return moduleSource{kind: moduleSourceRegistry, location: strings.ToLower(strings.Join(parts, "/"))}
+	}
+	return moduleSource{kind: moduleSourceGit, location: sourceLocation(rest), query: query}
+}
+
+// sourceLocation returns the host and the path of the given address in the URL or the scp-like syntax.
+func sourceLocation(addr string) string {
+	addr = stripSubdir(addr)
+	if !strings.Contains(addr, "://") {
+		// The scp-like syntax such as "git@github.com:my-org/my-module.git".
+		if user, rest, ok := strings.Cut(addr, "@"); ok && !strings.Contains(user, "/") {
+			addr = strings.Replace(rest, ":", "/", 1)
+		}
+		addr = "//" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSuffix(u.Hostname()+u.Path, ".git"))
+}
+
+// stripSubdir removes the subdirectory specified by "//" from the address.
+func stripSubdir(addr string) string {
+	offset := 0
+	if i := strings.Index(addr, "://"); i >= 0 {
+		offset = i + len("://")
+	}
+	if i := strings.Index(addr[offset:], "//"); i >= 0 {
+		return addr[:offset+i]
+	}
+	return addr
+}
@@ -0,0 +1,201 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseModuleSource(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		source      string
+		kind        moduleSourceKind
+		location    string
+		expectedRef string
+	}{
+		{source: "./modules/vpc", kind: moduleSourceLocal},
+		{source: "../shared", kind: moduleSourceLocal},
+		{source: "hashicorp/consul/aws", kind: moduleSourceRegistry, location: "registry.opentofu.org/hashicorp/consul/aws"},
+		{source: "app.terraform.io/example-corp/k8s-cluster/azurerm//modules/node", kind: moduleSourceRegistry, location: "app.terraform.io/example-corp/k8s-cluster/azurerm"},
+		{source: "github.com/my-org/vpc?ref=v1.2.0", kind: moduleSourceGit, location: "github.com/my-org/vpc", expectedRef: "v1.2.0"},
+		{source: "git@github.com:my-org/vpc.git", kind: moduleSourceGit, location: "github.com/my-org/vpc"},
+		{source: "git::https://example.com/infra/vpc.git//modules/a?ref=main", kind: moduleSourceGit, location: "example.com/infra/vpc", expectedRef: "main"},
+		{source: "git::ssh://git@example.com/storage.git", kind: moduleSourceGit, location: "example.com/storage"},
+		{source: "s3::https://s3-eu-west-1.amazonaws.com/bucket/vpc.zip", kind: moduleSourceUnknown, location: "s3-eu-west-1.amazonaws.com/bucket/vpc.zip"},
+		{source: "https://example.com/vpc-module.zip", kind: moduleSourceUnknown, location: "example.com/vpc-module.zip"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.source, func(t *testing.T) {
+			t.Parallel()
+			got := parseModuleSource(tc.source)
+			assert.Equal(t, tc.kind, got.kind)
+			assert.Equal(t, tc.location, got.location)
+			assert.Equal(t, tc.expectedRef, got.query.Get("ref"))
+		})
+	}
+}
+
+func TestCheckModuleSources(t *testing.T) {
+	t.Parallel()
+
+	tfs := []File{
+		{
+			Path: "main.tf",
+			Modules: []*Module{
+				{Name: "local", Source: "./modules/local"},
+				{Name: "vpc", Source: "github.com/my-org/vpc?ref=v1.2.0"},
+				{Name: "sha", Source: "git::https://example.com/infra/db.git?ref=0123456789abcdef0123456789abcdef01234567"},
+				{Name: "branch", Source: "github.com/my-org/dns?ref=main"},
+				{Name: "unpinned_git", Source: "git@github.com:my-org/iam.git"},
+			},
+		},
+		{
+			Path: "registry.tf",
+			Modules: []*Module{
+				{Name: "consul", Source: "hashicorp/consul/aws", Version: "= 0.11.0"},
+				{Name: "range", Source: "my-namespace/network/aws", Version: "~> 1.0"},
+				{Name: "archive", Source: "https://example.com/vpc-module.zip"},
+			},
+		},
+	}
+
+	testcases := []struct {
+		name     string
+		policy   ModuleSourcePolicy
+		expected []ModuleSourceViolation
+	}{
+		{
+			name:   "no rules",
+			policy: ModuleSourcePolicy{},
+		},
+		{
+			name:   "require pinned",
+			policy: ModuleSourcePolicy{RequirePinned: true},
+			expected: []ModuleSourceViolation{
+				{File: "main.tf", Module: "branch", Source: "github.com/my-org/dns?ref=main", Reason: `ref "main" is neither a commit SHA nor a version tag`},
+				{File: "main.tf", Module: "unpinned_git", Source: "git@github.com:my-org/iam.git", Reason: "git source must be pinned by ref=<commit SHA or tag>"},
+				{File: "registry.tf", Module: "range", Source: "my-namespace/network/aws", Reason: "registry module must have an exact version"},
+				{File: "registry.tf", Module: "archive", Source: "https://example.com/vpc-module.zip", Reason: "unable to verify that the source is pinned"},
+			},
+		},
+		{
+			name: "allowed and denied locations",
+			policy: ModuleSourcePolicy{
+				Allowed: []string{"github.com/my-org", "registry.opentofu.org/hashicorp"},
+				Denied:  []string{"github.com/my-org/iam"},
+			},
+			expected: []ModuleSourceViolation{
+				{File: "main.tf", Module: "sha", Source: "git::https://example.com/infra/db.git?ref=0123456789abcdef0123456789abcdef01234567", Reason: "example.com/infra/db is not in the allowed locations"},
+				{File: "main.tf", Module: "unpinned_git", Source: "git@github.com:my-org/iam.git", Reason: `github.com/my-org/iam is denied by "github.com/my-org/iam"`},
+				{File: "registry.tf", Module: "range", Source: "my-namespace/network/aws", Reason: "registry.opentofu.org/my-namespace/network/aws is not in the allowed locations"},
+				{File: "registry.tf", Module: "archive", Source: "https://example.com/vpc-module.zip", Reason: "example.com/vpc-module.zip is not in the allowed locations"},
+			},
+		},
+		{
+			name:   "a pattern matches whole path segments",
+			policy: ModuleSourcePolicy{Denied: []string{"github.com/my"}},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.expected, CheckModuleSources(tfs, tc.policy))
+		})
+	}
+}
+
+func TestCheckModuleTree(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	write := func(path, content string) {
+		t.Helper()
+		path = filepath.Join(root, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	write("shared/main.tf", `
+module "shared" {
+  source = "github.com/my-org/shared"
+}
+`)
+	write("app/main.tf", `
+module "app" {
+  source = "./modules/app"
+}
+`)
+	write("app/modules/app/main.tf", `
+module "network" {
+  source = "../network"
+}
+module "unpinned" {
+  source = "git::https://github.com/my-org/db.git"
+}
+`)
+	// The local modules calling each other are checked only once.
+	write("app/modules/network/main.tf", `
+module "app" {
+  source = "../app"
+}
+module "outside" {
+  source = "../../../../outside"
+}
+`)
+
+	violations, err := CheckModuleTree(filepath.Join(root, "app"), filepath.Join(root, "app"), ModuleSourcePolicy{RequirePinned: true})
+	require.NoError(t, err)
+	assert.Equal(t, []ModuleSourceViolation{
+		{File: filepath.Join(root, "app", "modules", "app", "main.tf"), Module: "unpinned", Source: "git::https://github.com/my-org/db.git", Reason: "git source must be pinned by ref=<commit SHA or tag>"},
+		{File: filepath.Join(root, "app", "modules", "network", "main.tf"), Module: "outside", Source: "../../../../outside", Reason: "local module outside the application directory can't be checked"},
+	}, violations)
+
+	// A symlink doesn't allow to use a module outside the application directory.
+	write("linked/main.tf", `
+module "shared" {
+  source = "./shared"
+}
+`)
+	require.NoError(t, os.Symlink(filepath.Join(root, "shared"), filepath.Join(root, "linked", "shared")))
+	violations, err = CheckModuleTree(filepath.Join(root, "linked"), filepath.Join(root, "linked"), ModuleSourcePolicy{RequirePinned: true})
+	require.NoError(t, err)
+	assert.Equal(t, []ModuleSourceViolation{
+		{File: filepath.Join(root, "linked", "main.tf"), Module: "shared", Source: "./shared", Reason: "local module outside the application directory can't be checked"},
+	}, violations)
+
+	// A missing local module is an error.
+	write("missing/main.tf", `
+module "missing" {
+  source = "./modules/missing"
+}
+`)
+	_, err = CheckModuleTree(filepath.Join(root, "missing"), filepath.Join(root, "missing"), ModuleSourcePolicy{})
+	assert.Error(t, err)
+}
+
+func TestModuleSourceViolation_String(t *testing.T) {
+	t.Parallel()
+
+	v := ModuleSourceViolation{File: "main.tf", Module: "vpc", Source: "github.com/my-org/vpc", Reason: "git source must be pinned by ref=<commit SHA or tag>"}
+	assert.Equal(t, `main.tf: module "vpc" (source "github.com/my-org/vpc"): git source must be pinned by ref=<commit SHA or tag>`, v.String())
+}
@@ -18,19 +18,49 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// Engine represents the binary which the commands are executed with.
+type Engine string
+
+const (
+	// EngineOpenTofu is the default engine.
+	EngineOpenTofu  Engine = "opentofu"
+	EngineTerraform Engine = "terraform"
+)
+
+// Command returns the command name of the engine which is shown in the logs.
+func (e Engine) Command() string {
+	if e == EngineTerraform {
+		return "terraform"
+	}
+	return "tofu"
+}
+
+// DisplayName returns the product name of the engine which is shown in its outputs.
+func (e Engine) DisplayName() string {
+	if e == EngineTerraform {
+		return "Terraform"
+	}
+	return "OpenTofu"
+}
+
 type options struct {
+	engine   Engine
 	noColor  bool
-	vars     []string
+	jsonUI   bool
 	varFiles []string
+	varFile  string
+	secrets  []string
 
 	sharedFlags []string
 	initFlags   []string
@@ -41,8 +71,16 @@ type options struct {
 	initEnvs   []string
 	planEnvs   []string
 	applyEnvs  []string
+
+	gracePeriod time.Duration
+	runner      Runner
 }
 
+const defaultGracePeriod = 30 * time.Second
+
+// defaultWorkspace is the workspace which always exists.
+const defaultWorkspace = "default"
+
 type Option func(*options)
 
 func WithoutColor() Option {
@@ -51,9 +89,47 @@ func WithoutColor() Option {
 	}
 }
 
-func WithVars(vars []string) Option {
+// WithJSONOutput makes plan and apply stream the machine-readable UI output,
+// which is converted into human readable lines before being written.
+func WithJSONOutput() Option {
+	return func(opts *options) {
+		opts.jsonUI = true
+	}
+}
+
+func WithEngine(engine Engine) Option {
 	return func(opts *options) {
-		opts.vars = vars
+		opts.engine = engine
+	}
+}
+
+// WithGracePeriod sets how long to wait for the commands to stop after sending SIGINT on the context cancellation.
+// The commands are killed after this period.
+func WithGracePeriod(d time.Duration) Option {
+	return func(opts *options) {
+		opts.gracePeriod = d
+	}
+}
+
+// WithRunner replaces the runner which executes the commands.
+func WithRunner(r Runner) Option {
+	return func(opts *options) {
+		opts.runner = r
+	}
+}
+
+// WithVarFile passes the variable file generated for the vars after the other variable files,
+// so that the vars take precedence over the variables set by them.
+func WithVarFile(path string) Option {
+	return func(opts *options) {
+		opts.varFile = path
+	}
+}
+
+// WithSecrets masks the given values in every output of the commands.
+func WithSecrets(secrets []string) Option {
+	return func(opts *options) {
+		opts.secrets = append(opts.secrets, secrets...)
 	}
 }
 
@@ -81,15 +157,26 @@ func WithAdditionalEnvs(shared, init, plan, apply []string) Option {
 	}
 }
 
+// WithCLIConfigFile makes every command use the given CLI configuration file.
+func WithCLIConfigFile(path string) Option {
+	return func(opts *options) {
+		opts.sharedEnvs = append(opts.sharedEnvs, fmt.Sprintf("%s=%s", CLIConfigFileEnv, path))
+	}
+}
+
 type OpenTofu struct {
 	execPath string
 	dir      string
 
-	options options
+	options  options
+	redactor *strings.Replacer
 }
 
 func NewOpenTofu(execPath, dir string, opts ...Option) *OpenTofu {
-	opt := options{}
+	opt := options{
+		gracePeriod: defaultGracePeriod,
+		runner:      execRunner{},
+	}
 	for _, o := range opts {
 		o(&opt)
 	}
@@ -98,41 +185,46 @@ func NewOpenTofu(execPath, dir string, opts ...Option) *OpenTofu {
 		execPath: execPath,
 		dir:      dir,
 		options:  opt,
+		redactor: newRedactor(opt.secrets),
 	}
 }
 
+// Engine returns the engine which the commands are executed with.
+func (t *OpenTofu) Engine() Engine {
+	return t.options.engine
+}
+
 func (t *OpenTofu) Version(ctx context.Context) (string, error) {
 	args := []string{"version"}
-	cmd := exec.CommandContext(ctx, t.execPath, args...)
-	cmd.Dir = t.dir
-	cmd.Env = append(os.Environ(), t.options.sharedEnvs...)
+	cmd := t.newCommand(ctx, args, t.makeEnv())
 
 	out, err := cmd.CombinedOutput()
 	if err != nil {
-		return string(out), err
+		return t.redact(string(out)), err
 	}
 
-	return strings.TrimSpace(string(out)), nil
+	return strings.TrimSpace(t.redact(string(out))), nil
 }
 
-func (t *OpenTofu) Init(ctx context.Context, w io.Writer) error {
+// Init executes "tofu init".
+// The given flags are used only for this execution in addition to the configured ones, e.g. "-backend=false".
+func (t *OpenTofu) Init(ctx context.Context, w io.Writer, flags ...string) error {
 	args := []string{
 		"init",
 	}
 	args = append(args, t.makeCommonCommandArgs()...)
 	args = append(args, t.options.initFlags...)
+	args = append(args, flags...)
 
-	cmd := exec.CommandContext(ctx, t.execPath, args...)
-	cmd.Dir = t.dir
-	cmd.Stdout = w
-	cmd.Stderr = w
-
-	env := append(os.Environ(), t.options.sharedEnvs...)
-	env = append(env, t.options.initEnvs...)
-	cmd.Env = env
+	out := newRedactWriter(w, t.redactor)
+	cmd := t.newCommand(ctx, args, t.makeEnv(t.options.initEnvs...))
+	cmd.Stdout = out
+	cmd.Stderr = out
 
-	io.WriteString(w, fmt.Sprintf("tofu %s", strings.Join(args, " ")))
-	return cmd.Run()
+	io.WriteString(w, fmt.Sprintf("%s %s", t.options.engine.Command(), strings.Join(args, " ")))
+	err := cmd.Run()
+	out.Flush()
+	return err
 }
 
 func (t *OpenTofu) SelectWorkspace(ctx context.Context, workspace string) error {
@@ -141,19 +233,111 @@ func (t *OpenTofu) SelectWorkspace(ctx context.Context, workspace string) error
 		"select",
 		workspace,
 	}
-	cmd := exec.CommandContext(ctx, t.execPath, args...)
-	cmd.Dir = t.dir
-	cmd.Env = append(os.Environ(), t.options.sharedEnvs...)
+	cmd := t.newCommand(ctx, args, t.makeEnv())
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to select workspace: %s (%w)", t.redact(string(out)), err)
+	}
+
+	return nil
+}
+
+// ListWorkspaces executes "tofu workspace list" and returns the names of the workspaces.
+func (t *OpenTofu) ListWorkspaces(ctx context.Context) ([]string, error) {
+	args := []string{
+		"workspace",
+		"list",
+	}
+	cmd := t.newCommand(ctx, args, t.makeEnv())
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to list workspaces: %s (%w)", t.redact(stderr.String()), err)
+	}
+
+	var workspaces []string
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		// The current workspace is marked with "*".
+		if name := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "*")); name != "" {
+			workspaces = append(workspaces, name)
+		}
+	}
+	return workspaces, nil
+}
+
+// SelectOrCreateWorkspace executes "tofu workspace select" which creates the workspace when it doesn't exist.
+func (t *OpenTofu) SelectOrCreateWorkspace(ctx context.Context, workspace string) error {
+	args := []string{
+		"workspace",
+		"select",
+		"-or-create=true",
+		workspace,
+	}
+	cmd := t.newCommand(ctx, args, t.makeEnv())
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to select workspace: %s (%w)", t.redact(string(out)), err)
+	}
+
+	return nil
+}
+
+// DeleteWorkspace executes "tofu workspace delete" after selecting the default workspace,
+// because the current workspace can't be deleted.
+// It fails when the state of the workspace still has resources.
+func (t *OpenTofu) DeleteWorkspace(ctx context.Context, workspace string) error {
+	if err := t.SelectWorkspace(ctx, defaultWorkspace); err != nil {
+		return err
+	}
+
+	args := []string{
+		"workspace",
+		"delete",
+		workspace,
+	}
+	cmd := t.newCommand(ctx, args, t.makeEnv())
 
 	out, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("failed to select workspace: %s (%w)", string(out), err)
+		return fmt.Errorf("failed to delete workspace: %s (%w)", t.redact(string(out)), err)
 	}
 
 	return nil
 }
 
+// OutputValue is a root module output in the state.
+type OutputValue struct {
+	Sensitive bool `json:"sensitive"`
+	Value     any  `json:"value"`
+}
+
+// Output executes "tofu output -json" to read the root module outputs in the state.
+// The values of the secrets in them are masked.
+func (t *OpenTofu) Output(ctx context.Context) (map[string]OutputValue, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := t.newCommand(ctx, []string{"output", "-json"}, t.makeEnv())
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, t.redact(stderr.String()))
+	}
+
+	var outputs map[string]OutputValue
+	if err := json.Unmarshal([]byte(t.redact(stdout.String())), &outputs); err != nil {
+		return nil, fmt.Errorf("failed to parse the outputs: %w", err)
+	}
+	return outputs, nil
+}
+
 type PlanResult struct {
+	// The engine which generated the plan.
+	// Empty means OpenTofu.
+	Engine Engine
+
 	Adds            int
 	Changes         int
 	Destroys        int
@@ -161,28 +345,58 @@ type PlanResult struct {
 	HasStateChanges bool
 
 	PlanOutput string
+	// The structured plan which is used to render the changes.
+	// This is filled only when the machine-readable UI output is enabled.
+	Plan *Plan
+	// The errors and warnings reported while planning.
+	// This is filled only when the machine-readable UI output is enabled.
+	Diagnostics []Diagnostic
 }
 
 func (r PlanResult) NoChanges() bool {
 	return r.Adds == 0 && r.Changes == 0 && r.Destroys == 0 && r.Imports == 0 && !r.HasStateChanges
 }
 
-func (r PlanResult) Render() (string, error) {
-	tofuDiffStart := "OpenTofu will perform the following actions:"
+// Render returns the planned changes formatted as a unified diff.
+// The diff is built from the structured plan when it's available, otherwise from the human readable plan output.
+func (r PlanResult) Render(opts ...RenderOption) (string, error) {
+	if r.Plan == nil {
+		return r.renderPlanOutput()
+	}
+
+	o := renderOptions{engineName: r.Engine.DisplayName()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	out := renderPlan(r.Plan, o)
+	if r.Imports > 0 || r.Adds > 0 || r.Changes > 0 || r.Destroys > 0 {
+		out += fmt.Sprintf("Plan: %d to import, %d to add, %d to change, %d to destroy.\n", r.Imports, r.Adds, r.Changes, r.Destroys)
+	}
+	return out, nil
+}
+
+// renderPlanOutput extracts the changes from the human readable plan output,
+// and moves the signs to the beginning of the lines.
+func (r PlanResult) renderPlanOutput() (string, error) {
+	tofuDiffStart := fmt.Sprintf("%s will perform the following actions:", r.Engine.DisplayName())
 	if !strings.Contains(r.PlanOutput, tofuDiffStart) {
 		return "", nil
 	}
 	startIndex := strings.Index(r.PlanOutput, tofuDiffStart) + len(tofuDiffStart)
 
 	tofuDiffEnd := fmt.Sprintf("Plan: %d to import, %d to add, %d to change, %d to destroy.", r.Imports, r.Adds, r.Changes, r.Destroys)
-	endIndex := strings.Index(r.PlanOutput, tofuDiffEnd) + len(tofuDiffEnd)
-	if endIndex < startIndex {
+	endIndex := strings.Index(r.PlanOutput, tofuDiffEnd)
+	if endIndex < 0 {
+		// Older versions and Terraform omit the number of imports when nothing is imported.
 		tofuDiffEnd = fmt.Sprintf("Plan: %d to add, %d to change, %d to destroy.", r.Adds, r.Changes, r.Destroys)
-		endIndex = strings.Index(r.PlanOutput, tofuDiffEnd) + len(tofuDiffEnd)
+		endIndex = strings.Index(r.PlanOutput, tofuDiffEnd)
+	}
+	if endIndex >= 0 {
+		endIndex += len(tofuDiffEnd)
 	}
 
 	if endIndex < startIndex {
-		return "", fmt.Errorf("unable to parse OpenTofu plan result")
+		return "", fmt.Errorf("unable to parse %s plan result", r.Engine.DisplayName())
 	}
 
 	out := r.PlanOutput[startIndex:endIndex]
@@ -267,59 +481,161 @@ func GetExitCode(err error) int {
 	if err == nil {
 		return 0
 	}
-	if exitErr, ok := err.(*exec.ExitError); ok {
+	var exitErr interface{ ExitCode() int }
+	if errors.As(err, &exitErr) {
 		return exitErr.ExitCode()
 	}
 	return 1
 }
 
-func (t *OpenTofu) Plan(ctx context.Context, w io.Writer) (PlanResult, error) {
+// Plan executes "tofu plan".
+// The given flags are used only for this execution in addition to the configured ones, e.g. "-target=module.network".
+func (t *OpenTofu) Plan(ctx context.Context, w io.Writer, flags ...string) (PlanResult, error) {
 	args := []string{
 		"plan",
 		"-lock=false",
 		"-detailed-exitcode",
 	}
+	var planFile string
+	if t.options.jsonUI {
+		// Save the plan to build the structured plan from it.
+		f, err := os.CreateTemp("", "tofu-plan-")
+		if err != nil {
+			return PlanResult{}, err
+		}
+		f.Close()
+		planFile = f.Name()
+		defer os.Remove(planFile)
+		args = append(args, "-json", "-out="+planFile)
+	}
 	args = append(args, t.makeCommonCommandArgs()...)
 	args = append(args, t.options.planFlags...)
+	args = append(args, flags...)
+
+	var (
+		buf      bytes.Buffer
+		streamer *uiStreamer
+		stdout   io.Writer
+	)
+	if t.options.jsonUI {
+		streamer = newUIStreamer(w)
+		stdout = streamer
+	} else {
+		stdout = io.MultiWriter(w, &buf)
+	}
 
-	var buf bytes.Buffer
-	stdout := io.MultiWriter(w, &buf)
-
-	cmd := exec.CommandContext(ctx, t.execPath, args...)
-	cmd.Dir = t.dir
-	cmd.Stdout = stdout
-	cmd.Stderr = stdout
-
-	env := append(os.Environ(), t.options.sharedEnvs...)
-	env = append(env, t.options.planEnvs...)
-	cmd.Env = env
+	out := newRedactWriter(stdout, t.redactor)
+	cmd := t.newCommand(ctx, args, t.makeEnv(t.options.planEnvs...))
+	cmd.Stdout = out
+	cmd.Stderr = out
 
-	io.WriteString(w, fmt.Sprintf("tofu %s", strings.Join(args, " ")))
+	io.WriteString(w, fmt.Sprintf("%s %s", t.options.engine.Command(), strings.Join(args, " ")))
 	err := cmd.Run()
+	out.Flush()
+	if streamer != nil {
+		streamer.Flush()
+	}
 	switch GetExitCode(err) {
 	case 0:
-		return PlanResult{}, nil
+		if streamer == nil {
+			return PlanResult{Engine: t.options.engine}, nil
+		}
+		// Keep the warnings and the results of the checks which are reported even when there are no changes.
+		result := PlanResult{Engine: t.options.engine, PlanOutput: streamer.output.String(), Diagnostics: streamer.diagnostics}
+		plan, err := t.showPlan(ctx, planFile)
+		if err != nil {
+			return result, fmt.Errorf("failed to show the structured plan: %w", err)
+		}
+		result.Plan = plan
+		return result, nil
 	case 2:
-		return parsePlanResult(buf.String(), !t.options.noColor)
+		if streamer != nil {
+			result := streamer.planResult()
+			result.Engine = t.options.engine
+			plan, err := t.showPlan(ctx, planFile)
+			if err != nil {
+				return result, fmt.Errorf("failed to show the structured plan: %w", err)
+			}
+			result.Plan = plan
+			return result, nil
+		}
+		result, err := parsePlanResult(buf.String(), !t.options.noColor)
+		result.Engine = t.options.engine
+		return result, err
 	default:
+		if streamer != nil {
+			return PlanResult{Diagnostics: streamer.diagnostics}, err
+		}
 		return PlanResult{}, err
 	}
 }
 
+// ShowState executes "tofu show -json" to read the current state.
+// The values of the secrets in it are masked.
+func (t *OpenTofu) ShowState(ctx context.Context) (*State, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := t.newCommand(ctx, []string{"show", "-json"}, t.makeEnv())
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, t.redact(stderr.String()))
+	}
+	return parseState([]byte(t.redact(stdout.String())))
+}
+
+// showPlan executes "tofu show -json" to read the saved plan file.
+// The values of the secrets in it are masked.
+func (t *OpenTofu) showPlan(ctx context.Context, planFile string) (*Plan, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := t.newCommand(ctx, []string{"show", "-json", planFile}, t.makeEnv())
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, t.redact(stderr.String()))
+	}
+	return parsePlan([]byte(t.redact(stdout.String())))
+}
+
 func (t *OpenTofu) makeCommonCommandArgs() (args []string) {
 	if t.options.noColor {
 		args = append(args, "-no-color")
 	}
-	for _, v := range t.options.vars {
-		args = append(args, fmt.Sprintf("-var=%s", v))
-	}
 	for _, f := range t.options.varFiles {
 		args = append(args, fmt.Sprintf("-var-file=%s", f))
 	}
+	if t.options.varFile != "" {
+		args = append(args, fmt.Sprintf("-var-file=%s", t.options.varFile))
+	}
 	args = append(args, t.options.sharedFlags...)
 	return
 }
 
+// newCommand creates a command executed by the runner in the working directory.
+func (t *OpenTofu) newCommand(ctx context.Context, args []string, env []string) *Command {
+	return &Command{
+		Path:        t.execPath,
+		Args:        args,
+		Dir:         t.dir,
+		Env:         env,
+		GracePeriod: t.options.gracePeriod,
+		ctx:         ctx,
+		runner:      t.options.runner,
+	}
+}
+
+// makeEnv returns the environment variables for a command.
+func (t *OpenTofu) makeEnv(commandEnvs ...string) []string {
+	env := append(os.Environ(), t.options.sharedEnvs...)
+	return append(env, commandEnvs...)
+}
+
+func (t *OpenTofu) redact(s string) string {
+	if t.redactor == nil {
+		return s
+	}
+	return t.redactor.Replace(s)
+}
+
 var (
 	// Keep this regex for backward compatibility.
 	planHasChangeRegex  = regexp.MustCompile(`(?m)^Plan:(?: (\d+) to import,)?? (\d+) to add, (\d+) to change, (\d+) to destroy\.$`)
@@ -388,24 +704,40 @@ func parsePlanResult(out string, ansiIncluded bool) (PlanResult, error) {
 	return PlanResult{}, fmt.Errorf("unable to parse plan output")
 }
 
-func (t *OpenTofu) Apply(ctx context.Context, w io.Writer) error {
+// Apply executes "tofu apply".
+// The given flags are used only for this execution in addition to the configured ones, e.g. "-target=module.network".
+// The returned ApplyResult is filled only when the machine-readable UI output is enabled.
+func (t *OpenTofu) Apply(ctx context.Context, w io.Writer, flags ...string) (ApplyResult, error) {
 	args := []string{
 		"apply",
 		"-auto-approve",
 		"-input=false",
 	}
+	if t.options.jsonUI {
+		args = append(args, "-json")
+	}
 	args = append(args, t.makeCommonCommandArgs()...)
 	args = append(args, t.options.applyFlags...)
+	args = append(args, flags...)
 
-	cmd := exec.CommandContext(ctx, t.execPath, args...)
-	cmd.Dir = t.dir
-	cmd.Stdout = w
-	cmd.Stderr = w
+	var streamer *uiStreamer
+	stdout := w
+	if t.options.jsonUI {
+		streamer = newUIStreamer(w)
+		stdout = streamer
+	}
 
-	env := append(os.Environ(), t.options.sharedEnvs...)
-	env = append(env, t.options.applyEnvs...)
-	cmd.Env = env
+	out := newRedactWriter(stdout, t.redactor)
+	cmd := t.newCommand(ctx, args, t.makeEnv(t.options.applyEnvs...))
+	cmd.Stdout = out
+	cmd.Stderr = out
 
-	io.WriteString(w, fmt.Sprintf("tofu %s", strings.Join(args, " ")))
-	return cmd.Run()
+	io.WriteString(w, fmt.Sprintf("%s %s", t.options.engine.Command(), strings.Join(args, " ")))
+	err := cmd.Run()
+	out.Flush()
+	if streamer == nil {
+		return ApplyResult{}, err
+	}
+	streamer.Flush()
+	return streamer.applyResult(), err
 }
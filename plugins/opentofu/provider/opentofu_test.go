@@ -15,9 +15,15 @@
 package provider
 
 import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPlanHasChangeRegex(t *testing.T) {
@@ -240,6 +246,42 @@ Plan: 1 to import, 2 to add, 3 to change, 4 to destroy.
 `,
 			expectedErr: false,
 		},
+		{
+			name: "terraform",
+			planResult: &PlanResult{
+				Engine: EngineTerraform,
+				Adds:   1,
+				PlanOutput: `
+Terraform will perform the following actions:
+  + resource "test-add" "test" {
+      + id    = (known after apply)
+    }
+
+Plan: 1 to add, 0 to change, 0 to destroy.
+`,
+			},
+			expected: `    resource "test-add" "test" {
++       id    = (known after apply)
+    }
+Plan: 1 to add, 0 to change, 0 to destroy.
+`,
+			expectedErr: false,
+		},
+		{
+			name: "terraform output is not parsed as opentofu output",
+			planResult: &PlanResult{
+				Adds: 1,
+				PlanOutput: `
+Terraform will perform the following actions:
+  + resource "test-add" "test" {
+      + id    = (known after apply)
+    }
+
+Plan: 1 to add, 0 to change, 0 to destroy.
+`,
+			},
+			expected: "",
+		},
 		{
 			name: "New outputs",
 			planResult: &PlanResult{
@@ -300,3 +342,57 @@ guarantee to take exactly these actions if you run "opentofu apply" now.`,
 		})
 	}
 }
+
+func writeScript(t *testing.T, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tofu")
+	require.NoError(t, os.WriteFile(path, []byte(script), 0755))
+	return path
+}
+
+func TestOpenTofu_Apply_Interrupted(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		name           string
+		script         string
+		expectedOutput string
+	}{
+		{
+			name: "stops gracefully on SIGINT",
+			script: `#!/bin/sh
+trap 'echo interrupted; exit 1' INT
+echo started
+while true; do sleep 0.1; done
+`,
+			expectedOutput: "interrupted",
+		},
+		{
+			name: "killed after the grace period",
+			script: `#!/bin/sh
+trap '' INT
+echo started
+while true; do sleep 0.1; done
+`,
+			expectedOutput: "started",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tofu := NewOpenTofu(writeScript(t, tc.script), t.TempDir(), WithGracePeriod(500*time.Millisecond))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+			defer cancel()
+
+			var buf bytes.Buffer
+			start := time.Now()
+			_, err := tofu.Apply(ctx, &buf)
+			assert.Error(t, err)
+			assert.Less(t, time.Since(start), 5*time.Second)
+			assert.Contains(t, buf.String(), tc.expectedOutput)
+		})
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+)
+
+// Plan represents the structured plan output by "tofu show -json".
+// Only the fields used by the plugin are defined.
+// See https://opentofu.org/docs/internals/json-format/
+type Plan struct {
+	FormatVersion   string           `json:"format_version"`
+	ResourceChanges []ResourceChange `json:"resource_changes,omitempty"`
+	// The changes made outside of OpenTofu which are detected while refreshing.
+	ResourceDrift []ResourceChange  `json:"resource_drift,omitempty"`
+	OutputChanges map[string]Change `json:"output_changes,omitempty"`
+	// The results of the check blocks and the conditions evaluated while planning.
+	Checks []CheckResult `json:"checks,omitempty"`
+}
+
+// ResourceChange represents the planned change for a resource instance.
+type ResourceChange struct {
+	Address       string `json:"address"`
+	ModuleAddress string `json:"module_address,omitempty"`
+	Mode          string `json:"mode"`
+	Type          string `json:"type"`
+	Name          string `json:"name"`
+	Change        Change `json:"change"`
+	ActionReason  string `json:"action_reason,omitempty"`
+}
+
+// Change represents the values before and after a planned change.
+// The values are decoded as generic JSON values, and the numbers are kept as json.Number.
+type Change struct {
+	Actions []string `json:"actions"`
+	Before  any      `json:"before"`
+	After   any      `json:"after"`
+	// The same structure as After where true marks the values unknown until applied.
+	AfterUnknown any `json:"after_unknown,omitempty"`
+	// The same structure as Before/After where true marks the sensitive values.
+	BeforeSensitive any `json:"before_sensitive,omitempty"`
+	AfterSensitive  any `json:"after_sensitive,omitempty"`
+	// The paths to the attributes which force the resource to be replaced.
+	ReplacePaths [][]any    `json:"replace_paths,omitempty"`
+	Importing    *Importing `json:"importing,omitempty"`
+}
+
+// Importing represents the object to be imported by the change.
+type Importing struct {
+	ID string `json:"id"`
+}
+
+// ChangeAction represents the kind of a planned change.
+type ChangeAction string
+
+const (
+	ChangeActionNoop    ChangeAction = "no-op"
+	ChangeActionCreate  ChangeAction = "create"
+	ChangeActionRead    ChangeAction = "read"
+	ChangeActionUpdate  ChangeAction = "update"
+	ChangeActionDelete  ChangeAction = "delete"
+	ChangeActionReplace ChangeAction = "replace"
+	ChangeActionForget  ChangeAction = "forget"
+)
+
+// Action returns the kind of the change.
+// Both "delete then create" and "create then delete" are reported as ChangeActionReplace.
+func (c Change) Action() ChangeAction {
+	if len(c.Actions) == 2 && slices.Contains(c.Actions, "create") && slices.Contains(c.Actions, "delete") {
+		return ChangeActionReplace
+	}
+	if len(c.Actions) == 1 {
+		return ChangeAction(c.Actions[0])
+	}
+	return ChangeActionNoop
+}
+
+// createBeforeDestroy returns true when the replacement is created before the current object is destroyed.
+func (c Change) createBeforeDestroy() bool {
+	return len(c.Actions) == 2 && c.Actions[0] == "create"
+}
+
+// parsePlan decodes the output of "tofu show -json".
+func parsePlan(data []byte) (*Plan, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var p Plan
+	if err := dec.Decode(&p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// MaskSensitive returns a copy of the plan whose sensitive values are replaced with "(sensitive value)",
+// so that it can be stored outside of the state.
+func (p *Plan) MaskSensitive() *Plan {
+	out := *p
+	out.ResourceChanges = maskResourceChanges(p.ResourceChanges)
+	out.ResourceDrift = maskResourceChanges(p.ResourceDrift)
+	if p.OutputChanges != nil {
+		out.OutputChanges = make(map[string]Change, len(p.OutputChanges))
+		for name, c := range p.OutputChanges {
+			out.OutputChanges[name] = c.maskSensitive()
+		}
+	}
+	return &out
+}
+
+func maskResourceChanges(changes []ResourceChange) []ResourceChange {
+	if changes == nil {
+		return nil
+	}
+	out := make([]ResourceChange, len(changes))
+	for i, rc := range changes {
+		rc.Change = rc.Change.maskSensitive()
+		out[i] = rc
+	}
+	return out
+}
+
+func (c Change) maskSensitive() Change {
+	c.Before = maskSensitive(c.Before, c.BeforeSensitive)
+	c.After = maskSensitive(c.After, c.AfterSensitive)
+	return c
+}
+
+func maskSensitive(v, sensitive any) any {
+	if isTrue(sensitive) {
+		if v == nil {
+			return nil
+		}
+		return sensitiveValue
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, e := range v {
+			out[k] = maskSensitive(e, child(sensitive, k))
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = maskSensitive(e, child(sensitive, i))
+		}
+		return out
+	}
+	return v
+}
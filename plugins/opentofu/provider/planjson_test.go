@@ -0,0 +1,50 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan_MaskSensitive(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile("testdata/plan.json")
+	require.NoError(t, err)
+	plan, err := parsePlan(data)
+	require.NoError(t, err)
+
+	masked := plan.MaskSensitive()
+	out, err := json.Marshal(masked)
+	require.NoError(t, err)
+	assert.NotContains(t, string(out), `"password":"old"`)
+	assert.NotContains(t, string(out), `"password":"new"`)
+
+	policy := masked.ResourceChanges[1]
+	require.Equal(t, "aws_iam_policy.this", policy.Address)
+	assert.Equal(t, sensitiveValue, policy.Change.Before.(map[string]any)["password"])
+	assert.Equal(t, sensitiveValue, policy.Change.After.(map[string]any)["password"])
+	assert.Equal(t, "policy", policy.Change.After.(map[string]any)["name"])
+	assert.Equal(t, sensitiveValue, masked.OutputChanges["token"].After)
+	assert.Equal(t, "x", masked.OutputChanges["same"].After)
+
+	// The original plan is kept as is.
+	assert.Equal(t, "new", plan.ResourceChanges[1].Change.After.(map[string]any)["password"])
+}
@@ -0,0 +1,159 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package providertest provides a fake runner to test the OpenTofu commands without the binary.
+package providertest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/provider"
+)
+
+// Response is a recorded result of a command.
+type Response struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// ExitError is returned when the response has a non-zero exit code.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+// Call is a command executed by the runner.
+type Call struct {
+	Args []string
+	Dir  string
+	Env  []string
+	// The contents of the files passed with the "-var-file" flags, read when the command is executed.
+	VarFiles []string
+}
+
+// Runner replays the recorded responses for the commands.
+// The commands without any registered responses succeed with no output.
+type Runner struct {
+	mu        sync.Mutex
+	responses map[string][]Response
+	calls     []Call
+}
+
+var _ provider.Runner = (*Runner)(nil)
+
+func NewRunner() *Runner {
+	return &Runner{responses: make(map[string][]Response)}
+}
+
+// On registers the responses for the given subcommand such as "plan" or "workspace select".
+// The responses are replayed in order for each execution, and the last one is repeated.
+func (r *Runner) On(subcommand string, responses ...Response) *Runner {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responses[subcommand] = append(r.responses[subcommand], responses...)
+	return r
+}
+
+// Run writes the next response for the command, or returns the context error when the context is done.
+func (r *Runner) Run(ctx context.Context, cmd *provider.Command) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.calls = append(r.calls, Call{Args: cmd.Args, Dir: cmd.Dir, Env: cmd.Env, VarFiles: readVarFiles(cmd)})
+	resp, ok := r.next(cmd.Args)
+	r.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	if cmd.Stdout != nil {
+		io.WriteString(cmd.Stdout, resp.Stdout)
+	}
+	if cmd.Stderr != nil {
+		io.WriteString(cmd.Stderr, resp.Stderr)
+	}
+	if resp.ExitCode != 0 {
+		return &ExitError{Code: resp.ExitCode}
+	}
+	return nil
+}
+
+// readVarFiles returns the contents of the files passed with the "-var-file" flags.
+// The files which can't be read are returned as empty.
+func readVarFiles(cmd *provider.Command) []string {
+	var out []string
+	for _, arg := range cmd.Args {
+		path, ok := strings.CutPrefix(arg, "-var-file=")
+		if !ok {
+			continue
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(cmd.Dir, path)
+		}
+		data, _ := os.ReadFile(path)
+		out = append(out, string(data))
+	}
+	return out
+}
+
+// next returns the response of the longest subcommand matching the args.
+func (r *Runner) next(args []string) (Response, bool) {
+	for n := len(args); n > 0; n-- {
+		key := strings.Join(args[:n], " ")
+		responses, ok := r.responses[key]
+		if !ok || len(responses) == 0 {
+			continue
+		}
+		if len(responses) > 1 {
+			r.responses[key] = responses[1:]
+		}
+		return responses[0], true
+	}
+	return Response{}, false
+}
+
+// Calls returns the commands executed so far.
+func (r *Runner) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// Subcommands returns the first argument of the commands executed so far, e.g. ["version", "init", "plan"].
+func (r *Runner) Subcommands() []string {
+	calls := r.Calls()
+	out := make([]string, 0, len(calls))
+	for _, c := range calls {
+		if len(c.Args) > 0 {
+			out = append(out, c.Args[0])
+		}
+	}
+	return out
+}
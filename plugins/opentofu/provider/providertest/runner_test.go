@@ -0,0 +1,59 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package providertest
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pipe-cd/community-plugins/plugins/opentofu/provider"
+)
+
+func TestRunner(t *testing.T) {
+	t.Parallel()
+
+	r := NewRunner().
+		On("workspace", Response{Stdout: "default"}).
+		On("workspace select", Response{Stderr: "Workspace \"dev\" doesn't exist.", ExitCode: 1}, Response{Stdout: "Switched to workspace \"dev\"."})
+	tofu := provider.NewOpenTofu("tofu", t.TempDir(), provider.WithRunner(r))
+
+	// The responses are replayed in order, and the last one is repeated.
+	assert.Error(t, tofu.SelectWorkspace(context.Background(), "dev"))
+	assert.NoError(t, tofu.SelectWorkspace(context.Background(), "dev"))
+	assert.NoError(t, tofu.SelectWorkspace(context.Background(), "dev"))
+
+	// The commands without responses succeed with no output.
+	version, err := tofu.Version(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, version)
+
+	assert.Equal(t, []string{"workspace", "workspace", "workspace", "version"}, r.Subcommands())
+	assert.Equal(t, []string{"workspace", "select", "dev"}, r.Calls()[0].Args)
+}
+
+func TestRunner_ExitCode(t *testing.T) {
+	t.Parallel()
+
+	r := NewRunner().On("plan", Response{Stdout: "changes", ExitCode: 2})
+	var buf bytes.Buffer
+	cmd := &provider.Command{Args: []string{"plan"}, Stdout: &buf}
+	err := r.Run(context.Background(), cmd)
+	assert.Equal(t, 2, provider.GetExitCode(err))
+	assert.Equal(t, "changes", buf.String())
+}
@@ -0,0 +1,96 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"io"
+	"slices"
+	"strings"
+)
+
+const redactedValue = "***"
+
+// newRedactor returns a replacer which masks the given secrets.
+// It returns nil when there is nothing to be masked.
+func newRedactor(secrets []string) *strings.Replacer {
+	values := make([]string, 0, len(secrets)*2)
+	for _, s := range secrets {
+		if s == "" {
+			continue
+		}
+		values = append(values, s)
+		// The secret is escaped when it appears in the machine-readable UI output.
+		if b, err := json.Marshal(s); err == nil {
+			if escaped := string(b[1 : len(b)-1]); escaped != s {
+				values = append(values, escaped)
+			}
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	// Replace the longer values first not to leave a part of them when a secret contains another one.
+	slices.SortFunc(values, func(a, b string) int { return cmp.Compare(len(b), len(a)) })
+	oldnew := make([]string, 0, len(values)*2)
+	for _, v := range values {
+		oldnew = append(oldnew, v, redactedValue)
+	}
+	return strings.NewReplacer(oldnew...)
+}
+
+// redactWriter is an io.Writer which masks the secrets line by line,
+// so that a secret split across multiple writes is also masked.
+type redactWriter struct {
+	w        io.Writer
+	redactor *strings.Replacer
+	buf      []byte
+}
+
+func newRedactWriter(w io.Writer, redactor *strings.Replacer) *redactWriter {
+	return &redactWriter{w: w, redactor: redactor}
+}
+
+func (r *redactWriter) Write(p []byte) (int, error) {
+	if r.redactor == nil {
+		return r.w.Write(p)
+	}
+
+	r.buf = append(r.buf, p...)
+	i := bytes.LastIndexByte(r.buf, '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+	lines := r.buf[:i+1]
+	r.buf = r.buf[i+1:]
+	if _, err := io.WriteString(r.w, r.redactor.Replace(string(lines))); err != nil {
+		return len(p), err
+	}
+	return len(p), nil
+}
+
+// Flush writes the remaining data which doesn't end with a newline.
+func (r *redactWriter) Flush() error {
+	if len(r.buf) == 0 {
+		return nil
+	}
+	line := r.buf
+	r.buf = nil
+	_, err := io.WriteString(r.w, r.redactor.Replace(string(line)))
+	return err
+}
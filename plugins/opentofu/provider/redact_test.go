@@ -0,0 +1,85 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactWriter(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		name     string
+		secrets  []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "no secrets",
+			secrets:  nil,
+			input:    "password=s3cr3t\n",
+			expected: "password=s3cr3t\n",
+		},
+		{
+			name:     "mask secrets",
+			secrets:  []string{"s3cr3t", ""},
+			input:    "password=s3cr3t\nanother=s3cr3t and s3cr3t",
+			expected: "password=***\nanother=*** and ***",
+		},
+		{
+			name:     "mask the longer secret first",
+			secrets:  []string{"abc", "abcdef"},
+			input:    "abcdef abc\n",
+			expected: "*** ***\n",
+		},
+		{
+			name:     "mask escaped secret in json",
+			secrets:  []string{`pa"ss`},
+			input:    `{"@message":"pa\"ss"}` + "\n",
+			expected: `{"@message":"***"}` + "\n",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var out bytes.Buffer
+			w := newRedactWriter(&out, newRedactor(tc.secrets))
+			// Write the input byte by byte to make sure that the secrets split across writes are masked.
+			_, err := io.CopyBuffer(w, strings.NewReader(tc.input), make([]byte, 1))
+			require.NoError(t, err)
+			require.NoError(t, w.Flush())
+			assert.Equal(t, tc.expected, out.String())
+		})
+	}
+}
+
+func TestOpenTofu_makeEnv(t *testing.T) {
+	t.Parallel()
+
+	tofu := NewOpenTofu("tofu", ".",
+		WithAdditionalEnvs([]string{"SHARED=1"}, nil, []string{"PLAN=1"}, nil),
+	)
+
+	env := tofu.makeEnv(tofu.options.planEnvs...)
+	assert.Equal(t, []string{"SHARED=1", "PLAN=1"}, env[len(env)-2:])
+}
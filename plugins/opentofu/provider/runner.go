@@ -0,0 +1,81 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Runner executes the commands built by OpenTofu.
+// The default runner starts a process for each command, and tests can replace it to run the commands without the binary.
+type Runner interface {
+	// Run executes the command and waits for it to exit.
+	// The returned error must implement ExitCode() int when the command exited with a non-zero code.
+	Run(ctx context.Context, cmd *Command) error
+}
+
+// Command is a command to be executed by a Runner.
+type Command struct {
+	Path string
+	// The arguments without the command name, e.g. ["plan", "-lock=false"].
+	Args   []string
+	Dir    string
+	Env    []string
+	Stdout io.Writer
+	Stderr io.Writer
+	// How long to wait for the command to exit after it's interrupted by the cancellation of the context.
+	GracePeriod time.Duration
+
+	ctx    context.Context
+	runner Runner
+}
+
+// Run executes the command with the runner.
+func (c *Command) Run() error {
+	return c.runner.Run(c.ctx, c)
+}
+
+// CombinedOutput executes the command and returns its combined stdout and stderr.
+func (c *Command) CombinedOutput() ([]byte, error) {
+	var buf bytes.Buffer
+	c.Stdout = &buf
+	c.Stderr = &buf
+	err := c.Run()
+	return buf.Bytes(), err
+}
+
+// execRunner executes the commands as processes.
+type execRunner struct{}
+
+// Run starts a process which is interrupted by SIGINT instead of SIGKILL when the context is done,
+// so that OpenTofu can release the state lock and persist the state before exiting.
+// The process is killed when it doesn't exit within the grace period.
+func (execRunner) Run(ctx context.Context, c *Command) error {
+	cmd := exec.CommandContext(ctx, c.Path, c.Args...)
+	cmd.Dir = c.Dir
+	cmd.Env = c.Env
+	cmd.Stdout = c.Stdout
+	cmd.Stderr = c.Stderr
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = c.GracePeriod
+	return cmd.Run()
+}
@@ -0,0 +1,202 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// TestStatus represents the result of a test file or a run block.
+type TestStatus string
+
+const (
+	TestStatusPending TestStatus = "pending"
+	TestStatusSkip    TestStatus = "skip"
+	TestStatusPass    TestStatus = "pass"
+	TestStatusFail    TestStatus = "fail"
+	TestStatusError   TestStatus = "error"
+)
+
+// Failed returns true when the test failed or errored.
+func (s TestStatus) Failed() bool {
+	return s == TestStatusFail || s == TestStatusError
+}
+
+// TestRunResult represents the result of a run block in a test file.
+type TestRunResult struct {
+	Name   string
+	Status TestStatus
+	// The errors and warnings reported while executing the run block such as failed assertions.
+	Diagnostics []Diagnostic
+}
+
+// TestFileResult represents the result of a test file.
+type TestFileResult struct {
+	Path   string
+	Status TestStatus
+	Runs   []*TestRunResult
+}
+
+// TestResult represents the result of "tofu test" collected from the machine-readable UI output.
+type TestResult struct {
+	// The test files in the order they were executed.
+	Files []*TestFileResult
+	// The errors and warnings which are not related to a run block.
+	Diagnostics []Diagnostic
+}
+
+// Failed returns true when any test file or run block failed or errored.
+func (r TestResult) Failed() bool {
+	for _, f := range r.Files {
+		if f.Status.Failed() {
+			return true
+		}
+		for _, run := range f.Runs {
+			if run.Status.Failed() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Summary returns a table of the status for each run block.
+func (r TestResult) Summary() string {
+	if len(r.Files) == 0 {
+		return ""
+	}
+
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tRUN\tSTATUS")
+	for _, f := range r.Files {
+		if len(f.Runs) == 0 {
+			fmt.Fprintf(tw, "%s\t-\t%s\n", f.Path, f.Status)
+			continue
+		}
+		for _, run := range f.Runs {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", f.Path, run.Name, run.Status)
+		}
+	}
+	tw.Flush()
+	return buf.String()
+}
+
+// Failures returns the failed run blocks with the reasons, formatted for the logs.
+func (r TestResult) Failures() string {
+	var b strings.Builder
+	for _, f := range r.Files {
+		for _, run := range f.Runs {
+			if !run.Status.Failed() {
+				continue
+			}
+			fmt.Fprintf(&b, "%s, run %q: %s\n", f.Path, run.Name, run.Status)
+			for _, d := range run.Diagnostics {
+				fmt.Fprintf(&b, "  %s\n", strings.ReplaceAll(d.String(), "\n", "\n  "))
+			}
+		}
+	}
+	return b.String()
+}
+
+type uiTestFile struct {
+	Path   string     `json:"path"`
+	Status TestStatus `json:"status"`
+}
+
+type uiTestRun struct {
+	Path     string     `json:"path"`
+	Run      string     `json:"run"`
+	Progress string     `json:"progress,omitempty"`
+	Status   TestStatus `json:"status"`
+}
+
+// minTerraformTestVersion is the first version of terraform whose "test" command runs the "*.tftest.hcl" files with the "-json" and "-filter" flags.
+const minTerraformTestVersion = "1.6.0"
+
+var terraformVersionRegex = regexp.MustCompile(`(?m)^Terraform v(\d+)\.(\d+)\.(\d+)`)
+
+// CheckTestSupported returns an error when the engine is a version of terraform which doesn't support the test framework.
+func (t *OpenTofu) CheckTestSupported(ctx context.Context) error {
+	if t.options.engine != EngineTerraform {
+		return nil
+	}
+	out, err := t.Version(ctx)
+	if err != nil {
+		return err
+	}
+	m := terraformVersionRegex.FindStringSubmatch(out)
+	if m == nil {
+		return fmt.Errorf("failed to find the version of terraform in %q", out)
+	}
+	if !versionAtLeast(m[1:], strings.Split(minTerraformTestVersion, ".")) {
+		return fmt.Errorf("the test framework requires terraform v%s or later, but v%s is used", minTerraformTestVersion, strings.Join(m[1:], "."))
+	}
+	return nil
+}
+
+// versionAtLeast returns true when the version given as its numeric parts is equal to or later than the minimum.
+func versionAtLeast(version, minimum []string) bool {
+	for i := range minimum {
+		v, _ := strconv.Atoi(version[i])
+		m, _ := strconv.Atoi(minimum[i])
+		if v != m {
+			return v > m
+		}
+	}
+	return true
+}
+
+// Test executes "tofu test".
+// The filters limit the test files to be executed.
+// The returned TestResult is filled only when the machine-readable UI output is enabled.
+func (t *OpenTofu) Test(ctx context.Context, w io.Writer, filters []string) (TestResult, error) {
+	args := []string{"test"}
+	if t.options.jsonUI {
+		args = append(args, "-json")
+	}
+	for _, f := range filters {
+		args = append(args, "-filter="+f)
+	}
+	args = append(args, t.makeCommonCommandArgs()...)
+
+	var streamer *uiStreamer
+	stdout := w
+	if t.options.jsonUI {
+		streamer = newUIStreamer(w)
+		stdout = streamer
+	}
+
+	out := newRedactWriter(stdout, t.redactor)
+	cmd := t.newCommand(ctx, args, t.makeEnv())
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	io.WriteString(w, fmt.Sprintf("%s %s", t.options.engine.Command(), strings.Join(args, " ")))
+	err := cmd.Run()
+	out.Flush()
+	if streamer == nil {
+		return TestResult{}, err
+	}
+	streamer.Flush()
+	return streamer.testResult(), err
+}
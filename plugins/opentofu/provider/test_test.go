@@ -0,0 +1,138 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testJSONOutput = `{"@level":"info","@message":"OpenTofu 1.9.1","type":"version","tofu":"1.9.1","ui":"1.2"}
+{"@level":"info","@message":"Found 2 files and 3 run blocks","type":"test_abstract","test_abstract":{"main.tftest.hcl":["setup","check_name"],"vpc.tftest.hcl":["cidr"]}}
+{"@level":"info","@message":"main.tftest.hcl... in progress","@testfile":"main.tftest.hcl","type":"test_file","test_file":{"path":"main.tftest.hcl","status":"pending"}}
+{"@level":"info","@message":"  \"setup\"... pass","@testfile":"main.tftest.hcl","@testrun":"setup","type":"test_run","test_run":{"path":"main.tftest.hcl","run":"setup","status":"pass"}}
+{"@level":"info","@message":"  \"check_name\"... in progress","@testfile":"main.tftest.hcl","@testrun":"check_name","type":"test_run","test_run":{"path":"main.tftest.hcl","run":"check_name","progress":"running","elapsed":10}}
+{"@level":"error","@message":"Error: Test assertion failed","@testfile":"main.tftest.hcl","@testrun":"check_name","type":"diagnostic","diagnostic":{"severity":"error","summary":"Test assertion failed","detail":"bucket name did not match","range":{"filename":"main.tftest.hcl","start":{"line":9,"column":5}}}}
+{"@level":"info","@message":"  \"check_name\"... fail","@testfile":"main.tftest.hcl","@testrun":"check_name","type":"test_run","test_run":{"path":"main.tftest.hcl","run":"check_name","progress":"complete","status":"fail"}}
+{"@level":"info","@message":"main.tftest.hcl... fail","@testfile":"main.tftest.hcl","type":"test_file","test_file":{"path":"main.tftest.hcl","status":"fail"}}
+{"@level":"info","@message":"  \"cidr\"... pass","@testfile":"vpc.tftest.hcl","@testrun":"cidr","type":"test_run","test_run":{"path":"vpc.tftest.hcl","run":"cidr","status":"pass"}}
+{"@level":"info","@message":"vpc.tftest.hcl... pass","@testfile":"vpc.tftest.hcl","type":"test_file","test_file":{"path":"vpc.tftest.hcl","status":"pass"}}
+{"@level":"info","@message":"Failure! 2 passed, 1 failed.","type":"test_summary","test_summary":{"status":"fail","passed":2,"failed":1,"errored":0,"skipped":0}}
+`
+
+func TestUIStreamer_Test(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	s := newUIStreamer(&out)
+	_, err := io.WriteString(s, testJSONOutput)
+	require.NoError(t, err)
+	require.NoError(t, s.Flush())
+
+	result := s.testResult()
+	require.Len(t, result.Files, 2)
+	assert.Equal(t, "main.tftest.hcl", result.Files[0].Path)
+	assert.Equal(t, TestStatusFail, result.Files[0].Status)
+	require.Len(t, result.Files[0].Runs, 2)
+	assert.Equal(t, TestStatusPass, result.Files[0].Runs[0].Status)
+	assert.Equal(t, TestStatusFail, result.Files[0].Runs[1].Status)
+	require.Len(t, result.Files[0].Runs[1].Diagnostics, 1)
+	assert.Empty(t, result.Diagnostics)
+	assert.True(t, result.Failed())
+
+	expectedSummary := `FILE             RUN         STATUS
+main.tftest.hcl  setup       pass
+main.tftest.hcl  check_name  fail
+vpc.tftest.hcl   cidr        pass
+`
+	assert.Equal(t, expectedSummary, result.Summary())
+
+	expectedFailures := `main.tftest.hcl, run "check_name": fail
+  Error: Test assertion failed (main.tftest.hcl:9)
+    bucket name did not match
+`
+	assert.Equal(t, expectedFailures, result.Failures())
+}
+
+func TestTestResult_Failed(t *testing.T) {
+	t.Parallel()
+
+	result := TestResult{Files: []*TestFileResult{
+		{Path: "a.tftest.hcl", Status: TestStatusPass, Runs: []*TestRunResult{{Name: "a", Status: TestStatusPass}}},
+		{Path: "b.tftest.hcl", Status: TestStatusSkip},
+	}}
+	assert.False(t, result.Failed())
+
+	result.Files[0].Runs = append(result.Files[0].Runs, &TestRunResult{Name: "b", Status: TestStatusError})
+	assert.True(t, result.Failed())
+}
+
+func TestOpenTofu_CheckTestSupported(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		name    string
+		engine  Engine
+		version string
+		wantErr bool
+	}{
+		{
+			name:    "opentofu",
+			engine:  EngineOpenTofu,
+			version: "OpenTofu v1.6.0",
+		},
+		{
+			name:    "terraform supporting the test framework",
+			engine:  EngineTerraform,
+			version: "Terraform v1.6.0\non linux_amd64",
+		},
+		{
+			name:    "later terraform",
+			engine:  EngineTerraform,
+			version: "Terraform v1.10.2\non linux_amd64",
+		},
+		{
+			name:    "old terraform",
+			engine:  EngineTerraform,
+			version: "Terraform v1.5.7\non linux_amd64",
+			wantErr: true,
+		},
+		{
+			name:    "unknown version",
+			engine:  EngineTerraform,
+			version: "unknown",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			script := "#!/bin/sh\ncat <<'EOF2'\n" + tc.version + "\nEOF2\n"
+			tofu := NewOpenTofu(writeScript(t, script), t.TempDir(), WithEngine(tc.engine))
+			err := tofu.CheckTestSupported(context.Background())
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ValidateResult represents the output of "tofu validate -json".
+type ValidateResult struct {
+	Valid        bool         `json:"valid"`
+	ErrorCount   int          `json:"error_count"`
+	WarningCount int          `json:"warning_count"`
+	Diagnostics  []Diagnostic `json:"diagnostics"`
+}
+
+// Validate executes "tofu validate" to check the configuration without accessing any remote services.
+// A configuration with errors is reported by ValidateResult instead of an error.
+func (t *OpenTofu) Validate(ctx context.Context, w io.Writer) (ValidateResult, error) {
+	args := []string{"validate", "-json"}
+
+	var stdout bytes.Buffer
+	stderr := newRedactWriter(w, t.redactor)
+	cmd := t.newCommand(ctx, args, t.makeEnv())
+	cmd.Stdout = &stdout
+	cmd.Stderr = stderr
+
+	io.WriteString(w, fmt.Sprintf("%s %s", t.options.engine.Command(), strings.Join(args, " ")))
+	runErr := cmd.Run()
+	stderr.Flush()
+
+	var result ValidateResult
+	if err := json.Unmarshal([]byte(t.redact(stdout.String())), &result); err != nil {
+		if runErr != nil {
+			return result, runErr
+		}
+		return result, fmt.Errorf("unable to parse the validate output: %w", err)
+	}
+	return result, nil
+}
+
+// FormatCheck executes "tofu fmt -check -recursive" and returns the files which are not formatted in the canonical format.
+func (t *OpenTofu) FormatCheck(ctx context.Context, w io.Writer) ([]string, error) {
+	args := []string{"fmt", "-check", "-recursive"}
+
+	var stdout, stderr bytes.Buffer
+	cmd := t.newCommand(ctx, args, t.makeEnv())
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	io.WriteString(w, fmt.Sprintf("%s %s", t.options.engine.Command(), strings.Join(args, " ")))
+	err := cmd.Run()
+
+	var files []string
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, line)
+		}
+	}
+	// The command exits with non-zero code when there are files to be formatted.
+	if err != nil && len(files) == 0 {
+		return nil, fmt.Errorf("%w: %s", err, t.redact(stderr.String()))
+	}
+	return files, nil
+}
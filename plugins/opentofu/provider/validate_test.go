@@ -0,0 +1,85 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenTofu_Validate(t *testing.T) {
+	t.Parallel()
+
+	script := `#!/bin/sh
+cat <<'EOF2'
+{"format_version":"1.0","valid":false,"error_count":1,"warning_count":0,"diagnostics":[{"severity":"error","summary":"Unsupported argument","detail":"An argument named \"amii\" is not expected here.","range":{"filename":"main.tf","start":{"line":3,"column":3,"byte":40},"end":{"line":3,"column":7,"byte":44}},"snippet":{"context":"resource \"aws_instance\" \"web\"","code":"  amii = \"ami-123\"","start_line":3,"highlight_start_offset":2,"highlight_end_offset":6,"values":[]}}]}
+EOF2
+exit 1
+`
+	tofu := NewOpenTofu(writeScript(t, script), t.TempDir())
+	result, err := tofu.Validate(context.Background(), io.Discard)
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, 1, result.ErrorCount)
+	require.Len(t, result.Diagnostics, 1)
+
+	expected := `Error: Unsupported argument
+  on main.tf:3:3, in resource "aws_instance" "web"
+     3:   amii = "ami-123"
+          ^^^^
+
+  An argument named "amii" is not expected here.`
+	assert.Equal(t, expected, result.Diagnostics[0].StringWithSnippet())
+}
+
+func TestOpenTofu_FormatCheck(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		name          string
+		script        string
+		expectedFiles []string
+		expectedErr   bool
+	}{
+		{
+			name:   "formatted",
+			script: "#!/bin/sh\nexit 0\n",
+		},
+		{
+			name:          "not formatted",
+			script:        "#!/bin/sh\necho main.tf\necho modules/vpc/variables.tf\nexit 3\n",
+			expectedFiles: []string{"main.tf", "modules/vpc/variables.tf"},
+		},
+		{
+			name:        "failed",
+			script:      "#!/bin/sh\necho 'Error: Invalid character' >&2\nexit 2\n",
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			tofu := NewOpenTofu(writeScript(t, tc.script), t.TempDir())
+			files, err := tofu.FormatCheck(context.Background(), io.Discard)
+			assert.Equal(t, tc.expectedErr, err != nil)
+			assert.Equal(t, tc.expectedFiles, files)
+		})
+	}
+}
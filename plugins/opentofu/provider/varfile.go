@@ -0,0 +1,127 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// varFileName is the name of the variable file generated for the vars.
+// It is passed with the "-var-file" flag, so it isn't loaded automatically even when placed in the module directory.
+const varFileName = "pipecd.tfvars.json"
+
+var (
+	variableBlockSchema = &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{{Type: "variable", LabelNames: []string{"name"}}},
+	}
+	variableTypeSchema = &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "type"}},
+	}
+)
+
+// WriteVarFile writes the vars formatted by "key=value" and the typed variables to a JSON variable file in dir, and returns the path to it.
+// In the same way as the "-var" flags, the value of a var is parsed as an expression when the variable is declared with a complex type in moduleDir,
+// otherwise it is passed as a string. The vars take precedence over the typed variables.
+func WriteVarFile(dir, moduleDir string, vars []string, variables map[string]any) (string, error) {
+	complexVars, err := loadComplexVariables(moduleDir)
+	if err != nil {
+		return "", err
+	}
+
+	values := make(map[string]any, len(vars)+len(variables))
+	maps.Copy(values, variables)
+	for _, v := range vars {
+		key, value, _ := strings.Cut(v, "=")
+		if !complexVars[key] {
+			values[key] = value
+			continue
+		}
+		raw, err := parseVarValue(key, value)
+		if err != nil {
+			return "", err
+		}
+		values[key] = raw
+	}
+
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, varFileName)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// loadComplexVariables returns the names of the variables declared with a type other than string, number and bool in the module directory.
+func loadComplexVariables(moduleDir string) (map[string]bool, error) {
+	paths, err := filepath.Glob(filepath.Join(moduleDir, "*"+tfFileExtension))
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]bool)
+	parser := hclparse.NewParser()
+	for _, path := range paths {
+		f, diags := parser.ParseHCLFile(path)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		content, _, diags := f.Body.PartialContent(variableBlockSchema)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		for _, b := range content.Blocks {
+			attrs, _, diags := b.Body.PartialContent(variableTypeSchema)
+			if diags.HasErrors() {
+				return nil, diags
+			}
+			attr, ok := attrs.Attributes["type"]
+			if !ok {
+				continue
+			}
+			switch hcl.ExprAsKeyword(attr.Expr) {
+			case "string", "number", "bool":
+			default:
+				out[b.Labels[0]] = true
+			}
+		}
+	}
+	return out, nil
+}
+
+// parseVarValue parses the value of a variable declared with a complex type as an expression, and returns it in JSON.
+func parseVarValue(key, value string) (json.RawMessage, error) {
+	expr, diags := hclsyntax.ParseExpression([]byte(value), key, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("invalid value for variable %q: %w", key, diags)
+	}
+	v, diags := expr.Value(nil)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("invalid value for variable %q: %w", key, diags)
+	}
+	return ctyjson.Marshal(v, v.Type())
+}
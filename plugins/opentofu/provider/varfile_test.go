@@ -0,0 +1,113 @@
+// Copyright 2025 The PipeCD Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteVarFile(t *testing.T) {
+	t.Parallel()
+
+	moduleDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(moduleDir, "variables.tf"), []byte(`
+variable "image_id" {
+  type = string
+}
+
+variable "image_id_list" {
+  type = list(string)
+}
+
+variable "tags" {
+  type = map(string)
+}
+
+variable "untyped" {}
+`), 0644))
+
+	testcases := []struct {
+		name      string
+		vars      []string
+		variables map[string]any
+		expected  string
+		wantErr   bool
+	}{
+		{
+			name:     "primitive and untyped variables are passed as strings",
+			vars:     []string{"image_id=ami-abc123", `untyped=["a"]`, "unknown=1"},
+			expected: `{"image_id": "ami-abc123", "untyped": "[\"a\"]", "unknown": "1"}`,
+		},
+		{
+			name:     "complex variables are parsed as expressions",
+			vars:     []string{`image_id_list=["ami-abc123","ami-def456"]`, `tags={env = "prod"}`},
+			expected: `{"image_id_list": ["ami-abc123", "ami-def456"], "tags": {"env": "prod"}}`,
+		},
+		{
+			name:      "typed variables",
+			vars:      []string{"image_id=ami-abc123"},
+			variables: map[string]any{"image_id_list": []any{"ami-abc123"}, "image_id": "ami-def456"},
+			expected:  `{"image_id": "ami-abc123", "image_id_list": ["ami-abc123"]}`,
+		},
+		{
+			name:     "the last one wins",
+			vars:     []string{"image_id=ami-abc123", "image_id=ami-def456"},
+			expected: `{"image_id": "ami-def456"}`,
+		},
+		{
+			name:    "invalid expression",
+			vars:    []string{`image_id_list=["ami-abc123"`},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			path, err := WriteVarFile(t.TempDir(), moduleDir, tc.vars, tc.variables)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.expected, string(data))
+		})
+	}
+}
+
+func TestOpenTofu_makeCommonCommandArgs(t *testing.T) {
+	t.Parallel()
+
+	tofu := NewOpenTofu("tofu", ".",
+		WithVarFiles([]string{"a.tfvars", "b.tfvars"}),
+		WithVarFile("/tmp/pipecd.tfvars.json"),
+		WithAdditionalFlags([]string{"-lock=false"}, nil, nil, nil),
+	)
+
+	// The generated var file is passed last to take precedence over the other var files.
+	assert.Equal(t, []string{
+		"-var-file=a.tfvars",
+		"-var-file=b.tfvars",
+		"-var-file=/tmp/pipecd.tfvars.json",
+		"-lock=false",
+	}, tofu.makeCommonCommandArgs())
+}
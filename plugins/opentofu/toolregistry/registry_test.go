@@ -42,3 +42,22 @@ func TestRegistry_OpenTofu(t *testing.T) {
 
 	assert.Contains(t, string(out), expected)
 }
+
+func TestRegistry_Terraform(t *testing.T) {
+	t.Parallel()
+
+	c := toolregistrytest.NewTestToolRegistry(t)
+
+	r := NewRegistry(c)
+
+	p, err := r.Terraform(context.Background(), "1.9.8")
+	require.NoError(t, err)
+	require.NotEmpty(t, p)
+
+	out, err := exec.CommandContext(context.Background(), p, "version").CombinedOutput()
+	require.NoError(t, err)
+
+	expected := "Terraform v1.9.8"
+
+	assert.Contains(t, string(out), expected)
+}
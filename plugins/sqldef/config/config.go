@@ -1,5 +1,7 @@
 package config
 
+import "strings"
+
 type DBType string
 
 const (
@@ -19,7 +21,30 @@ type DeployTargetConfig struct {
 	Host     string `json:"host"`
 	Port     string `json:"port"`
 	DBName   string `json:"db_name"`
+	// The sslmode used to connect to PostgreSQL, e.g. disable, require, verify-full.
+	SSLMode string `json:"ssl_mode"`
+	// The comma separated list of PostgreSQL schemas set as the search_path.
+	// When it is set, only the tables in these schemas are managed.
+	SearchPath string `json:"search_path"`
+}
+
+// Schemas returns the schemas listed in the search_path.
+func (c DeployTargetConfig) Schemas() []string {
+	var schemas []string
+	for _, s := range strings.Split(c.SearchPath, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			schemas = append(schemas, s)
+		}
+	}
+	return schemas
 }
 
 type ApplicationConfigSpec struct {
 }
+
+// SqldefRollbackStageOptions contains all configurable values for a SQLDEF_ROLLBACK stage.
+type SqldefRollbackStageOptions struct {
+	// Whether to allow the rollback to drop columns or tables.
+	// The data stored in them is lost, so such rollbacks are refused by default.
+	AllowDropColumns bool `json:"allow_drop_columns"`
+}
@@ -2,6 +2,7 @@ package deployment
 
 import (
 	"context"
+	"errors"
 	"github.com/pipe-cd/community-plugins/plugins/sqldef/provider"
 	"slices"
 
@@ -83,8 +84,16 @@ func (p *Plugin) ExecuteStage(
 		return &sdk.ExecuteStageResponse{
 			Status: p.executePlanStage(ctx, dts, input),
 		}, nil
+	case sqldefStageApply:
+		return &sdk.ExecuteStageResponse{
+			Status: p.executeApplyStage(ctx, dts, input),
+		}, nil
+	case sqldefStageRollback:
+		return &sdk.ExecuteStageResponse{
+			Status: p.executeRollbackStage(ctx, dts, input),
+		}, nil
 	default:
-		panic("unimplemented stage")
+		return nil, errors.New("unsupported stage")
 	}
 }
 
@@ -0,0 +1,64 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	sdk "github.com/pipe-cd/piped-plugin-sdk-go"
+
+	"github.com/pipe-cd/community-plugins/plugins/sqldef/config"
+	toolRegistryPkg "github.com/pipe-cd/community-plugins/plugins/sqldef/toolregistry"
+)
+
+func (p *Plugin) executeApplyStage(ctx context.Context, dts []*sdk.DeployTarget[config.DeployTargetConfig], input *sdk.ExecuteStageInput[config.ApplicationConfigSpec]) sdk.StageStatus {
+	lp := input.Client.LogPersister()
+	lp.Info("Start applying the schema deployment")
+
+	appDir := input.Request.TargetDeploymentSource.ApplicationDirectory
+	schemaPath, err := findFirstSQLFile(appDir)
+	if err != nil {
+		lp.Errorf("Failed while finding schema file (%v)", err)
+		return sdk.StageStatusFailure
+	}
+
+	// Currently, we create them every time the stage is executed beucause we can't pass input.Client.toolRegistry to the plugin when starting the plugin.
+	toolRegistry := toolRegistryPkg.NewRegistry(input.Client.ToolRegistry())
+	installed := make(map[config.DBType]string)
+
+	var failed []string
+	for _, dt := range dts {
+		logDeployTarget(lp, dt, schemaPath)
+
+		if err := p.applySchema(ctx, lp, toolRegistry, installed, dt, schemaPath); err != nil {
+			lp.Errorf("Failed to apply the schema to deploy target [%s] (%v)", dt.Name, err)
+			failed = append(failed, dt.Name)
+			continue
+		}
+		lp.Successf("Successfully applied the schema to deploy target [%s]", dt.Name)
+	}
+
+	if len(failed) > 0 {
+		lp.Errorf("Failed to apply the schema to %d of %d deploy target(s): %s", len(failed), len(dts), strings.Join(failed, ", "))
+		return sdk.StageStatusFailure
+	}
+	return sdk.StageStatusSuccess
+}
+
+// applySchema shows the statements to be executed with a dry-run, then applies the schema to the given deploy target.
+func (p *Plugin) applySchema(ctx context.Context, lp sdk.StageLogPersister, toolRegistry *toolRegistryPkg.Registry, installed map[config.DBType]string, dt *sdk.DeployTarget[config.DeployTargetConfig], schemaPath string) error {
+	sqlDefPath, err := installSqldef(ctx, toolRegistry, installed, dt.Config.DbType)
+	if err != nil {
+		return err
+	}
+
+	p.Sqldef.Init(lp, dt.Config, schemaPath, sqlDefPath)
+
+	if err := p.Sqldef.Execute(ctx, true); err != nil {
+		return fmt.Errorf("failed while dry-running the deployment: %w", err)
+	}
+	if err := p.Sqldef.Execute(ctx, false); err != nil {
+		return fmt.Errorf("failed while applying the deployment: %w", err)
+	}
+	return nil
+}
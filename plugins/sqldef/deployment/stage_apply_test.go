@@ -0,0 +1,202 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	sdk "github.com/pipe-cd/piped-plugin-sdk-go"
+	"github.com/pipe-cd/piped-plugin-sdk-go/logpersister/logpersistertest"
+	"github.com/pipe-cd/piped-plugin-sdk-go/toolregistry/toolregistrytest"
+
+	"github.com/pipe-cd/community-plugins/plugins/sqldef/config"
+)
+
+func newApplyStageInput(t *testing.T, targetAppDir string) *sdk.ExecuteStageInput[config.ApplicationConfigSpec] {
+	return &sdk.ExecuteStageInput[config.ApplicationConfigSpec]{
+		Request: sdk.ExecuteStageRequest[config.ApplicationConfigSpec]{
+			StageName:   sqldefStageApply,
+			StageConfig: []byte(``),
+			RunningDeploymentSource: sdk.DeploymentSource[config.ApplicationConfigSpec]{
+				ApplicationDirectory: filepath.Join("testdata", "not-used"),
+				CommitHash:           "0123456789",
+			},
+			TargetDeploymentSource: sdk.DeploymentSource[config.ApplicationConfigSpec]{
+				ApplicationDirectory: targetAppDir,
+				CommitHash:           "9876543210",
+			},
+			Deployment: sdk.Deployment{
+				PipedID:       "piped-id",
+				ApplicationID: "app-id",
+			},
+		},
+		Client: sdk.NewClient(nil, "sqldef", "", "", logpersistertest.NewTestLogPersister(t), toolregistrytest.NewTestToolRegistry(t)),
+	}
+}
+
+func newMySQLDeployTarget(name, port string) *sdk.DeployTarget[config.DeployTargetConfig] {
+	return &sdk.DeployTarget[config.DeployTargetConfig]{
+		Name: name,
+		Config: config.DeployTargetConfig{
+			DbType:   config.DBTypeMySQL,
+			Username: "testuser",
+			Password: "testpass",
+			Host:     "localhost",
+			Port:     port,
+			DBName:   "testdb",
+		},
+	}
+}
+
+func TestPlugin_executeApplyStage_HappyPath(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	mockSqldef := &MockSqldefProvider{}
+	mockSqldef.On("Init",
+		mock.AnythingOfType("logpersistertest.TestLogPersister"),
+		config.DeployTargetConfig{DbType: config.DBTypeMySQL, Username: "testuser", Password: "testpass", Host: "localhost", Port: "3306", DBName: "testdb"},
+		filepath.Join("testdata", "schema.sql"),
+		mock.MatchedBy(func(execPath string) bool { return execPath != "" }),
+	).Return()
+
+	// The dry-run must be executed before applying the changes.
+	dryRun := mockSqldef.On("Execute", ctx, true).Return(nil).Once()
+	mockSqldef.On("Execute", ctx, false).Return(nil).Once().NotBefore(dryRun)
+
+	plugin := createPluginWithMockSqldef(mockSqldef)
+	status := plugin.executeApplyStage(ctx, []*sdk.DeployTarget[config.DeployTargetConfig]{
+		newMySQLDeployTarget("test-mysql", "3306"),
+	}, newApplyStageInput(t, "testdata"))
+
+	assert.Equal(t, sdk.StageStatusSuccess, status)
+	mockSqldef.AssertExpectations(t)
+}
+
+func TestPlugin_executeApplyStage_Postgres(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	dt := &sdk.DeployTarget[config.DeployTargetConfig]{
+		Name: "test-postgres",
+		Config: config.DeployTargetConfig{
+			DbType:     config.DBTypePostgres,
+			Username:   "testuser",
+			Password:   "testpass",
+			Host:       "localhost",
+			Port:       "5432",
+			DBName:     "testdb",
+			SSLMode:    "disable",
+			SearchPath: "app",
+		},
+	}
+
+	mockSqldef := &MockSqldefProvider{}
+	mockSqldef.On("Init",
+		mock.Anything,
+		dt.Config,
+		filepath.Join("testdata", "schema.sql"),
+		mock.MatchedBy(func(execPath string) bool { return strings.Contains(execPath, "psqldef") }),
+	).Return()
+	dryRun := mockSqldef.On("Execute", ctx, true).Return(nil).Once()
+	mockSqldef.On("Execute", ctx, false).Return(nil).Once().NotBefore(dryRun)
+
+	plugin := createPluginWithMockSqldef(mockSqldef)
+	status := plugin.executeApplyStage(ctx, []*sdk.DeployTarget[config.DeployTargetConfig]{dt}, newApplyStageInput(t, "testdata"))
+
+	assert.Equal(t, sdk.StageStatusSuccess, status)
+	mockSqldef.AssertExpectations(t)
+}
+
+func TestPlugin_executeApplyStage_DryRunError(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	mockSqldef := &MockSqldefProvider{}
+	mockSqldef.On("Init", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	mockSqldef.On("Execute", ctx, true).Return(errors.New("syntax error")).Once()
+
+	plugin := createPluginWithMockSqldef(mockSqldef)
+	status := plugin.executeApplyStage(ctx, []*sdk.DeployTarget[config.DeployTargetConfig]{
+		newMySQLDeployTarget("test-mysql", "3306"),
+	}, newApplyStageInput(t, "testdata"))
+
+	assert.Equal(t, sdk.StageStatusFailure, status)
+	mockSqldef.AssertExpectations(t)
+	// The changes must not be applied when the dry-run failed.
+	mockSqldef.AssertNotCalled(t, "Execute", ctx, false)
+}
+
+func TestPlugin_executeApplyStage_MultipleTargets(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	mockSqldef := &MockSqldefProvider{}
+	mockSqldef.On("Init",
+		mock.Anything, config.DeployTargetConfig{DbType: config.DBTypeMySQL, Username: "testuser", Password: "testpass", Host: "localhost", Port: "3306", DBName: "testdb"},
+		filepath.Join("testdata", "schema.sql"), mock.Anything,
+	).Return().Once()
+	mockSqldef.On("Execute", ctx, true).Return(nil).Once()
+	mockSqldef.On("Execute", ctx, false).Return(errors.New("connection refused")).Once()
+
+	// The second target is applied even though the first one failed.
+	mockSqldef.On("Init",
+		mock.Anything, config.DeployTargetConfig{DbType: config.DBTypeMySQL, Username: "testuser", Password: "testpass", Host: "localhost", Port: "3307", DBName: "testdb"},
+		filepath.Join("testdata", "schema.sql"), mock.Anything,
+	).Return().Once()
+	mockSqldef.On("Execute", ctx, true).Return(nil).Once()
+	mockSqldef.On("Execute", ctx, false).Return(nil).Once()
+
+	plugin := createPluginWithMockSqldef(mockSqldef)
+	status := plugin.executeApplyStage(ctx, []*sdk.DeployTarget[config.DeployTargetConfig]{
+		newMySQLDeployTarget("test-mysql-1", "3306"),
+		newMySQLDeployTarget("test-mysql-2", "3307"),
+	}, newApplyStageInput(t, "testdata"))
+
+	assert.Equal(t, sdk.StageStatusFailure, status)
+	mockSqldef.AssertExpectations(t)
+}
+
+func TestPlugin_executeApplyStage_UnsupportedDBType(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	// The provider is never called for an unsupported database type.
+	mockSqldef := &MockSqldefProvider{}
+
+	dt := newMySQLDeployTarget("test-mssql", "1433")
+	dt.Config.DbType = config.DBTypeMSSQL
+
+	plugin := createPluginWithMockSqldef(mockSqldef)
+	status := plugin.executeApplyStage(ctx, []*sdk.DeployTarget[config.DeployTargetConfig]{dt}, newApplyStageInput(t, "testdata"))
+
+	assert.Equal(t, sdk.StageStatusFailure, status)
+	mockSqldef.AssertExpectations(t)
+}
+
+func TestPlugin_executeApplyStage_SchemaFileNotFound(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	// The provider is never called when the target deployment source has no schema file.
+	mockSqldef := &MockSqldefProvider{}
+
+	plugin := createPluginWithMockSqldef(mockSqldef)
+	status := plugin.executeApplyStage(ctx, []*sdk.DeployTarget[config.DeployTargetConfig]{
+		newMySQLDeployTarget("test-mysql", "3306"),
+	}, newApplyStageInput(t, t.TempDir()))
+
+	assert.Equal(t, sdk.StageStatusFailure, status)
+	mockSqldef.AssertExpectations(t)
+}
@@ -2,7 +2,7 @@ package deployment
 
 import (
 	"context"
-	"fmt"
+
 	"github.com/pipe-cd/community-plugins/plugins/sqldef/config"
 	toolRegistryPkg "github.com/pipe-cd/community-plugins/plugins/sqldef/toolregistry"
 
@@ -19,44 +19,24 @@ func (p *Plugin) executePlanStage(ctx context.Context, dts []*sdk.DeployTarget[c
 	// map for prevent repeatedly download sqldef
 	downloadedSqldefPaths := make(map[config.DBType]string)
 
+	appDir := input.Request.RunningDeploymentSource.ApplicationDirectory
+	schemaPath, err := findFirstSQLFile(appDir)
+	if err != nil {
+		lp.Errorf("Failed while finding schema file (%v)", err)
+		return sdk.StageStatusFailure
+	}
+
 	for _, dt := range dts {
-		lp.Infof("Deploy Target [%s]: host=%s, port=%s, db=%s, schemaFile=%s",
-			dt.Name,
-			dt.Config.Host,
-			dt.Config.Port,
-			dt.Config.DBName,
-		)
+		logDeployTarget(lp, dt, schemaPath)
 
 		// check db_type from dt.config to choose which sqldef binary to download
-		// Now we only support mysql temporarily
-		var sqlDefPath string
-		var existed bool
-		if sqlDefPath, existed = downloadedSqldefPaths[config.DBTypeMySQL]; !existed {
-			var binPath string
-			var err error
-			switch dt.Config.DbType {
-			case config.DBTypeMySQL:
-				binPath, err = toolRegistry.Mysqldef(ctx, "")
-			default:
-				lp.Errorf(fmt.Sprintf("Unsupported database type: %s, currently only support: mysql", dt.Name))
-				return sdk.StageStatusFailure
-			}
-			if err != nil {
-				lp.Errorf("Failed while getting Sqldef tool (%v)", err)
-				return sdk.StageStatusFailure
-			}
-			downloadedSqldefPaths[dt.Config.DbType] = binPath
-			lp.Info(fmt.Sprintf("Sqldef binary downloadeded: %s", sqlDefPath))
-		}
-
-		appDir := input.Request.RunningDeploymentSource.ApplicationDirectory
-		schemaPath, err := findFirstSQLFile(appDir)
+		sqlDefPath, err := installSqldef(ctx, toolRegistry, downloadedSqldefPaths, dt.Config.DbType)
 		if err != nil {
-			lp.Errorf("Failed while finding schema file (%v)", err)
+			lp.Errorf("Failed while getting Sqldef tool (%v)", err)
 			return sdk.StageStatusFailure
 		}
 
-		p.Sqldef.Init(lp, dt.Config.Username, dt.Config.Password, dt.Config.Host, dt.Config.Port, dt.Config.DBName, schemaPath, sqlDefPath)
+		p.Sqldef.Init(lp, dt.Config, schemaPath, sqlDefPath)
 
 		if err := p.Sqldef.Execute(ctx, true); err != nil {
 			lp.Errorf("Failed while plan the deployment (%v)", err)
@@ -22,8 +22,8 @@ type MockSqldefProvider struct {
 	mock.Mock
 }
 
-func (m *MockSqldefProvider) Init(logger sdk.StageLogPersister, username, password, host, port, dbName, schemaFilePath, execPath string) {
-	m.Called(logger, username, password, host, port, dbName, schemaFilePath, execPath)
+func (m *MockSqldefProvider) Init(logger sdk.StageLogPersister, cfg config.DeployTargetConfig, schemaFilePath, execPath string) {
+	m.Called(logger, cfg, schemaFilePath, execPath)
 }
 
 func (m *MockSqldefProvider) ShowCurrentSchema(ctx context.Context) (string, error) {
@@ -31,6 +31,11 @@ func (m *MockSqldefProvider) ShowCurrentSchema(ctx context.Context) (string, err
 	return args.String(0), args.Error(1)
 }
 
+func (m *MockSqldefProvider) DryRun(ctx context.Context) (string, error) {
+	args := m.Called(ctx)
+	return args.String(0), args.Error(1)
+}
+
 func (m *MockSqldefProvider) Execute(ctx context.Context, dryRun bool) error {
 	args := m.Called(ctx, dryRun)
 	return args.Error(0)
@@ -57,7 +62,7 @@ func TestPlugin_executePlanStage_HappyPath(t *testing.T) {
 	// Setup expectations for the mock
 	mockSqldef.On("Init",
 		mock.AnythingOfType("logpersistertest.TestLogPersister"),
-		"testuser", "testpass", "localhost", "3306", "testdb",
+		config.DeployTargetConfig{DbType: config.DBTypeMySQL, Username: "testuser", Password: "testpass", Host: "localhost", Port: "3306", DBName: "testdb"},
 		filepath.Join("testdata", "schema.sql"),
 		mock.AnythingOfType("string"), // execPath from tool registry
 	).Return()
@@ -165,13 +170,9 @@ func TestPlugin_executePlanStage_EmptySchemaFileName(t *testing.T) {
 
 	mockSqldef.On("Init",
 		mock.Anything, // log persister
-		"testuser",
-		"testpass",
-		"localhost",
-		"3306",
-		"testdb",
+		config.DeployTargetConfig{DbType: config.DBTypeMySQL, Username: "testuser", Password: "testpass", Host: "localhost", Port: "3306", DBName: "testdb"},
 		"testdata/schema.sql",
-		"",
+		mock.AnythingOfType("string"), // execPath from tool registry
 	).Return(nil)
 
 	mockSqldef.On("Execute", mock.Anything, true).Return(errors.New("execute failed."))
@@ -221,13 +222,13 @@ func TestPlugin_executePlanStage_UnsupportedDBType(t *testing.T) {
 	// Create deploy targets with unsupported DB type
 	deployTargets := []*sdk.DeployTarget[config.DeployTargetConfig]{
 		{
-			Name: "test-postgres",
+			Name: "test-mssql",
 			Config: config.DeployTargetConfig{
-				DbType:   config.DBTypePostgres, // Unsupported type
+				DbType:   config.DBTypeMSSQL, // Unsupported type
 				Username: "testuser",
 				Password: "testpass",
 				Host:     "localhost",
-				Port:     "5432",
+				Port:     "1433",
 				DBName:   "testdb",
 			},
 		},
@@ -260,7 +261,7 @@ func TestPlugin_executePlanStage_SqldefExecuteError(t *testing.T) {
 	// Setup expectations for the mock
 	mockSqldef.On("Init",
 		mock.AnythingOfType("logpersistertest.TestLogPersister"),
-		"testuser", "testpass", "localhost", "3306", "testdb",
+		config.DeployTargetConfig{DbType: config.DBTypeMySQL, Username: "testuser", Password: "testpass", Host: "localhost", Port: "3306", DBName: "testdb"},
 		filepath.Join("testdata", "schema.sql"),
 		mock.AnythingOfType("string"), // execPath from tool registry
 	).Return()
@@ -331,7 +332,7 @@ func TestPlugin_executePlanStage_MultipleTargets(t *testing.T) {
 	// Setup expectations for the mock - should be called twice for two targets
 	mockSqldef.On("Init",
 		mock.AnythingOfType("logpersistertest.TestLogPersister"),
-		"testuser1", "testpass1", "localhost", "3306", "testdb1",
+		config.DeployTargetConfig{DbType: config.DBTypeMySQL, Username: "testuser1", Password: "testpass1", Host: "localhost", Port: "3306", DBName: "testdb1"},
 		filepath.Join("testdata", "schema.sql"),
 		mock.AnythingOfType("string"), // execPath from tool registry
 	).Return().Once()
@@ -340,7 +341,7 @@ func TestPlugin_executePlanStage_MultipleTargets(t *testing.T) {
 
 	mockSqldef.On("Init",
 		mock.AnythingOfType("logpersistertest.TestLogPersister"),
-		"testuser2", "testpass2", "localhost", "3307", "testdb2",
+		config.DeployTargetConfig{DbType: config.DBTypeMySQL, Username: "testuser2", Password: "testpass2", Host: "localhost", Port: "3307", DBName: "testdb2"},
 		filepath.Join("testdata", "schema.sql"),
 		mock.AnythingOfType("string"), // execPath from tool registry
 	).Return().Once()
@@ -0,0 +1,200 @@
+package deployment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	sdk "github.com/pipe-cd/piped-plugin-sdk-go"
+
+	"github.com/pipe-cd/community-plugins/plugins/sqldef/config"
+	toolRegistryPkg "github.com/pipe-cd/community-plugins/plugins/sqldef/toolregistry"
+)
+
+var (
+	alterTableRegex = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+(\S+)\s+(.*)$`)
+	dropColumnRegex = regexp.MustCompile(`(?i)^DROP\s+(?:COLUMN\s+)?(?:IF\s+EXISTS\s+)?([^\s,]+)`)
+	dropTableRegex  = regexp.MustCompile(`(?i)^DROP\s+TABLE\s+(?:IF\s+EXISTS\s+)?(\S+)`)
+	dropOtherRegex  = regexp.MustCompile(`(?i)^DROP\s+(?:INDEX|KEY|PRIMARY|FOREIGN|CONSTRAINT|CHECK|DEFAULT|PARTITION)\b`)
+)
+
+func (p *Plugin) executeRollbackStage(ctx context.Context, dts []*sdk.DeployTarget[config.DeployTargetConfig], input *sdk.ExecuteStageInput[config.ApplicationConfigSpec]) sdk.StageStatus {
+	lp := input.Client.LogPersister()
+	lp.Info("Start rolling back the schema deployment")
+
+	var stageConfig config.SqldefRollbackStageOptions
+	if len(input.Request.StageConfig) > 0 {
+		if err := json.Unmarshal(input.Request.StageConfig, &stageConfig); err != nil {
+			lp.Errorf("Failed to unmarshal stage config (%v)", err)
+			return sdk.StageStatusFailure
+		}
+	}
+
+	rds := input.Request.RunningDeploymentSource
+	if rds.CommitHash == "" {
+		lp.Error("Unable to determine the last deployed commit to rollback. It seems this is the first deployment.")
+		return sdk.StageStatusFailure
+	}
+	lp.Infof("Rolling back to the schema of the last deployed commit %s", rds.CommitHash)
+
+	schemaPath, err := findFirstSQLFile(rds.ApplicationDirectory)
+	if err != nil {
+		lp.Errorf("Failed while finding schema file (%v)", err)
+		return sdk.StageStatusFailure
+	}
+
+	// Currently, we create them every time the stage is executed beucause we can't pass input.Client.toolRegistry to the plugin when starting the plugin.
+	toolRegistry := toolRegistryPkg.NewRegistry(input.Client.ToolRegistry())
+	installed := make(map[config.DBType]string)
+
+	var failed []string
+	for _, dt := range dts {
+		logDeployTarget(lp, dt, schemaPath)
+
+		if err := p.rollbackSchema(ctx, lp, toolRegistry, installed, dt, schemaPath, stageConfig.AllowDropColumns); err != nil {
+			lp.Errorf("Failed to roll back the schema of deploy target [%s] (%v)", dt.Name, err)
+			failed = append(failed, dt.Name)
+			continue
+		}
+		lp.Successf("Successfully rolled back the schema of deploy target [%s]", dt.Name)
+	}
+
+	if len(failed) > 0 {
+		lp.Errorf("Failed to roll back the schema of %d of %d deploy target(s): %s", len(failed), len(dts), strings.Join(failed, ", "))
+		return sdk.StageStatusFailure
+	}
+	return sdk.StageStatusSuccess
+}
+
+// rollbackSchema shows the reverse DDL with a dry-run, then applies the previously deployed schema to the given deploy target.
+// It refuses to drop columns or tables unless allowDrop is true.
+func (p *Plugin) rollbackSchema(ctx context.Context, lp sdk.StageLogPersister, toolRegistry *toolRegistryPkg.Registry, installed map[config.DBType]string, dt *sdk.DeployTarget[config.DeployTargetConfig], schemaPath string, allowDrop bool) error {
+	sqlDefPath, err := installSqldef(ctx, toolRegistry, installed, dt.Config.DbType)
+	if err != nil {
+		return err
+	}
+
+	p.Sqldef.Init(lp, dt.Config, schemaPath, sqlDefPath)
+
+	statements, err := p.Sqldef.DryRun(ctx)
+	if err != nil {
+		return fmt.Errorf("failed while dry-running the rollback: %w", err)
+	}
+	lp.Info("Dry run mode: the following SQL statements would be executed to roll back:")
+	lp.Info(statements)
+
+	if drops := findDroppedColumns(statements); len(drops) > 0 {
+		if !allowDrop {
+			return fmt.Errorf("the rollback would drop %s and lose their data, set allow_drop_columns to true in the stage options to allow it", strings.Join(drops, ", "))
+		}
+		lp.Infof("The rollback drops %s because allow_drop_columns is enabled", strings.Join(drops, ", "))
+	}
+
+	if err := p.Sqldef.Execute(ctx, false); err != nil {
+		return fmt.Errorf("failed while applying the rollback: %w", err)
+	}
+	return nil
+}
+
+// findDroppedColumns returns the columns and tables which are dropped by the given SQL statements.
+// The dropped columns are returned as "table.column", and the dropped tables as "table table".
+func findDroppedColumns(statements string) []string {
+	var drops []string
+	for _, stmt := range splitStatements(statements) {
+		if m := dropTableRegex.FindStringSubmatch(stmt); m != nil {
+			drops = append(drops, "table "+unquoteIdentifier(m[1]))
+			continue
+		}
+		m := alterTableRegex.FindStringSubmatch(stmt)
+		if m == nil {
+			continue
+		}
+		table := unquoteIdentifier(m[1])
+		for _, clause := range splitTopLevel(m[2], ',') {
+			clause = strings.TrimSpace(clause)
+			if dropOtherRegex.MatchString(clause) {
+				continue
+			}
+			if c := dropColumnRegex.FindStringSubmatch(clause); c != nil {
+				drops = append(drops, table+"."+unquoteIdentifier(c[1]))
+			}
+		}
+	}
+	return drops
+}
+
+// splitStatements splits the output of sqldef into statements, removing the comments.
+func splitStatements(s string) []string {
+	return splitTopLevel(s, ';')
+}
+
+// splitTopLevel splits s at every sep which is neither inside parentheses, quotes nor comments.
+// The comments are removed and the empty parts are dropped.
+func splitTopLevel(s string, sep rune) []string {
+	var (
+		parts []string
+		b     strings.Builder
+		depth int
+		quote rune
+	)
+	flush := func() {
+		if part := strings.TrimSpace(b.String()); part != "" {
+			parts = append(parts, part)
+		}
+		b.Reset()
+	}
+
+	rs := []rune(s)
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		if quote != 0 {
+			b.WriteRune(r)
+			switch {
+			case r == '\\' && quote == '\'' && i+1 < len(rs):
+				// MySQL escapes the characters in strings with a backslash.
+				i++
+				b.WriteRune(rs[i])
+			case r == quote:
+				// A doubled quote is an escaped one, which is handled as closing and reopening the quote.
+				quote = 0
+			}
+			continue
+		}
+
+		switch {
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '-' && i+1 < len(rs) && rs[i+1] == '-':
+			for i < len(rs) && rs[i] != '\n' {
+				i++
+			}
+			b.WriteRune('\n')
+			continue
+		case r == '/' && i+1 < len(rs) && rs[i+1] == '*':
+			i += 2
+			for i < len(rs) && !(rs[i] == '*' && i+1 < len(rs) && rs[i+1] == '/') {
+				i++
+			}
+			i++
+			b.WriteRune(' ')
+			continue
+		case r == '(':
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+		case r == sep && depth == 0:
+			flush()
+			continue
+		}
+		b.WriteRune(r)
+	}
+	flush()
+	return parts
+}
+
+// unquoteIdentifier removes the quotes of the MySQL, PostgreSQL and SQL Server identifiers.
+func unquoteIdentifier(s string) string {
+	return strings.NewReplacer("`", "", `"`, "", "[", "", "]", "").Replace(s)
+}
@@ -0,0 +1,206 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	sdk "github.com/pipe-cd/piped-plugin-sdk-go"
+	"github.com/pipe-cd/piped-plugin-sdk-go/logpersister/logpersistertest"
+	"github.com/pipe-cd/piped-plugin-sdk-go/toolregistry/toolregistrytest"
+
+	"github.com/pipe-cd/community-plugins/plugins/sqldef/config"
+)
+
+func newRollbackStageInput(t *testing.T, runningCommitHash string, stageConfig []byte) *sdk.ExecuteStageInput[config.ApplicationConfigSpec] {
+	return &sdk.ExecuteStageInput[config.ApplicationConfigSpec]{
+		Request: sdk.ExecuteStageRequest[config.ApplicationConfigSpec]{
+			StageName:   sqldefStageRollback,
+			StageConfig: stageConfig,
+			RunningDeploymentSource: sdk.DeploymentSource[config.ApplicationConfigSpec]{
+				ApplicationDirectory: filepath.Join("testdata"),
+				CommitHash:           runningCommitHash,
+			},
+			TargetDeploymentSource: sdk.DeploymentSource[config.ApplicationConfigSpec]{
+				ApplicationDirectory: filepath.Join("testdata", "not-used"),
+				CommitHash:           "9876543210",
+			},
+			Deployment: sdk.Deployment{
+				PipedID:       "piped-id",
+				ApplicationID: "app-id",
+			},
+		},
+		Client: sdk.NewClient(nil, "sqldef", "", "", logpersistertest.NewTestLogPersister(t), toolregistrytest.NewTestToolRegistry(t)),
+	}
+}
+
+func TestPlugin_executeRollbackStage(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		stageConfig []byte
+		dryRun      string
+		dryRunErr   error
+		executeErr  error
+		wantApplied bool
+		want        sdk.StageStatus
+	}{
+		{
+			name:        "reverts an added index",
+			dryRun:      "-- dry run --\nALTER TABLE `users` DROP INDEX `idx_name`;\n",
+			wantApplied: true,
+			want:        sdk.StageStatusSuccess,
+		},
+		{
+			name:   "refuses to drop a column",
+			dryRun: "-- dry run --\nALTER TABLE `users` DROP COLUMN `nickname`;\n",
+			want:   sdk.StageStatusFailure,
+		},
+		{
+			name:        "drops a column when allowed",
+			stageConfig: []byte(`{"allow_drop_columns": true}`),
+			dryRun:      "-- dry run --\nALTER TABLE `users` DROP COLUMN `nickname`;\n",
+			wantApplied: true,
+			want:        sdk.StageStatusSuccess,
+		},
+		{
+			name:      "dry-run failed",
+			dryRunErr: errors.New("connection refused"),
+			want:      sdk.StageStatusFailure,
+		},
+		{
+			name:        "apply failed",
+			dryRun:      "-- dry run --\n-- Nothing is modified --\n",
+			executeErr:  errors.New("connection refused"),
+			wantApplied: true,
+			want:        sdk.StageStatusFailure,
+		},
+		{
+			name:        "invalid stage config",
+			stageConfig: []byte(`{"allow_drop_columns": "yes"}`),
+			want:        sdk.StageStatusFailure,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			mockSqldef := &MockSqldefProvider{}
+			mockSqldef.On("Init",
+				mock.Anything, config.DeployTargetConfig{DbType: config.DBTypeMySQL, Username: "testuser", Password: "testpass", Host: "localhost", Port: "3306", DBName: "testdb"},
+				filepath.Join("testdata", "schema.sql"),
+				mock.MatchedBy(func(execPath string) bool { return execPath != "" }),
+			).Return().Maybe()
+			mockSqldef.On("DryRun", ctx).Return(tt.dryRun, tt.dryRunErr).Maybe()
+			mockSqldef.On("Execute", ctx, false).Return(tt.executeErr).Maybe()
+
+			plugin := createPluginWithMockSqldef(mockSqldef)
+			status := plugin.executeRollbackStage(ctx, []*sdk.DeployTarget[config.DeployTargetConfig]{
+				newMySQLDeployTarget("test-mysql", "3306"),
+			}, newRollbackStageInput(t, "0123456789", tt.stageConfig))
+
+			assert.Equal(t, tt.want, status)
+			if tt.wantApplied {
+				mockSqldef.AssertCalled(t, "Execute", ctx, false)
+			} else {
+				mockSqldef.AssertNotCalled(t, "Execute", ctx, false)
+			}
+		})
+	}
+}
+
+func TestPlugin_executeRollbackStage_NoPreviousCommit(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	// The provider is never called when there is no previously deployed commit.
+	mockSqldef := &MockSqldefProvider{}
+
+	plugin := createPluginWithMockSqldef(mockSqldef)
+	status := plugin.executeRollbackStage(ctx, []*sdk.DeployTarget[config.DeployTargetConfig]{
+		newMySQLDeployTarget("test-mysql", "3306"),
+	}, newRollbackStageInput(t, "", nil))
+
+	assert.Equal(t, sdk.StageStatusFailure, status)
+	mockSqldef.AssertExpectations(t)
+}
+
+func TestFindDroppedColumns(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		statements string
+		want       []string
+	}{
+		{
+			name:       "nothing is modified",
+			statements: "-- dry run --\n-- Nothing is modified --\n",
+		},
+		{
+			name:       "mysql drop column",
+			statements: "-- dry run --\nALTER TABLE `users` DROP COLUMN `nickname`;\nALTER TABLE `users` ADD COLUMN `age` int;\n",
+			want:       []string{"users.nickname"},
+		},
+		{
+			name:       "postgres drop column with schema",
+			statements: "-- dry run --\nALTER TABLE \"app\".\"users\" DROP COLUMN \"nickname\";\n",
+			want:       []string{"app.users.nickname"},
+		},
+		{
+			name:       "multiple clauses",
+			statements: "ALTER TABLE users DROP COLUMN a, DROP INDEX idx_b, ADD COLUMN c DECIMAL(10,2), DROP d;",
+			want:       []string{"users.a", "users.d"},
+		},
+		{
+			name:       "enum values and string defaults",
+			statements: "ALTER TABLE `users` ADD COLUMN `status` ENUM('a','b') NOT NULL, DROP COLUMN `state`;\nALTER TABLE `users` ADD COLUMN `memo` varchar(16) DEFAULT 'a;b, DROP COLUMN c', DROP COLUMN `note`;\n",
+			want:       []string{"users.state", "users.note"},
+		},
+		{
+			name:       "escaped quotes in string defaults",
+			statements: "ALTER TABLE users ADD COLUMN a text DEFAULT 'it''s; DROP x', ADD COLUMN b text DEFAULT 'it\\'s, DROP y', DROP COLUMN c;",
+			want:       []string{"users.c"},
+		},
+		{
+			name:       "comments",
+			statements: "-- dry run --\nALTER TABLE users /* DROP COLUMN a; */ DROP COLUMN b, -- DROP COLUMN c;\nDROP COLUMN d;\n/* ALTER TABLE users DROP COLUMN e; */\n",
+			want:       []string{"users.b", "users.d"},
+		},
+		{
+			name:       "decimal columns",
+			statements: "ALTER TABLE `prices` MODIFY COLUMN `amount` DECIMAL(10,2) NOT NULL DEFAULT 0.00, DROP COLUMN `amount_old`;",
+			want:       []string{"prices.amount_old"},
+		},
+		{
+			name:       "drop table",
+			statements: "-- dry run --\nDROP TABLE `sessions`;\n",
+			want:       []string{"table sessions"},
+		},
+		{
+			name:       "drop index, key and constraints",
+			statements: "ALTER TABLE `users` DROP INDEX `idx_name`;\nALTER TABLE `users` DROP PRIMARY KEY;\nALTER TABLE `orders` DROP FOREIGN KEY `fk_user`;\nDROP INDEX `idx_email` ON `users`;\nALTER TABLE \"users\" DROP CONSTRAINT \"users_email_check\";\n",
+		},
+		{
+			name:       "drop partition",
+			statements: "ALTER TABLE `logs` DROP PARTITION `p2023`, DROP PARTITION p2024;\nALTER TABLE `logs` DROP PARTITION `p2022`, DROP COLUMN `level`;\n",
+			want:       []string{"logs.level"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, findDroppedColumns(tt.statements))
+		})
+	}
+}
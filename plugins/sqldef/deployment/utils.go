@@ -1,10 +1,17 @@
 package deployment
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+
+	sdk "github.com/pipe-cd/piped-plugin-sdk-go"
+
+	"github.com/pipe-cd/community-plugins/plugins/sqldef/config"
+	toolRegistryPkg "github.com/pipe-cd/community-plugins/plugins/sqldef/toolregistry"
 )
 
 func findFirstSQLFile(appDir string) (string, error) {
@@ -27,3 +34,41 @@ func findFirstSQLFile(appDir string) (string, error) {
 	}
 	return firstSQLFile, nil
 }
+
+// installSqldef installs the sqldef binary for the given database type and returns its path.
+// The installed paths are cached in the given map to prevent downloading the same binary repeatedly.
+func installSqldef(ctx context.Context, toolRegistry *toolRegistryPkg.Registry, installed map[config.DBType]string, dbType config.DBType) (string, error) {
+	if path, ok := installed[dbType]; ok {
+		return path, nil
+	}
+
+	var (
+		path string
+		err  error
+	)
+	switch dbType {
+	case config.DBTypeMySQL:
+		path, err = toolRegistry.Mysqldef(ctx, "")
+	case config.DBTypePostgres:
+		path, err = toolRegistry.Psqldef(ctx, "")
+	default:
+		return "", fmt.Errorf("unsupported database type: %s, currently only support: mysql, psql", dbType)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed while getting Sqldef tool: %w", err)
+	}
+	installed[dbType] = path
+	return path, nil
+}
+
+// logDeployTarget writes the deploy target and the schema file applied to it, in the same format for all stages.
+func logDeployTarget(lp sdk.StageLogPersister, dt *sdk.DeployTarget[config.DeployTargetConfig], schemaPath string) {
+	lp.Infof("Deploy Target [%s]: type=%s, host=%s, port=%s, db=%s, schemaFile=%s",
+		dt.Name,
+		dt.Config.DbType,
+		dt.Config.Host,
+		dt.Config.Port,
+		dt.Config.DBName,
+		schemaPath,
+	)
+}
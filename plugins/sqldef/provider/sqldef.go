@@ -18,84 +18,94 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	sdk "github.com/pipe-cd/piped-plugin-sdk-go"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
+
+	sdk "github.com/pipe-cd/piped-plugin-sdk-go"
+
+	"github.com/pipe-cd/community-plugins/plugins/sqldef/config"
 )
 
 type SqldefProvider interface {
-	Init(logger sdk.StageLogPersister, username, password, host, port, dbName, schemaFilePath, execPath string)
+	Init(logger sdk.StageLogPersister, cfg config.DeployTargetConfig, schemaFilePath, execPath string)
 	ShowCurrentSchema(ctx context.Context) (string, error)
+	DryRun(ctx context.Context) (string, error)
 	Execute(ctx context.Context, dryRun bool) error
 }
 
 type SqldefProviderImpl struct {
 	logger         sdk.StageLogPersister
-	username       string
-	password       string
-	host           string
-	port           string
-	DBName         string
+	cfg            config.DeployTargetConfig
 	SchemaFilePath string
 	execPath       string
 }
 
 // NewSqldef creates a new Sqldef instance.
-func (s *SqldefProviderImpl) Init(logger sdk.StageLogPersister, username, password, host, port, dbName, schemaFilePath, execPath string) {
+func (s *SqldefProviderImpl) Init(logger sdk.StageLogPersister, cfg config.DeployTargetConfig, schemaFilePath, execPath string) {
 	s.logger = logger
-	s.username = username
-	s.password = password
-	s.host = host
-	s.port = port
-	s.DBName = dbName
+	s.cfg = cfg
 	s.SchemaFilePath = schemaFilePath
 	s.execPath = execPath
 }
 
 func (s *SqldefProviderImpl) ShowCurrentSchema(ctx context.Context) (string, error) {
-	args := []string{
-		"-u", s.username,
-		"-p", s.password,
-		"-h", s.host,
-		"-P", s.port,
-		"--export",
-		s.DBName,
+	cmd, cleanup, err := s.command(ctx, "--export")
+	if err != nil {
+		return "", err
 	}
+	defer cleanup()
 
-	cmd := exec.CommandContext(ctx, s.execPath, args...)
 	var outBuf, errBuf bytes.Buffer
 	cmd.Stdout = &outBuf
 	cmd.Stderr = &errBuf
 
 	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("failed to run mysqldef: %w, stderr: %s", err, errBuf.String())
+		return "", fmt.Errorf("failed to run %s: %w, stderr: %s", filepath.Base(s.execPath), err, errBuf.String())
 	}
 
 	return outBuf.String(), nil
 }
 
+// DryRun returns the SQL statements which would be executed to apply the schema, without applying them.
+func (s *SqldefProviderImpl) DryRun(ctx context.Context) (string, error) {
+	return s.run(ctx, true)
+}
+
 func (s *SqldefProviderImpl) Execute(ctx context.Context, dryRun bool) error {
-	args := []string{
-		"-u", s.username,
-		"-p", s.password,
-		"-h", s.host,
-		"-P", s.port,
-		"--enable-drop",
+	out, err := s.run(ctx, dryRun)
+	if err != nil {
+		return err
 	}
 
+	if dryRun {
+		s.logger.Info("Dry run mode: the following SQL statements would be executed:")
+	} else {
+		s.logger.Info("sqldef executed successfully. Output:")
+	}
+	s.logger.Info(out)
+
+	return nil
+}
+
+func (s *SqldefProviderImpl) run(ctx context.Context, dryRun bool) (string, error) {
+	args := []string{"--enable-drop"}
 	if dryRun {
 		args = append(args, "--dry-run")
 	}
 
-	args = append(args, s.DBName)
+	cmd, cleanup, err := s.command(ctx, args...)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
 
 	file, err := os.Open(s.SchemaFilePath)
 	if err != nil {
-		return fmt.Errorf("failed to open schema file: %w", err)
+		return "", fmt.Errorf("failed to open schema file: %w", err)
 	}
 	defer file.Close()
-
-	cmd := exec.CommandContext(ctx, s.execPath, args...)
 	cmd.Stdin = file
 
 	var stdout, stderr bytes.Buffer
@@ -103,15 +113,76 @@ func (s *SqldefProviderImpl) Execute(ctx context.Context, dryRun bool) error {
 	cmd.Stderr = &stderr
 
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("Execution failed: %w\nstderr: %s", err, stderr.String())
+		return "", fmt.Errorf("Execution failed: %w\nstderr: %s", err, stderr.String())
 	}
 
-	if dryRun {
-		s.logger.Info("Dry run mode: the following SQL statements would be executed:")
-	} else {
-		s.logger.Info("sqldef executed successfully. Output:")
+	return stdout.String(), nil
+}
+
+// command returns the sqldef command connecting to the target database with the given arguments.
+// The returned cleanup function must be called after running the command.
+func (s *SqldefProviderImpl) command(ctx context.Context, args ...string) (*exec.Cmd, func(), error) {
+	var (
+		connArgs []string
+		envs     []string
+		cleanup  = func() {}
+	)
+	switch s.cfg.DbType {
+	case config.DBTypePostgres:
+		// Pass the password with PGPASSWORD instead of -W so that it isn't shown in the process list.
+		connArgs = []string{
+			"-U", s.cfg.Username,
+			"-h", s.cfg.Host,
+			"-p", s.cfg.Port,
+		}
+		envs = append(envs, "PGPASSWORD="+s.cfg.Password)
+		if s.cfg.SSLMode != "" {
+			envs = append(envs, "PGSSLMODE="+s.cfg.SSLMode)
+		}
+		if schemas := s.cfg.Schemas(); len(schemas) > 0 {
+			// Unqualified names in the schema file are resolved with the search_path,
+			// and only the tables in these schemas are managed so that the other schemas are never dropped.
+			envs = append(envs, "PGOPTIONS=-c search_path="+strings.Join(schemas, ","))
+			path, err := writePsqldefConfig(schemas)
+			if err != nil {
+				return nil, nil, err
+			}
+			cleanup = func() { os.Remove(path) }
+			connArgs = append(connArgs, "--config", path)
+		}
+	default:
+		connArgs = []string{
+			"-u", s.cfg.Username,
+			"-p", s.cfg.Password,
+			"-h", s.cfg.Host,
+			"-P", s.cfg.Port,
+		}
 	}
-	s.logger.Info(stdout.String())
 
-	return nil
+	args = append(append(connArgs, args...), s.cfg.DBName)
+	cmd := exec.CommandContext(ctx, s.execPath, args...)
+	if len(envs) > 0 {
+		cmd.Env = append(os.Environ(), envs...)
+	}
+	return cmd, cleanup, nil
+}
+
+// writePsqldefConfig writes a psqldef config file which limits the managed schemas to the given ones, and returns its path.
+func writePsqldefConfig(schemas []string) (string, error) {
+	f, err := os.CreateTemp("", "psqldef-config-*.yaml")
+	if err != nil {
+		return "", fmt.Errorf("failed to create psqldef config file: %w", err)
+	}
+	defer f.Close()
+
+	var b strings.Builder
+	b.WriteString("target_schema: |\n")
+	for _, schema := range schemas {
+		fmt.Fprintf(&b, "  %s\n", schema)
+	}
+	if _, err := f.WriteString(b.String()); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write psqldef config file: %w", err)
+	}
+	return f.Name(), nil
 }
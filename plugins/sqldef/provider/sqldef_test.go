@@ -0,0 +1,107 @@
+package provider
+
+import (
+	"context"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pipe-cd/community-plugins/plugins/sqldef/config"
+)
+
+func TestSqldefProviderImpl_command(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		cfg        config.DeployTargetConfig
+		wantArgs   []string
+		wantEnvs   []string
+		wantConfig string
+	}{
+		{
+			name: "mysql",
+			cfg: config.DeployTargetConfig{
+				DbType:   config.DBTypeMySQL,
+				Username: "user",
+				Password: "pass",
+				Host:     "localhost",
+				Port:     "3306",
+				DBName:   "app",
+			},
+			wantArgs: []string{"-u", "user", "-p", "pass", "-h", "localhost", "-P", "3306", "--dry-run", "app"},
+		},
+		{
+			name: "postgres",
+			cfg: config.DeployTargetConfig{
+				DbType:   config.DBTypePostgres,
+				Username: "user",
+				Password: "pass",
+				Host:     "localhost",
+				Port:     "5432",
+				DBName:   "app",
+				SSLMode:  "require",
+			},
+			wantArgs: []string{"-U", "user", "-h", "localhost", "-p", "5432", "--dry-run", "app"},
+			wantEnvs: []string{"PGPASSWORD=pass", "PGSSLMODE=require"},
+		},
+		{
+			name: "postgres with search_path",
+			cfg: config.DeployTargetConfig{
+				DbType:     config.DBTypePostgres,
+				Username:   "user",
+				Password:   "pass",
+				Host:       "localhost",
+				Port:       "5432",
+				DBName:     "app",
+				SearchPath: "billing, public",
+			},
+			wantArgs:   []string{"-U", "user", "-h", "localhost", "-p", "5432", "--config", "--dry-run", "app"},
+			wantEnvs:   []string{"PGPASSWORD=pass", "PGOPTIONS=-c search_path=billing,public"},
+			wantConfig: "target_schema: |\n  billing\n  public\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := &SqldefProviderImpl{}
+			s.Init(nil, tt.cfg, "schema.sql", "/bin/sqldef")
+
+			cmd, cleanup, err := s.command(context.Background(), "--dry-run")
+			require.NoError(t, err)
+
+			// The path of the generated config file is random, so it is removed from the args before comparing.
+			args := cmd.Args[1:]
+			var configPath string
+			if i := slices.Index(args, "--config"); i >= 0 {
+				configPath = args[i+1]
+				args = slices.Delete(args, i+1, i+2)
+			}
+			assert.Equal(t, tt.wantArgs, args)
+
+			if tt.wantEnvs == nil {
+				assert.Nil(t, cmd.Env)
+			} else {
+				assert.Subset(t, cmd.Env, tt.wantEnvs)
+			}
+
+			if tt.wantConfig != "" {
+				data, err := os.ReadFile(configPath)
+				require.NoError(t, err)
+				assert.Equal(t, tt.wantConfig, string(data))
+			}
+
+			// The config file is removed by the cleanup function.
+			cleanup()
+			if configPath != "" {
+				_, err := os.Stat(configPath)
+				assert.True(t, os.IsNotExist(err))
+			}
+		})
+	}
+}
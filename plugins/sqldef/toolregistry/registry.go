@@ -45,3 +45,9 @@ type Registry struct {
 func (r *Registry) Mysqldef(ctx context.Context, version string) (string, error) {
 	return r.client.InstallTool(ctx, "mysqldef", cmp.Or(version, defaultSqldefVersion), MysqldefInstallScript)
 }
+
+// Psqldef installs the psqldef tool with the given version and return the path to the installed binary.
+// If the version is empty, the default version will be used.
+func (r *Registry) Psqldef(ctx context.Context, version string) (string, error) {
+	return r.client.InstallTool(ctx, "psqldef", cmp.Or(version, defaultSqldefVersion), PsqldefInstallScript)
+}
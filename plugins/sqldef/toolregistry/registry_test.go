@@ -37,3 +37,18 @@ func TestRegistry_Sqldef(t *testing.T) {
 
 	assert.Contains(t, path, "mysqldef-2.0.4", "Expected file title not found in path")
 }
+
+func TestRegistry_Psqldef(t *testing.T) {
+	t.Parallel()
+
+	c := toolregistrytest.NewTestToolRegistry(t)
+
+	r := NewRegistry(c)
+
+	path, err := r.Psqldef(context.Background(), "2.0.4")
+
+	assert.NoError(t, err)
+	require.NotEmpty(t, path)
+
+	assert.Contains(t, path, "psqldef-2.0.4", "Expected file title not found in path")
+}
@@ -20,3 +20,10 @@ curl -LO https://github.com/sqldef/sqldef/releases/download/v{{ .Version }}/mysq
 unzip mysqldef_{{ .Os }}_{{ .Arch }}.zip
 cp mysqldef {{ .OutPath }}
 `
+
+const PsqldefInstallScript = `
+cd {{ .TmpDir }}
+curl -LO https://github.com/sqldef/sqldef/releases/download/v{{ .Version }}/psqldef_{{ .Os }}_{{ .Arch }}.zip
+unzip psqldef_{{ .Os }}_{{ .Arch }}.zip
+cp psqldef {{ .OutPath }}
+`